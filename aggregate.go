@@ -12,23 +12,53 @@ type Aggregate interface {
 	Entity
 	// Event management
 	RaiseEvent(payload any)
+	Events() []Event
 	GetAllEvents() []Event
 	GetFirstEvent() Event
 	ClearEvents()
 	AggregateType() string
+	// ActAs raises the following events on behalf of a principal, see Acting
+	ActAs(principal *Principal)
+	// Version is the stored version the aggregate was loaded at, see CheckVersion
+	Version() int
+	// SetVersion sets the version of the aggregate, repositories set it when they load and store it
+	SetVersion(version int)
 }
 
 type aggregate struct {
 	Entity
-	aggType string
-	events  []Event
-	mu      sync.Mutex
+	aggType   string
+	events    []Event
+	principal *Principal
+	version   int
+	mu        sync.Mutex
 }
 
 func (a *aggregate) AggregateType() string {
 	return a.aggType
 }
 
+func (a *aggregate) ActAs(principal *Principal) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.principal = principal
+}
+
+func (a *aggregate) Version() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.version
+}
+
+func (a *aggregate) SetVersion(version int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.version = version
+}
+
 // RaiseEvent adds an event to the aggregate's event list
 func (a *aggregate) RaiseEvent(payload any) {
 	a.mu.Lock()
@@ -44,15 +74,25 @@ func (a *aggregate) RaiseEvent(payload any) {
 			eventType,
 			timeStamp,
 			payload,
+			a.principal,
 		})
 }
 
+// Events returns the events that have been raised without clearing them, repositories clear them once
+// they are stored
+func (a *aggregate) Events() []Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]Event{}, a.events...)
+}
+
 // GetAllEvents returns all the events that have been raised and clears them.
 func (a *aggregate) GetAllEvents() []Event {
-	e := a.events
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	e := a.events
 	a.events = make([]Event, 0)
 	return e
 }
@@ -79,11 +119,16 @@ func (a *aggregate) ClearEvents() {
 	a.events = make([]Event, 0)
 }
 
+// AggregateType returns the fully qualified type name of an aggregate
+func AggregateType(aggregate any) string {
+	return reflect.TypeOf(aggregate).PkgPath() + "." + reflect.TypeOf(aggregate).Name()
+}
+
 // NewAggregate creates a new Aggregate instance
 func NewAggregate[T any](id ID, aggregateType T) Aggregate {
 	return &aggregate{
 		Entity:  NewEntity(id),
-		aggType: reflect.TypeOf(aggregateType).PkgPath() + "." + reflect.TypeOf(aggregateType).Name(),
+		aggType: AggregateType(aggregateType),
 		events:  make([]Event, 0),
 	}
 }
@@ -0,0 +1,182 @@
+package amqp
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	ddd "github.com/paulvitic/ddd-go"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RequeuePolicy decides whether a message that failed processing goes back to its queue
+type RequeuePolicy string
+
+const (
+	// RequeueNever rejects failed messages, sending them to the dead letter exchange of the queue if any
+	RequeueNever RequeuePolicy = "never"
+	// RequeueOnce requeues a failed message unless it was already redelivered
+	RequeueOnce RequeuePolicy = "once"
+	// RequeueAlways requeues failed messages until they are processed
+	RequeueAlways RequeuePolicy = "always"
+)
+
+// Exchange declares an exchange
+type Exchange struct {
+	Name       string         `json:"name"`
+	Kind       string         `json:"kind"`
+	Durable    bool           `json:"durable"`
+	AutoDelete bool           `json:"autoDelete"`
+	Internal   bool           `json:"internal"`
+	Args       map[string]any `json:"args"`
+}
+
+// Queue declares a queue
+type Queue struct {
+	Name       string         `json:"name"`
+	Durable    bool           `json:"durable"`
+	AutoDelete bool           `json:"autoDelete"`
+	Exclusive  bool           `json:"exclusive"`
+	Args       map[string]any `json:"args"`
+}
+
+// Binding binds a queue to an exchange
+type Binding struct {
+	Queue      string         `json:"queue"`
+	Exchange   string         `json:"exchange"`
+	RoutingKey string         `json:"routingKey"`
+	Args       map[string]any `json:"args"`
+}
+
+// Topology is the set of exchanges, queues and bindings declared on every (re)connection
+type Topology struct {
+	Exchanges []Exchange `json:"exchanges"`
+	Queues    []Queue    `json:"queues"`
+	Bindings  []Binding  `json:"bindings"`
+}
+
+// Declare declares the topology on a channel, exchanges first and bindings last
+func (t Topology) Declare(ch Channel) error {
+	for _, exchange := range t.Exchanges {
+		kind := exchange.Kind
+		if kind == "" {
+			kind = amqp.ExchangeDirect
+		}
+		if err := ch.ExchangeDeclare(exchange.Name, kind, exchange.Durable, exchange.AutoDelete, exchange.Internal, false, exchange.Args); err != nil {
+			return fmt.Errorf("failed to declare exchange %s: %w", exchange.Name, err)
+		}
+	}
+	for _, queue := range t.Queues {
+		if _, err := ch.QueueDeclare(queue.Name, queue.Durable, queue.AutoDelete, queue.Exclusive, false, queue.Args); err != nil {
+			return fmt.Errorf("failed to declare queue %s: %w", queue.Name, err)
+		}
+	}
+	for _, binding := range t.Bindings {
+		if err := ch.QueueBind(binding.Queue, binding.RoutingKey, binding.Exchange, false, binding.Args); err != nil {
+			return fmt.Errorf("failed to bind queue %s to exchange %s: %w", binding.Queue, binding.Exchange, err)
+		}
+	}
+	return nil
+}
+
+// Config holds the broker connection, consumption and publication settings
+type Config struct {
+	Username            string        `json:"amqpUsername"`
+	Password            string        `json:"amqpPassword"`
+	Host                string        `json:"amqpHost"`
+	Port                int           `json:"amqpPort"`
+	VirtualHost         string        `json:"amqpVirtualHost"`
+	Queue               string        `json:"amqpQueue"`
+	Prefetch            int           `json:"amqpPrefetch"`
+	Concurrency         int           `json:"amqpConcurrency"`
+	RequeuePolicy       RequeuePolicy `json:"amqpRequeuePolicy"`
+	Exchange            string        `json:"amqpExchange"`
+	ConfirmTimeoutMs    int           `json:"amqpConfirmTimeoutMs"`
+	ReconnectDelayMs    int           `json:"amqpReconnectDelayMs"`
+	MaxReconnectDelayMs int           `json:"amqpMaxReconnectDelayMs"`
+	// ShutdownTimeoutMs is how long a stopping consumer waits for the messages being processed before
+	// cancelling their context
+	ShutdownTimeoutMs int      `json:"amqpShutdownTimeoutMs"`
+	Topology          Topology `json:"amqpTopology"`
+}
+
+// NewConfig loads the AMQP configuration from the given path, the DDD_AMQP_CONFIG_PATH environment
+// variable or configs/properties.json. Defaults are used for values missing from the file.
+func NewConfig(configPath ...string) *Config {
+	var path string
+	if configPath == nil {
+		path = os.Getenv("DDD_AMQP_CONFIG_PATH")
+		if path == "" {
+			path = "configs/properties.json"
+		}
+	} else {
+		path = configPath[0]
+	}
+
+	config, err := ddd.Configuration[Config](path)
+	if err != nil {
+		config = &Config{}
+	}
+	return config.WithDefaults()
+}
+
+// WithDefaults returns a copy of the configuration with unset values filled with the defaults
+func (c *Config) WithDefaults() *Config {
+	config := *c
+	if config.Username == "" {
+		config.Username = "guest"
+	}
+	if config.Password == "" {
+		config.Password = "guest"
+	}
+	if config.Host == "" {
+		config.Host = "localhost"
+	}
+	if config.Port == 0 {
+		config.Port = 5672
+	}
+	if config.Prefetch <= 0 {
+		config.Prefetch = 10
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.RequeuePolicy == "" {
+		config.RequeuePolicy = RequeueOnce
+	}
+	if config.ConfirmTimeoutMs <= 0 {
+		config.ConfirmTimeoutMs = 5000
+	}
+	if config.ReconnectDelayMs <= 0 {
+		config.ReconnectDelayMs = 500
+	}
+	if config.MaxReconnectDelayMs < config.ReconnectDelayMs {
+		config.MaxReconnectDelayMs = 30000
+	}
+	if config.ShutdownTimeoutMs <= 0 {
+		config.ShutdownTimeoutMs = 5000
+	}
+	return &config
+}
+
+// URL returns the broker url
+func (c *Config) URL() string {
+	u := url.URL{
+		Scheme: "amqp",
+		User:   url.UserPassword(c.Username, c.Password),
+		Host:   fmt.Sprintf("%s:%d", c.Host, c.Port),
+		Path:   "/" + c.VirtualHost,
+	}
+	return u.String()
+}
+
+// reconnectPolicy returns the retry policy used between reconnection attempts
+func (c *Config) reconnectPolicy() ddd.RetryPolicy {
+	return ddd.RetryPolicy{
+		InitialBackoff: time.Duration(c.ReconnectDelayMs) * time.Millisecond,
+		MaxBackoff:     time.Duration(c.MaxReconnectDelayMs) * time.Millisecond,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
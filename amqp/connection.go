@@ -0,0 +1,154 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	ddd "github.com/paulvitic/ddd-go"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrStopped is returned when connecting through a connector that was stopped
+var ErrStopped = errors.New("amqp connector stopped")
+
+// Connection is the part of an amqp091 connection the adapters use, it lets tests replace the broker with a fake
+type Connection interface {
+	Channel() (Channel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	IsClosed() bool
+	Close() error
+}
+
+// Channel is the part of an amqp091 channel the adapters use, *amqp.Channel implements it
+type Channel interface {
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(returns chan amqp.Return) chan amqp.Return
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// Dialer opens a connection to the broker
+type Dialer func(url string) (Connection, error)
+
+// Dial connects to a broker with amqp091
+func Dial(url string) (Connection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return &connection{Connection: conn}, nil
+}
+
+// connection adapts *amqp.Connection to Connection
+type connection struct {
+	*amqp.Connection
+}
+
+func (c *connection) Channel() (Channel, error) {
+	return c.Connection.Channel()
+}
+
+// connector opens channels set up for a consumer or a publisher, reconnecting with backoff
+// until it succeeds or is stopped. Each channel comes with its own connection, closing the
+// channel closes the connection.
+type connector struct {
+	config *Config
+	dial   Dialer
+	logger *ddd.Logger
+	setup  func(ch Channel) error
+	stopCh chan struct{}
+	once   sync.Once
+}
+
+func newConnector(config *Config, dial Dialer, logger *ddd.Logger, setup func(ch Channel) error) *connector {
+	return &connector{
+		config: config,
+		dial:   dial,
+		logger: logger,
+		setup:  setup,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// connect returns a set up channel, retrying until it succeeds or the connector is stopped
+func (c *connector) connect() (*session, error) {
+	policy := c.config.reconnectPolicy()
+	for attempt := 1; ; attempt++ {
+		session, err := c.open()
+		if err == nil {
+			return session, nil
+		}
+
+		delay := policy.Backoff(attempt)
+		c.logger.Warn("failed to connect to amqp broker (attempt %d), retrying in %v: %v", attempt, delay, err)
+		select {
+		case <-c.stopCh:
+			return nil, ErrStopped
+		case <-time.After(delay):
+		}
+	}
+}
+
+// open makes a single attempt to open a set up channel
+func (c *connector) open() (*session, error) {
+	select {
+	case <-c.stopCh:
+		return nil, ErrStopped
+	default:
+	}
+
+	conn, err := c.dial(c.config.URL())
+	if err != nil {
+		return nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := c.setup(ch); err != nil {
+		ch.Close()
+		conn.Close()
+		return nil, err
+	}
+
+	return &session{
+		conn:   conn,
+		ch:     ch,
+		closed: ch.NotifyClose(make(chan *amqp.Error, 1)),
+	}, nil
+}
+
+// stop interrupts reconnection attempts
+func (c *connector) stop() {
+	c.once.Do(func() { close(c.stopCh) })
+}
+
+// stopped returns a channel closed when the connector stops
+func (c *connector) stopped() <-chan struct{} {
+	return c.stopCh
+}
+
+// session is an open channel and its connection
+type session struct {
+	conn   Connection
+	ch     Channel
+	closed chan *amqp.Error
+}
+
+func (s *session) close() {
+	s.ch.Close()
+	if !s.conn.IsClosed() {
+		s.conn.Close()
+	}
+}
@@ -0,0 +1,279 @@
+package amqp
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	ddd "github.com/paulvitic/ddd-go"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Consumer is a MessageConsumer reading a queue of an AMQP broker. Messages are acknowledged once
+// processed and rejected according to the requeue policy when processing fails; errors marked with
+// ddd.Fatal are never requeued. The consumer reconnects and declares its topology again whenever
+// the connection or channel is lost.
+type Consumer struct {
+	ddd.MessageConsumer
+	translator ddd.MessageTranslator
+	registry   *ddd.TranslatorRegistry
+	inbox      ddd.Inbox
+	messageID  ddd.MessageIDExtractor
+	config     *Config
+	dial       Dialer
+	logger     *ddd.Logger
+	tag        string
+	connector  *connector
+	session    *session
+	// ctx is the context of the messages being processed, cancelled when the consumer stops
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+}
+
+// NewConsumer creates a consumer of the configured queue translating messages with the given translator
+func NewConsumer(config *Config, translator ddd.MessageTranslator) *Consumer {
+	config = config.WithDefaults()
+	return &Consumer{
+		MessageConsumer: ddd.NewBaseMessageConsumer(config.Queue, translator),
+		translator:      translator,
+		config:          config,
+		dial:            Dial,
+		logger:          ddd.NewLogger(),
+		tag:             config.Queue + "-" + ddd.GenerateUUID().String(),
+	}
+}
+
+// WithDialer replaces the function connecting to the broker, it must be set before the consumer starts
+func (c *Consumer) WithDialer(dial Dialer) *Consumer {
+	c.dial = dial
+	return c
+}
+
+// WithTranslatorRegistry routes messages to the translators of a registry instead of the single translator.
+// Message headers and the type attribute are available to its discriminator.
+func (c *Consumer) WithTranslatorRegistry(registry *ddd.TranslatorRegistry) *Consumer {
+	c.registry = registry
+	c.MessageConsumer = c.newBase()
+	return c
+}
+
+// WithInbox acknowledges redelivered messages already processed according to the inbox without dispatching them again.
+// Message headers are available to the extractor, along with the message id property as the message-id header.
+func (c *Consumer) WithInbox(inbox ddd.Inbox, extractor ddd.MessageIDExtractor) *Consumer {
+	c.inbox, c.messageID = inbox, extractor
+	c.MessageConsumer = c.newBase()
+	return c
+}
+
+// newBase creates the base consumer with the translation and deduplication settings
+func (c *Consumer) newBase() ddd.MessageConsumer {
+	base := ddd.NewBaseMessageConsumer(c.config.Queue, c.translator)
+	if c.registry != nil {
+		base.WithTranslatorRegistry(c.registry)
+	}
+	if c.inbox != nil {
+		base.WithInbox(c.inbox, c.messageID)
+	}
+	return base
+}
+
+// OnStart connects to the broker in the background and starts consuming
+func (c *Consumer) OnStart() error {
+	if c.Running() {
+		return nil // Already running
+	}
+	if err := c.MessageConsumer.OnStart(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.connector = newConnector(c.config, c.dial, c.logger, c.setup)
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go c.run()
+
+	c.logger.Info("Started amqp message consumer for queue %s", c.Target())
+	return nil
+}
+
+// OnDestroy cancels the consumption, waits for the messages being processed and disconnects. Messages
+// still processed after the shutdown timeout have their context cancelled.
+func (c *Consumer) OnDestroy() error {
+	if !c.Running() {
+		return nil // Already stopped
+	}
+
+	// A session opened after the connector stopped is closed by run, it is never consumed
+	c.mu.Lock()
+	c.connector.stop()
+	if c.session != nil {
+		// Deliveries close once cancelled, in flight messages are still acknowledged
+		if err := c.session.ch.Cancel(c.tag, false); err != nil {
+			c.session.close()
+		}
+	}
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Duration(c.config.ShutdownTimeoutMs) * time.Millisecond):
+		c.logger.Warn("Cancelling the messages still processed from queue %s", c.Target())
+		c.cancel()
+		<-done
+	}
+	// The context of the messages ends with the consumer
+	c.cancel()
+
+	if err := c.MessageConsumer.OnDestroy(); err != nil {
+		return err
+	}
+	c.logger.Info("Stopped amqp message consumer for queue %s", c.Target())
+	return nil
+}
+
+// setup prepares a new channel for consumption
+func (c *Consumer) setup(ch Channel) error {
+	if err := c.config.Topology.Declare(ch); err != nil {
+		return err
+	}
+	return ch.Qos(c.config.Prefetch, 0, false)
+}
+
+// run consumes until stopped, reconnecting whenever the deliveries stop
+func (c *Consumer) run() {
+	defer c.wg.Done()
+
+	for {
+		session, err := c.connector.connect()
+		if err != nil {
+			return // Stopped
+		}
+
+		deliveries, err := session.ch.Consume(c.config.Queue, c.tag, false, false, false, false, nil)
+		if err != nil {
+			c.logger.Error("Failed to consume queue %s: %v", c.config.Queue, err)
+			session.close()
+			continue
+		}
+
+		// OnDestroy either cancels the consumption of this session or stopped the connector before
+		c.mu.Lock()
+		select {
+		case <-c.connector.stopped():
+			c.mu.Unlock()
+			session.close()
+			return
+		default:
+		}
+		c.session = session
+		c.mu.Unlock()
+
+		c.consume(deliveries)
+
+		c.mu.Lock()
+		c.session = nil
+		c.mu.Unlock()
+		session.close()
+
+		select {
+		case <-c.connector.stopped():
+			return
+		default:
+			c.logger.Warn("Lost amqp channel of queue %s, reconnecting", c.config.Queue)
+		}
+	}
+}
+
+// consume processes deliveries with the configured concurrency until the deliveries channel closes
+func (c *Consumer) consume(deliveries <-chan amqp.Delivery) {
+	var workers sync.WaitGroup
+	for range c.config.Concurrency {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for delivery := range deliveries {
+				c.handle(delivery)
+			}
+		}()
+	}
+	workers.Wait()
+}
+
+// handle processes a delivery and settles it
+func (c *Consumer) handle(delivery amqp.Delivery) {
+	err := c.process(delivery)
+	if err == nil {
+		if ackErr := delivery.Ack(false); ackErr != nil {
+			c.logger.Error("Failed to acknowledge message %d: %v", delivery.DeliveryTag, ackErr)
+		}
+		return
+	}
+
+	requeue := c.config.RequeuePolicy.requeue(err, delivery.Redelivered)
+	c.logger.Error("Failed to process message %d from queue %s (requeue: %t): %v", delivery.DeliveryTag, c.Target(), requeue, err)
+	if nackErr := delivery.Nack(false, requeue); nackErr != nil {
+		c.logger.Error("Failed to reject message %d: %v", delivery.DeliveryTag, nackErr)
+	}
+}
+
+// process hands a message to the consumer, turning a panic into an error
+func (c *Consumer) process(delivery amqp.Delivery) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &ddd.PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	ctx := context.WithValue(c.ctx, ddd.MessageSourceKey{}, c.Target())
+	messageHeaders := headers(delivery.Headers)
+	if delivery.MessageId != "" {
+		messageHeaders[MessageIDHeader] = delivery.MessageId
+	}
+	ctx = ddd.WithMessageHeaders(ctx, messageHeaders)
+	ctx = ddd.WithMessageType(ctx, delivery.Type)
+	return c.ProcessMessage(ctx, delivery.Body)
+}
+
+// MessageIDHeader is the header carrying the message id property of a delivery, see ddd.HeaderMessageID
+const MessageIDHeader = "message-id"
+
+// headers converts AMQP headers to strings
+func headers(table amqp.Table) map[string]string {
+	result := make(map[string]string, len(table))
+	for name, value := range table {
+		switch value := value.(type) {
+		case string:
+			result[name] = value
+		case []byte:
+			result[name] = string(value)
+		default:
+			result[name] = fmt.Sprint(value)
+		}
+	}
+	return result
+}
+
+// requeue tells whether a message that failed with the given error goes back to its queue
+func (p RequeuePolicy) requeue(err error, redelivered bool) bool {
+	if !ddd.IsRetryable(err) {
+		return false
+	}
+	switch p {
+	case RequeueAlways:
+		return true
+	case RequeueOnce:
+		return !redelivered
+	default:
+		return false
+	}
+}
@@ -0,0 +1,224 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ddd "github.com/paulvitic/ddd-go"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrNotConfirmed is returned when the broker refused a message or did not confirm it in time
+var ErrNotConfirmed = errors.New("message not confirmed by the broker")
+
+// ErrUnroutable is returned when the broker returned a message no queue is bound to receive
+var ErrUnroutable = errors.New("message not routed to any queue")
+
+// RoutingKey gives the routing key an event is published with
+type RoutingKey func(event ddd.Event) string
+
+// EventTypeRoutingKey routes events by their type
+func EventTypeRoutingKey(event ddd.Event) string {
+	return event.Type()
+}
+
+// Publisher is a MessagePublisher sending persistent messages to the configured exchange with
+// publisher confirms: Publish returns once the broker confirmed the message. Messages are mandatory,
+// one that no queue receives is returned by the broker and fails with ErrUnroutable. The connection is
+// opened on start and reopened on the next publish after it was lost, a publish failing meanwhile
+// returns an error for the caller, typically an outbox relay, to retry.
+type Publisher struct {
+	config     *Config
+	encoder    ddd.MessageEncoder
+	routingKey RoutingKey
+	dial       Dialer
+	logger     *ddd.Logger
+	connector  *connector
+	session    *session
+	confirms   chan amqp.Confirmation
+	returns    chan amqp.Return
+	running    atomic.Bool
+	mu         sync.Mutex
+}
+
+// NewPublisher creates a publisher to the configured exchange, events are encoded in json when no encoder is given
+func NewPublisher(config *Config, encoder ddd.MessageEncoder) *Publisher {
+	if encoder == nil {
+		encoder = ddd.JsonMessageEncoder
+	}
+	return &Publisher{
+		config:     config.WithDefaults(),
+		encoder:    encoder,
+		routingKey: EventTypeRoutingKey,
+		dial:       Dial,
+		logger:     ddd.NewLogger(),
+	}
+}
+
+// WithDialer replaces the function connecting to the broker, it must be set before the publisher starts
+func (p *Publisher) WithDialer(dial Dialer) *Publisher {
+	p.dial = dial
+	return p
+}
+
+// WithRoutingKey replaces the routing key of published events, which is the event type by default
+func (p *Publisher) WithRoutingKey(routingKey RoutingKey) *Publisher {
+	p.routingKey = routingKey
+	return p
+}
+
+// Target returns the exchange the publisher sends to
+func (p *Publisher) Target() string {
+	return p.config.Exchange
+}
+
+// Running returns whether the publisher is currently active
+func (p *Publisher) Running() bool {
+	return p.running.Load()
+}
+
+// OnStart connects to the broker, a failed connection is retried on the first publish
+func (p *Publisher) OnStart() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Running() {
+		return nil // Already running
+	}
+
+	p.connector = newConnector(p.config, p.dial, p.logger, p.setup)
+	p.running.Store(true)
+
+	if err := p.reconnect(); err != nil {
+		p.logger.Warn("amqp publisher for exchange %s could not connect yet: %v", p.Target(), err)
+	}
+
+	p.logger.Info("Started amqp message publisher for exchange %s", p.Target())
+	return nil
+}
+
+// OnDestroy disconnects from the broker
+func (p *Publisher) OnDestroy() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.Running() {
+		return nil // Already stopped
+	}
+
+	p.running.Store(false)
+	p.connector.stop()
+	p.disconnect()
+
+	p.logger.Info("Stopped amqp message publisher for exchange %s", p.Target())
+	return nil
+}
+
+// Publish sends an event and waits for the broker confirmation, an unroutable event fails with ErrUnroutable
+func (p *Publisher) Publish(event ddd.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.Running() {
+		return ddd.ErrMessagePublisherNotRunning
+	}
+
+	body, err := p.encoder(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %s: %w", event.Type(), err)
+	}
+
+	if p.lost() {
+		if err := p.reconnect(); err != nil {
+			return fmt.Errorf("failed to connect to amqp broker: %w", err)
+		}
+	}
+
+	timeout := time.Duration(p.config.ConfirmTimeoutMs) * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	msg := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Type:         event.Type(),
+		Timestamp:    event.TimeStamp(),
+		Body:         body,
+	}
+	if err := p.session.ch.PublishWithContext(ctx, p.config.Exchange, p.routingKey(event), true, false, msg); err != nil {
+		p.disconnect()
+		return fmt.Errorf("failed to publish event %s: %w", event.Type(), err)
+	}
+
+	select {
+	case confirmation, ok := <-p.confirms:
+		if !ok {
+			p.disconnect()
+			return fmt.Errorf("%w: channel closed", ErrNotConfirmed)
+		}
+		if !confirmation.Ack {
+			return fmt.Errorf("%w: event %s was nacked", ErrNotConfirmed, event.Type())
+		}
+		// The broker returns an unroutable message before confirming it
+		select {
+		case returned, ok := <-p.returns:
+			if ok {
+				return fmt.Errorf("%w: event %s returned by exchange %s: %s", ErrUnroutable, event.Type(), returned.Exchange, returned.ReplyText)
+			}
+		default:
+		}
+		return nil
+	case <-ctx.Done():
+		// A late confirmation would be taken for the next message's, start over with a new channel
+		p.disconnect()
+		return fmt.Errorf("%w: event %s not confirmed within %v", ErrNotConfirmed, event.Type(), timeout)
+	}
+}
+
+// setup prepares a new channel for confirmed publication
+func (p *Publisher) setup(ch Channel) error {
+	if err := p.config.Topology.Declare(ch); err != nil {
+		return err
+	}
+	return ch.Confirm(false)
+}
+
+// reconnect replaces the session with a new one, making a single connection attempt
+func (p *Publisher) reconnect() error {
+	p.disconnect()
+
+	session, err := p.connector.open()
+	if err != nil {
+		return err
+	}
+	p.session = session
+	p.confirms = session.ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	p.returns = session.ch.NotifyReturn(make(chan amqp.Return, 1))
+	return nil
+}
+
+// lost tells whether there is no usable session
+func (p *Publisher) lost() bool {
+	if p.session == nil {
+		return true
+	}
+	select {
+	case <-p.session.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Publisher) disconnect() {
+	if p.session != nil {
+		p.session.close()
+		p.session = nil
+		p.confirms = nil
+		p.returns = nil
+	}
+}
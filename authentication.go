@@ -0,0 +1,504 @@
+package ddd
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrNoCredentials is returned by an authenticator when a request carries none of its credentials,
+// the next authenticator is tried
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator is a resource stereotype identifying the principal of requests. Authenticators of a context
+// are tried in declaration order on every request of the context, the first one finding its credentials in a
+// request decides: invalid credentials are answered with 401, valid ones put the principal in the request
+// context. Requests without credentials are anonymous, routes decide whether they require a principal.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Challenger is implemented by authenticators telling clients how to authenticate, in the
+// WWW-Authenticate header of 401 responses
+type Challenger interface {
+	Challenge() string
+}
+
+// AuthenticationMiddleware identifies the principal of requests with the given authenticators,
+// contexts apply it with their Authenticator resources
+func AuthenticationMiddleware(authenticators ...Authenticator) HttpMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, authenticator := range authenticators {
+				principal, err := authenticator.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if err == nil && principal == nil {
+					err = Unauthorized("invalid credentials")
+				}
+				if err != nil {
+					if !errors.Is(err, ErrUnauthorized) {
+						err = &DomainError{Kind: ErrUnauthorized, Detail: err.Error()}
+					}
+					challenge(w, authenticators)
+					writeError(w, r, errorMapperOf(GetContext(r)), err)
+					return
+				}
+				r = r.WithContext(WithPrincipal(r.Context(), principal))
+				break
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// challenge sets the WWW-Authenticate header of a 401 response
+func challenge(w http.ResponseWriter, authenticators []Authenticator) {
+	for _, authenticator := range authenticators {
+		if challenger, ok := authenticator.(Challenger); ok {
+			w.Header().Add("WWW-Authenticate", challenger.Challenge())
+		}
+	}
+}
+
+// ApiKeyAuthenticator authenticates requests with a key in a header. Keys are held as digests.
+type ApiKeyAuthenticator struct {
+	header string
+	keys   map[string]*Principal
+}
+
+// NewApiKeyAuthenticator authenticates the principals of the keys given in a header, X-Api-Key by default
+func NewApiKeyAuthenticator(header string, keys map[string]*Principal) *ApiKeyAuthenticator {
+	digests := make(map[string]*Principal, len(keys))
+	for key, principal := range keys {
+		digests[apiKeyDigest(key)] = principal
+	}
+	return &ApiKeyAuthenticator{header: valueOr(header, "X-Api-Key"), keys: digests}
+}
+
+func (a *ApiKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(a.header)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	principal, ok := a.keys[apiKeyDigest(key)]
+	if !ok {
+		return nil, Unauthorized("invalid api key")
+	}
+	authenticated := *principal
+	authenticated.Method = "apiKey"
+	return &authenticated, nil
+}
+
+// Header returns the header carrying the keys
+func (a *ApiKeyAuthenticator) Header() string {
+	return a.header
+}
+
+func apiKeyDigest(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:])
+}
+
+// BasicAuthenticator authenticates requests with basic credentials checked by a function
+type BasicAuthenticator struct {
+	realm  string
+	verify func(username string, password string) (*Principal, error)
+}
+
+// NewBasicAuthenticator authenticates basic credentials, verify returns nil for invalid ones
+func NewBasicAuthenticator(realm string, verify func(username string, password string) (*Principal, error)) *BasicAuthenticator {
+	return &BasicAuthenticator{realm: realm, verify: verify}
+}
+
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	principal, err := a.verify(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if principal == nil {
+		return nil, Unauthorized("invalid username or password")
+	}
+	authenticated := *principal
+	authenticated.Method = "basic"
+	return &authenticated, nil
+}
+
+func (a *BasicAuthenticator) Challenge() string {
+	return fmt.Sprintf("Basic realm=%q", valueOr(a.realm, "api"))
+}
+
+// JwtConfig configures the verification of bearer tokens. Tokens are verified with a shared secret, with the
+// public key of a PEM file, or with the keys of a JWKS file picked by the key id of the token. Algorithms
+// default to those of the configured keys. Roles and permissions are read from the configured claims, given
+// as arrays or space separated strings, and the scopes of the scope claim are permissions as well.
+type JwtConfig struct {
+	Secret           string   `json:"jwtSecret"`
+	KeyFile          string   `json:"jwtKeyFile"`
+	JwksFile         string   `json:"jwtJwksFile"`
+	Issuer           string   `json:"jwtIssuer"`
+	Audience         string   `json:"jwtAudience"`
+	Algorithms       []string `json:"jwtAlgorithms"`
+	RolesClaim       string   `json:"jwtRolesClaim"`
+	PermissionsClaim string   `json:"jwtPermissionsClaim"`
+	LeewaySeconds    int      `json:"jwtLeewaySeconds"`
+}
+
+// NewJwtConfig loads the token verification settings from a json configuration file
+func NewJwtConfig(configPath ...string) *JwtConfig {
+	var path string
+	if configPath == nil {
+		path = os.Getenv("DDD_JWT_CONFIG_PATH")
+		if path == "" {
+			path = "configs/properties.json"
+		}
+	} else {
+		path = configPath[0]
+	}
+	config, err := Configuration[JwtConfig](path)
+	if err != nil {
+		panic(err)
+	}
+	return config
+}
+
+// JwtAuthenticator authenticates requests with a bearer JSON web token signed with HMAC, RSA or ECDSA
+type JwtAuthenticator struct {
+	config *JwtConfig
+	parser *jwt.Parser
+	secret []byte
+	key    crypto.PublicKey
+	jwks   *jwksFile
+}
+
+// NewJwtAuthenticator creates an authenticator verifying tokens with the configured keys
+func NewJwtAuthenticator(config *JwtConfig) (*JwtAuthenticator, error) {
+	authenticator := &JwtAuthenticator{config: config}
+	if config.Secret != "" {
+		authenticator.secret = []byte(config.Secret)
+	}
+	if config.KeyFile != "" {
+		key, err := readPublicKey(config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticator.key = key
+	}
+	if config.JwksFile != "" {
+		authenticator.jwks = &jwksFile{path: config.JwksFile}
+		if err := authenticator.jwks.load(); err != nil {
+			return nil, err
+		}
+	}
+	if authenticator.secret == nil && authenticator.key == nil && authenticator.jwks == nil {
+		return nil, errors.New("jwt authenticator needs a secret, a key file or a jwks file")
+	}
+
+	algorithms := config.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = authenticator.algorithms()
+	}
+	options := []jwt.ParserOption{jwt.WithValidMethods(algorithms), jwt.WithLeeway(time.Duration(config.LeewaySeconds) * time.Second)}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+	authenticator.parser = jwt.NewParser(options...)
+	return authenticator, nil
+}
+
+// algorithms returns the signing algorithms of the configured keys
+func (a *JwtAuthenticator) algorithms() []string {
+	algorithms := make([]string, 0)
+	if a.secret != nil {
+		algorithms = append(algorithms, "HS256", "HS384", "HS512")
+	}
+	keys := []any{a.key}
+	if a.jwks != nil {
+		keys = append(keys, a.jwks.all()...)
+	}
+	var rsaKeys, ecKeys, hmacKeys bool
+	for _, key := range keys {
+		switch key.(type) {
+		case *rsa.PublicKey:
+			rsaKeys = true
+		case *ecdsa.PublicKey:
+			ecKeys = true
+		case []byte:
+			hmacKeys = true
+		}
+	}
+	if hmacKeys && a.secret == nil {
+		algorithms = append(algorithms, "HS256", "HS384", "HS512")
+	}
+	if rsaKeys {
+		algorithms = append(algorithms, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512")
+	}
+	if ecKeys {
+		algorithms = append(algorithms, "ES256", "ES384", "ES512")
+	}
+	return algorithms
+}
+
+func (a *JwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	scheme, raw, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := a.parser.ParseWithClaims(strings.TrimSpace(raw), claims, a.verificationKey); err != nil {
+		return nil, Unauthorized(fmt.Sprintf("invalid token: %v", err))
+	}
+
+	principal := &Principal{Claims: claims, Method: "jwt"}
+	principal.ID, _ = claims["sub"].(string)
+	if principal.ID == "" {
+		return nil, Unauthorized("invalid token: token has no subject")
+	}
+	principal.Name, _ = claims["name"].(string)
+	if principal.Name == "" {
+		principal.Name, _ = claims["preferred_username"].(string)
+	}
+	principal.Roles = claimValues(claims[valueOr(a.config.RolesClaim, "roles")])
+	principal.Permissions = claimValues(claims[valueOr(a.config.PermissionsClaim, "permissions")])
+	principal.Permissions = append(principal.Permissions, claimValues(claims["scope"])...)
+	return principal, nil
+}
+
+func (a *JwtAuthenticator) Challenge() string {
+	return "Bearer"
+}
+
+// verificationKey returns the key verifying a token, of the family of its algorithm
+func (a *JwtAuthenticator) verificationKey(token *jwt.Token) (any, error) {
+	if _, hmac := token.Method.(*jwt.SigningMethodHMAC); hmac && a.secret != nil {
+		return a.secret, nil
+	}
+	if a.jwks != nil {
+		if kid, ok := token.Header["kid"].(string); ok {
+			if key := a.jwks.key(kid); key != nil {
+				return key, nil
+			}
+			return nil, fmt.Errorf("unknown key id %s", kid)
+		}
+	}
+	if a.key != nil {
+		return a.key, nil
+	}
+	return nil, errors.New("no key for the token")
+}
+
+// claimValues reads a claim given as an array or a space separated string
+func claimValues(claim any) []string {
+	switch claim := claim.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []any:
+		values := make([]string, 0, len(claim))
+		for _, value := range claim {
+			if value, ok := value.(string); ok {
+				values = append(values, value)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// readPublicKey reads an RSA or ECDSA public key, or the key of a certificate, from a PEM file
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key file %s is not PEM encoded", path)
+	}
+
+	var key any
+	switch block.Type {
+	case "CERTIFICATE":
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate in %s: %w", path, err)
+		}
+		key = certificate.PublicKey
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key in %s: %w", path, err)
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T in %s", key, path)
+	}
+}
+
+// jwksFile holds the keys of a JWKS file, read again when a token names a key it does not know
+type jwksFile struct {
+	path     string
+	keys     map[string]any
+	modified time.Time
+	mu       sync.RWMutex
+}
+
+// jsonWebKey is a key of a JWKS document
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func (f *jwksFile) key(kid string) any {
+	f.mu.RLock()
+	key, ok := f.keys[kid]
+	f.mu.RUnlock()
+	if ok {
+		return key
+	}
+
+	// The keys may have been rotated
+	if info, err := os.Stat(f.path); err == nil && info.ModTime().After(f.modified) {
+		f.load()
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.keys[kid]
+}
+
+func (f *jwksFile) all() []any {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	keys := make([]any, 0, len(f.keys))
+	for _, key := range f.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (f *jwksFile) load() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read jwks file: %w", err)
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read jwks file: %w", err)
+	}
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("invalid jwks file %s: %w", f.path, err)
+	}
+
+	keys := make(map[string]any, len(document.Keys))
+	for _, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return fmt.Errorf("invalid key %s in %s: %w", jwk.Kid, f.path, err)
+		}
+		keys[jwk.Kid] = key
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys, f.modified = keys, info.ModTime()
+	return nil
+}
+
+// publicKey decodes the verification key of a JWK
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64BigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64BigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64BigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64BigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if _, err := key.ECDH(); err != nil {
+			return nil, err
+		}
+		return key, nil
+
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func base64BigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
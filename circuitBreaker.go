@@ -0,0 +1,68 @@
+package ddd
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of calling a handler whose circuit breaker tripped
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// circuitBreaker stops calling an event handler that keeps panicking.
+// It opens after threshold consecutive panics and lets a single trial call through
+// once the cooldown elapsed; the trial closes the breaker again unless it panics.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	panics    int
+	openUntil time.Time
+	trial     bool
+	mu        sync.Mutex
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow tells whether the handler may be called
+func (c *circuitBreaker) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.panics < c.threshold {
+		return true
+	}
+
+	// Open: only one trial call once the cooldown elapsed
+	if c.trial || time.Now().Before(c.openUntil) {
+		return false
+	}
+	c.trial = true
+	return true
+}
+
+// record updates the breaker with the outcome of a call
+func (c *circuitBreaker) record(err error) (tripped bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.trial = false
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		// Any call that did not panic closes the breaker
+		c.panics = 0
+		return false
+	}
+
+	c.panics++
+	if c.panics >= c.threshold {
+		c.openUntil = time.Now().Add(c.cooldown)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package ddd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedMediaType is returned when no decoder reads the content type of a request body
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	// ErrNotAcceptable is returned when no encoder writes a media type a request accepts
+	ErrNotAcceptable = errors.New("not acceptable")
+)
+
+// maxFormMemory is the part of a multipart form held in memory, the rest is stored in temporary files
+const maxFormMemory = 32 << 20
+
+// BodyDecoder decodes the body of a request into the request value of a typed handler
+type BodyDecoder func(r *http.Request, target any) error
+
+// BodyEncoder encodes the response of a typed handler
+type BodyEncoder func(w io.Writer, body any) error
+
+// Codecs decode the bodies of requests by their Content-Type and encode responses in the media type their
+// Accept header prefers. Codecs registered as a resource of a context replace the default ones for its
+// endpoints.
+type Codecs struct {
+	decoders map[string]BodyDecoder
+	encoders []mediaEncoder
+}
+
+type mediaEncoder struct {
+	mediaType string
+	encode    BodyEncoder
+}
+
+// NewCodecs creates codecs decoding json, xml and form bodies and encoding json and xml responses, json being
+// preferred. Form fields are bound to the request fields named by their form tags.
+func NewCodecs() *Codecs {
+	return (&Codecs{decoders: make(map[string]BodyDecoder)}).
+		WithDecoder("application/json", decodeJson).
+		WithDecoder("application/xml", decodeXml).
+		WithDecoder("text/xml", decodeXml).
+		WithDecoder("application/x-www-form-urlencoded", decodeForm).
+		WithDecoder("multipart/form-data", decodeForm).
+		WithEncoder("application/json", encodeJson).
+		WithEncoder("application/xml", encodeXml).
+		WithEncoder("text/xml", encodeXml)
+}
+
+// WithDecoder sets the decoder of a content type
+func (c *Codecs) WithDecoder(mediaType string, decoder BodyDecoder) *Codecs {
+	c.decoders[strings.ToLower(mediaType)] = decoder
+	return c
+}
+
+// WithEncoder sets the encoder of a media type, the encoders set first are preferred
+func (c *Codecs) WithEncoder(mediaType string, encoder BodyEncoder) *Codecs {
+	mediaType = strings.ToLower(mediaType)
+	for i := range c.encoders {
+		if c.encoders[i].mediaType == mediaType {
+			c.encoders[i].encode = encoder
+			return c
+		}
+	}
+	c.encoders = append(c.encoders, mediaEncoder{mediaType: mediaType, encode: encoder})
+	return c
+}
+
+// decoder returns the decoder of the content type of a request, json when the request names none. Types
+// with a structured syntax suffix, such as application/merge-patch+json, fall back to the decoder of the
+// suffix.
+func (c *Codecs) decoder(r *http.Request) (BodyDecoder, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return c.decoders["application/json"], nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, contentType)
+	}
+	if decoder, ok := c.decoders[mediaType]; ok {
+		return decoder, nil
+	}
+	if _, suffix, ok := strings.Cut(mediaType, "+"); ok {
+		if decoder, ok := c.decoders["application/"+suffix]; ok {
+			return decoder, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+}
+
+// negotiate returns the media type and the encoder a request prefers, the first encoder when the request
+// accepts any media type
+func (c *Codecs) negotiate(r *http.Request) (string, BodyEncoder, error) {
+	if len(c.encoders) == 0 {
+		return "", nil, fmt.Errorf("%w: no response encoders", ErrNotAcceptable)
+	}
+	ranges := acceptedRanges(r.Header.Values("Accept"))
+	if len(ranges) == 0 {
+		return c.encoders[0].mediaType, c.encoders[0].encode, nil
+	}
+
+	var best *mediaEncoder
+	bestQuality := 0.0
+	for i, encoder := range c.encoders {
+		if quality := encoder.quality(ranges); quality > bestQuality {
+			best, bestQuality = &c.encoders[i], quality
+		}
+	}
+	if best == nil {
+		available := make([]string, len(c.encoders))
+		for i, encoder := range c.encoders {
+			available[i] = encoder.mediaType
+		}
+		return "", nil, fmt.Errorf("%w: responses are available as %s", ErrNotAcceptable, strings.Join(available, ", "))
+	}
+	return best.mediaType, best.encode, nil
+}
+
+// mediaRange is a media range of an Accept header with its quality
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// acceptedRanges parses the media ranges of Accept headers, skipping invalid ones
+func acceptedRanges(headers []string) []mediaRange {
+	ranges := make([]mediaRange, 0)
+	for _, header := range headers {
+		for _, part := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			quality := 1.0
+			if q, ok := params["q"]; ok {
+				if quality, err = strconv.ParseFloat(q, 64); err != nil {
+					continue
+				}
+			}
+			ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+		}
+	}
+	return ranges
+}
+
+// quality returns the quality of the most specific media range matching the media type of the encoder
+func (e mediaEncoder) quality(ranges []mediaRange) float64 {
+	typ, _, _ := strings.Cut(e.mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, accepted := range ranges {
+		var matched int
+		switch accepted.mediaType {
+		case e.mediaType:
+			matched = 2
+		case typ + "/*":
+			matched = 1
+		case "*/*":
+			matched = 0
+		default:
+			continue
+		}
+		if matched > specificity {
+			quality, specificity = accepted.quality, matched
+		}
+	}
+	return quality
+}
+
+func decodeJson(r *http.Request, target any) error {
+	if err := json.NewDecoder(r.Body).Decode(target); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func decodeXml(r *http.Request, target any) error {
+	if err := xml.NewDecoder(r.Body).Decode(target); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// decodeForm parses the form of a request, its fields are bound with the other parameters of the request
+func decodeForm(r *http.Request, target any) error {
+	if err := r.ParseMultipartForm(maxFormMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return err
+	}
+	return nil
+}
+
+func encodeJson(w io.Writer, body any) error {
+	return json.NewEncoder(w).Encode(body)
+}
+
+func encodeXml(w io.Writer, body any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,148 @@
+package ddd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrVersionConflict is returned by repositories storing an aggregate that is not at the version it is
+// expected at, because it changed since it was loaded or since the client read it
+var ErrVersionConflict = errors.New("version conflict")
+
+// Versioned is implemented by aggregates and other values tagged by their version in responses
+type Versioned interface {
+	Version() int
+}
+
+// ETagged is implemented by values choosing the entity tag of their responses
+type ETagged interface {
+	ETag() string
+}
+
+// VersionConflict creates the error of an aggregate expected at its version but stored at another
+func VersionConflict(aggregate Aggregate, stored int) error {
+	return &DomainError{Kind: ErrVersionConflict, Detail: fmt.Sprintf("%s %s is at version %d, not %d",
+		shortName(aggregate.AggregateType()), aggregate.ID(), stored, aggregate.Version())}
+}
+
+// CheckVersion is the optimistic concurrency check of repositories: it fails with a VersionConflict when an
+// aggregate is not at its stored version. Repositories check it before storing an aggregate, then set the
+// next version on it.
+func CheckVersion(aggregate Aggregate, stored int) error {
+	if aggregate.Version() != stored {
+		return VersionConflict(aggregate, stored)
+	}
+	return nil
+}
+
+// VersionETag returns the entity tag of a version. It is weak, the representations of a version in each
+// media type sharing it.
+func VersionETag(version int) string {
+	return fmt.Sprintf(`W/"%d"`, version)
+}
+
+// parseVersionETag returns the version an entity tag names
+func parseVersionETag(tag string) (int, bool) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil {
+		return 0, false
+	}
+	version, err := strconv.Atoi(unquoted)
+	return version, err == nil
+}
+
+// hashETag returns the entity tag of an encoded response body
+func hashETag(body []byte) string {
+	digest := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(digest[:16]) + `"`
+}
+
+// entityTags splits the entity tags of an If-Match or If-None-Match header
+func entityTags(header http.Header, name string) []string {
+	tags := make([]string, 0)
+	for _, value := range header.Values(name) {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// noneMatch tells whether an entity tag matches none of the tags of an If-None-Match header, comparing
+// them weakly
+func noneMatch(tags []string, etag string) bool {
+	for _, tag := range tags {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return false
+		}
+	}
+	return true
+}
+
+type ifMatchKey struct{}
+
+// withIfMatch returns a request whose context carries the entity tags of its If-Match header
+func withIfMatch(r *http.Request) *http.Request {
+	tags := entityTags(r.Header, "If-Match")
+	if len(tags) == 0 {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), ifMatchKey{}, tags))
+}
+
+// ExpectVersion checks that an aggregate is at one of the versions named by the If-Match header of the request
+// of a context, so that a client does not modify an aggregate changed since it read it. It fails with
+// ErrPreconditionFailed, a 412 response, when the aggregate is at another version or the entity tags name no
+// version, and leaves the aggregate unchanged. Without an If-Match header, or with If-Match: *, any version is
+// expected. Changes made after the aggregate was loaded fail the optimistic concurrency check of the repository.
+func ExpectVersion(ctx context.Context, aggregate Aggregate) error {
+	tags, _ := ctx.Value(ifMatchKey{}).([]string)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	named := false
+	for _, tag := range tags {
+		if tag == "*" {
+			return nil
+		}
+		if version, ok := parseVersionETag(tag); ok {
+			if version == aggregate.Version() {
+				return nil
+			}
+			named = true
+		}
+	}
+	if !named {
+		return PreconditionFailed("If-Match names no version")
+	}
+	return PreconditionFailed(fmt.Sprintf("%s %s is at version %d", shortName(aggregate.AggregateType()),
+		aggregate.ID(), aggregate.Version()))
+}
+
+// entityTag returns the entity tag of the response to a typed handler: the tag the handler set, the tag of
+// a body choosing its own or a versioned body, or the hash of the encoded body of responses to GET requests
+func entityTag(r *http.Request, header http.Header, body any, encoded []byte) string {
+	if etag := header.Get("ETag"); etag != "" {
+		return etag
+	}
+	switch tagged := body.(type) {
+	case ETagged:
+		return tagged.ETag()
+	case Versioned:
+		return VersionETag(tagged.Version())
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return hashETag(encoded)
+	}
+	return ""
+}
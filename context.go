@@ -2,9 +2,11 @@ package ddd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 
@@ -25,6 +27,15 @@ type Context struct {
 	router    *mux.Router
 	eventBus  *EventBus
 	resources map[reflect.Type]map[string]*resource
+	declared  int
+	initErr   error
+	// middleware of the resources wrapping the routes of the context, chained once per route
+	middleware []HttpMiddleware
+	chains     sync.Map
+	// outbox relays of the context, they stop before the event bus they publish to. Relays are
+	// created by resource factories while the context is locked, they have their own lock.
+	relays    []*OutboxRelay
+	relaysMu  sync.Mutex
 	resolving sync.Map
 	mu        sync.RWMutex
 }
@@ -42,14 +53,11 @@ func NewContext(parentCtx context.Context, router *mux.Router, name string) *Con
 
 	ctxRouter := router.PathPrefix("/" + newCtx.name).Subrouter()
 	// Apply middleware to inject context into ALL routes
-	ctxRouter.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			reqCtx := context.WithValue(r.Context(), AppContextKey, newCtx)
-			r = r.WithContext(reqCtx)
-			// Call next handler
-			next.ServeHTTP(w, r)
-		})
-	})
+	ctxRouter.Use(newCtx.wrap)
+	// Requests matching a path under another method are answered with 405 rather than 404,
+	// they go through the middleware of the context as well
+	ctxRouter.NotFoundHandler = newCtx.wrap(methodNotAllowedHandler(ctxRouter))
+	ctxRouter.MethodNotAllowedHandler = ctxRouter.NotFoundHandler
 	newCtx.router = ctxRouter
 
 	newCtx.eventBus = NewEventBus(newCtx)
@@ -69,13 +77,66 @@ func (c *Context) WithResources(resources ...*resource) *Context {
 		c.registerResource(resource)
 	}
 
-	c.init()
+	if err := c.init(); err != nil {
+		// Start reports the failure, a context with a resource that failed to initialize does not start
+		c.logger.Error("failed to initialize context '%s': %v", c.name, err)
+		c.initErr = errors.Join(c.initErr, err)
+	}
+
+	if providers, err := ResolveAll[HttpMiddlewareProvider](c); err == nil {
+		c.middleware = sortMiddleware(providers)
+	}
+	// Requests are authenticated inside the middleware of the context
+	if authenticators, err := ResolveAll[Authenticator](c); err == nil && len(authenticators) > 0 {
+		c.middleware = append(c.middleware, AuthenticationMiddleware(authenticators...))
+	}
+	c.chains.Clear()
 	return c
 }
 
+// wrap injects the context into a request and applies the middleware of its resources
+func (c *Context) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), AppContextKey, c))
+		c.chain(mux.CurrentRoute(r), next).ServeHTTP(w, r)
+	})
+}
+
+// chain returns the middleware of the context around the handler of a route. Gorilla applies router
+// middleware on every request, the chain is built on the first request of the route and kept until
+// the middleware of the context changes.
+func (c *Context) chain(route *mux.Route, next http.Handler) http.Handler {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if route == nil {
+		return chainMiddleware(c.middleware, next)
+	}
+	if chained, ok := c.chains.Load(route); ok {
+		return chained.(http.Handler)
+	}
+	chained, _ := c.chains.LoadOrStore(route, chainMiddleware(c.middleware, next))
+	return chained.(http.Handler)
+}
+
 func (c *Context) Start() error {
+	if c.initErr != nil {
+		return fmt.Errorf("failed to initialize context '%s': %w", c.name, c.initErr)
+	}
+
+	if err := c.eventBus.Start(); err != nil {
+		return fmt.Errorf("failed to start event bus of context '%s': %w", c.name, err)
+	}
 
-	c.eventBus.Start()
+	// Resources start in declaration order, after the event bus they may dispatch to
+	for _, instance := range c.instances() {
+		if consumer, ok := instance.(MessageConsumer); ok {
+			consumer.SetEventBus(c.eventBus)
+		}
+		if err := ExecuteLifecycleHook(instance, "OnStart"); err != nil {
+			return fmt.Errorf("OnStart hook failed for %T: %w", instance, err)
+		}
+	}
 
 	c.logger.Info("context '%s' started", c.name)
 	return nil
@@ -89,6 +150,10 @@ func (c *Context) registerResource(rsc *resource) {
 	types := rsc.Types()
 	registeredTypes := make([]string, 0)
 
+	// Remember the declaration order, resources resolved together are returned in this order
+	c.declared++
+	rsc.order = c.declared
+
 	for _, typ := range types {
 		if _, exists := c.resources[typ]; !exists {
 			c.resources[typ] = make(map[string]*resource)
@@ -219,20 +284,112 @@ func (c *Context) autoWire(target any) error {
 }
 
 func (c *Context) Destroy() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	// Outbox relays publish what was committed until now while the resources they publish to still run
+	c.relaysMu.Lock()
+	relays := append([]*OutboxRelay{}, c.relays...)
+	c.relaysMu.Unlock()
+	for _, relay := range relays {
+		relay.OnDestroy()
+	}
+
+	// Resources stop in reverse declaration order, before the event bus they may dispatch to
+	instances := c.instances()
+	for i := len(instances) - 1; i >= 0; i-- {
+		if err := ExecuteLifecycleHook(instances[i], "OnDestroy"); err != nil {
+			c.logger.Error("OnDestroy hook failed for %T: %v", instances[i], err)
+		}
+	}
+
+	return c.eventBus.Stop()
+}
+
+// addOutboxRelay registers a relay to stop when the context is destroyed
+func (c *Context) addOutboxRelay(relay *OutboxRelay) {
+	c.relaysMu.Lock()
+	defer c.relaysMu.Unlock()
+	c.relays = append(c.relays, relay)
+}
+
+// shutdown tells the resources with an OnShutdown hook that the server is shutting down, for them to end
+// long-lived requests
+func (c *Context) shutdown() {
+	for _, instance := range c.instances() {
+		if err := ExecuteLifecycleHook(instance, "OnShutdown"); err != nil {
+			c.logger.Error("OnShutdown hook failed for %T: %v", instance, err)
+		}
+	}
+}
+
+// instances returns the instantiated singletons in the order their resources were declared
+func (c *Context) instances() []any {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	seen := make(map[*resource]bool)
+	declared := make([]*resource, 0)
+	for _, resources := range c.resources {
+		for _, resource := range resources {
+			if !seen[resource] && resource.instance.Load() != nil {
+				seen[resource] = true
+				declared = append(declared, resource)
+			}
+		}
+	}
+	sort.Slice(declared, func(i, j int) bool {
+		return declared[i].order < declared[j].order
+	})
+
+	instances := make([]any, 0, len(declared))
+	for _, resource := range declared {
+		instances = append(instances, resource.instance.Load())
+	}
+	return instances
+}
 
-	for _, implementations := range c.resources {
-		for _, resource := range implementations {
-			instance := resource.instance.Load()
-			if instance != nil {
-				if err := ExecuteLifecycleHook(instance, "OnDestroy"); err != nil {
-					// return fmt.Errorf("OnDestroy hook failed for %s: %w", ResourceTypeName(resource.Types()[0]), err)
+// resolveAll resolves the instances of all resources registered for any of the target types,
+// in the order the resources were declared
+func (c *Context) resolveAll(targetTypes ...reflect.Type) ([]any, error) {
+	// A resource registered under several types must only be resolved once
+	seen := make(map[*resource]bool)
+	matches := make([]*resource, 0)
+	for typ, resources := range c.resources {
+		for _, targetType := range targetTypes {
+			// Check if the registered type implements or matches the target type
+			if !typ.AssignableTo(targetType) && typ != targetType {
+				continue
+			}
+			for _, resource := range resources {
+				if !seen[resource] {
+					seen[resource] = true
+					matches = append(matches, resource)
 				}
 			}
 		}
 	}
-	return nil
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].order < matches[j].order
+	})
+
+	results := make([]any, 0, len(matches))
+	for _, resource := range matches {
+		switch resource.scope {
+		case Singleton:
+			// For singletons, we should have already created an instance
+			instance, err := c.resolveSingleton(resource)
+			if err == nil {
+				results = append(results, instance)
+			}
+		case Prototype:
+			// For prototypes, create a new instance each time
+			instance, err := c.construct(resource)
+			if err == nil {
+				results = append(results, instance)
+			}
+		default:
+			return nil, fmt.Errorf("unknown scope: %v", resource.scope)
+		}
+	}
+	return results, nil
 }
 
 func (c *Context) parseResolveOptions(options ...any) string {
@@ -299,21 +456,18 @@ func (c *Context) construct(resource *resource) (any, error) {
 
 	instance := results[0].Interface()
 
-	// AutoWire dependencies after construction
-	if err := c.autoWire(instance); err != nil {
-		return nil, fmt.Errorf("failed to autowire dependencies: %w", err)
+	// AutoWire dependencies after construction, only structs have fields to inject
+	if v := reflect.ValueOf(instance); v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+		if err := c.autoWire(instance); err != nil {
+			return nil, fmt.Errorf("failed to autowire dependencies: %w", err)
+		}
 	}
 
-	// Execute lifecycle hooks in order: OnInit -> OnStart
+	// OnStart runs later, when the context starts
 	if err := ExecuteLifecycleHook(instance, "OnInit"); err != nil {
 		return nil, fmt.Errorf("OnInit hook failed: %w", err)
 	}
 
-	// TODO: Not here but with Context start
-	// if err := ExecuteLifecycleHook(instance, "OnStart"); err != nil {
-	// 	return nil, fmt.Errorf("OnStart hook failed: %w", err)
-	// }
-
 	return instance, nil
 }
 
@@ -333,35 +487,19 @@ func (c *Context) resolveFactoryParams(factoryType reflect.Type) ([]reflect.Valu
 // ==========================================================
 // Generic functions
 // ==========================================================
-// ResolveAll resolves all instances of a specific interface
+// ResolveAll resolves all instances of a specific interface in the order their resources were declared
 func ResolveAll[T any](c *Context) ([]T, error) {
 	targetType := reflect.TypeOf((*T)(nil)).Elem()
 
-	results := make([]T, 0)
-	for typ, resources := range c.resources {
-		// Check if the registered type implements or matches the target type
-		if typ.AssignableTo(targetType) || typ == targetType {
-			for _, resource := range resources {
-				switch resource.scope {
-				case Singleton:
-					// For singletons, we should have already created an instance
-					instance, err := c.resolveSingleton(resource)
-					if err == nil {
-						results = append(results, instance.(T))
-					}
-				case Prototype:
-					// For prototypes, create a new instance each time
-					instance, err := c.construct(resource)
-					if err == nil {
-						results = append(results, instance.(T))
-					}
-				default:
-					return nil, fmt.Errorf("unknown scope: %v", resource.scope)
-				}
-			}
-		}
+	instances, err := c.resolveAll(targetType)
+	if err != nil {
+		return nil, err
 	}
 
+	results := make([]T, 0, len(instances))
+	for _, instance := range instances {
+		results = append(results, instance.(T))
+	}
 	return results, nil
 }
 
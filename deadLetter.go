@@ -0,0 +1,63 @@
+package ddd
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDeadLetterNotFound is returned when a dead letter does not exist in the store
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is an event that a handler failed to process after exhausting its retries
+type DeadLetter struct {
+	ID       string
+	Event    Event
+	Handler  string
+	Attempts int
+	Error    string
+	FailedAt time.Time
+}
+
+// DeadLetterStore keeps dead letters so they can be inspected and replayed
+type DeadLetterStore interface {
+	// Put stores or replaces a dead letter
+	Put(letter *DeadLetter) error
+	// Get returns a dead letter by its ID
+	Get(id string) (*DeadLetter, error)
+	// List returns all dead letters ordered by failure time
+	List() ([]*DeadLetter, error)
+	// Remove deletes a dead letter
+	Remove(id string) error
+}
+
+// inMemoryDeadLetterStore is the default DeadLetterStore of the event bus
+type inMemoryDeadLetterStore struct {
+	letters *memoryStore[DeadLetter]
+}
+
+// NewInMemoryDeadLetterStore creates a new in-memory dead letter store
+func NewInMemoryDeadLetterStore() DeadLetterStore {
+	return &inMemoryDeadLetterStore{
+		letters: newMemoryStore(func(letter *DeadLetter) time.Time { return letter.FailedAt }, ErrDeadLetterNotFound),
+	}
+}
+
+func (s *inMemoryDeadLetterStore) Put(letter *DeadLetter) error {
+	if letter == nil {
+		return errors.New("dead letter cannot be nil")
+	}
+	s.letters.put(letter.ID, letter)
+	return nil
+}
+
+func (s *inMemoryDeadLetterStore) Get(id string) (*DeadLetter, error) {
+	return s.letters.get(id)
+}
+
+func (s *inMemoryDeadLetterStore) List() ([]*DeadLetter, error) {
+	return s.letters.list(), nil
+}
+
+func (s *inMemoryDeadLetterStore) Remove(id string) error {
+	return s.letters.remove(id)
+}
@@ -0,0 +1,79 @@
+package ddd
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrDeliveryUntracked completes the delivery of an event spilled to disk by the event bus.
+// The spilled event is durable and will be handled, but the outcome of its handlers is not reported,
+// message consumers acknowledge the message.
+var ErrDeliveryUntracked = errors.New("event spilled to disk, its handling is no longer tracked")
+
+// Delivery is the outcome of an event dispatched with EventBus.DispatchWithResult. It completes
+// once every handler of the event succeeded or gave up, with the errors of the handlers that gave
+// up, or as soon as the event bus rejected the event.
+type Delivery struct {
+	done chan struct{}
+	err  error
+	once sync.Once
+}
+
+func newDelivery() *Delivery {
+	return &Delivery{done: make(chan struct{})}
+}
+
+// complete records the outcome of the delivery, only the first outcome counts
+func (d *Delivery) complete(err error) {
+	d.once.Do(func() {
+		d.err = err
+		close(d.done)
+	})
+}
+
+// Done returns a channel closed when the delivery completes
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Err returns the outcome of a completed delivery, it is nil until the delivery completes
+func (d *Delivery) Err() error {
+	select {
+	case <-d.done:
+		return d.err
+	default:
+		return nil
+	}
+}
+
+// Wait blocks until the delivery completes and returns its outcome, or the context error if it is done first
+func (d *Delivery) Wait(ctx context.Context) error {
+	select {
+	case <-d.done:
+		return d.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// trackedEvent carries the delivery of an event through the middleware chain and the queue
+type trackedEvent struct {
+	Event
+	delivery *Delivery
+}
+
+// untrack returns the event handlers see and its delivery, if the event is tracked
+func untrack(event Event) (Event, *Delivery) {
+	if tracked, ok := event.(*trackedEvent); ok {
+		return tracked.Event, tracked.delivery
+	}
+	return event, nil
+}
+
+// completeDelivery completes the delivery of a tracked event
+func completeDelivery(event Event, err error) {
+	if _, delivery := untrack(event); delivery != nil {
+		delivery.complete(err)
+	}
+}
@@ -0,0 +1,362 @@
+package ddd
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordFormat is the format of the records of a dropped file
+type RecordFormat string
+
+const (
+	// NDJSON files hold one json record per line, blank lines are skipped
+	NDJSON RecordFormat = "ndjson"
+	// CSV files start with a header line, each record is translated as a json object keyed by the header
+	CSV RecordFormat = "csv"
+)
+
+// DirectoryConsumerConfig holds the settings of a directory consumer
+type DirectoryConsumerConfig struct {
+	// Dir is the directory files are dropped in
+	Dir string `json:"dropDir"`
+	// Pattern selects the files to consume, all files by default
+	Pattern string `json:"dropPattern"`
+	// Format of the records, ndjson by default
+	Format RecordFormat `json:"dropFormat"`
+	// ArchiveDir receives the files whose records were all processed, Dir/archive by default
+	ArchiveDir string `json:"dropArchiveDir"`
+	// ErrorDir receives the files holding a record that cannot be processed, Dir/error by default
+	ErrorDir string `json:"dropErrorDir"`
+	// ProgressDir keeps the number of records processed per file, Dir/.progress by default
+	ProgressDir string `json:"dropProgressDir"`
+	// PollIntervalMs is how often the directory is scanned, 1000 by default
+	PollIntervalMs int `json:"dropPollIntervalMs"`
+	// SettleMs is how long a file must stay unmodified before it is consumed, 1000 by default
+	SettleMs int `json:"dropSettleMs"`
+}
+
+// withDefaults fills unset values with the directory consumer defaults
+func (c DirectoryConsumerConfig) withDefaults() DirectoryConsumerConfig {
+	if c.Pattern == "" {
+		c.Pattern = "*"
+	}
+	if c.Format == "" {
+		c.Format = NDJSON
+	}
+	if c.ArchiveDir == "" {
+		c.ArchiveDir = filepath.Join(c.Dir, "archive")
+	}
+	if c.ErrorDir == "" {
+		c.ErrorDir = filepath.Join(c.Dir, "error")
+	}
+	if c.ProgressDir == "" {
+		c.ProgressDir = filepath.Join(c.Dir, ".progress")
+	}
+	if c.PollIntervalMs <= 0 {
+		c.PollIntervalMs = 1000
+	}
+	if c.SettleMs < 0 {
+		c.SettleMs = 0
+	} else if c.SettleMs == 0 {
+		c.SettleMs = 1000
+	}
+	return c
+}
+
+// DirectoryConsumer is a MessageConsumer reading the records of files dropped in a directory.
+// Files are consumed one at a time in name order. The number of records processed is saved after
+// each record so that a file interrupted by a crash resumes at the next record. A file moves to the
+// archive directory once all its records are processed, and to the error directory, next to a report,
+// when a record is invalid or rejected for good. Other failures leave the file in place to be
+// resumed on the next scan.
+type DirectoryConsumer struct {
+	*baseMessageConsumer
+	log    *Logger
+	config DirectoryConsumerConfig
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	pollMu sync.Mutex
+}
+
+// NewDirectoryConsumer creates a consumer of the files dropped in the configured directory
+func NewDirectoryConsumer(config DirectoryConsumerConfig, translator MessageTranslator) *DirectoryConsumer {
+	config = config.withDefaults()
+	return &DirectoryConsumer{
+		baseMessageConsumer: NewBaseMessageConsumer(config.Dir, translator),
+		log:                 NewLogger(),
+		config:              config,
+	}
+}
+
+// OnStart creates the directories and starts scanning the drop directory
+func (c *DirectoryConsumer) OnStart() error {
+	if c.Running() {
+		return nil // Already running
+	}
+
+	for _, dir := range []string{c.config.Dir, c.config.ArchiveDir, c.config.ErrorDir, c.config.ProgressDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+
+	if err := c.baseMessageConsumer.OnStart(); err != nil {
+		return err
+	}
+
+	c.stopCh = make(chan struct{})
+	c.wg.Add(1)
+	go c.watch()
+
+	c.log.Info("Started directory message consumer for %s", c.Target())
+	return nil
+}
+
+// OnDestroy stops scanning, the file being consumed stops after its current record
+func (c *DirectoryConsumer) OnDestroy() error {
+	if !c.Running() {
+		return nil // Already stopped
+	}
+
+	close(c.stopCh)
+	c.wg.Wait()
+
+	if err := c.baseMessageConsumer.OnDestroy(); err != nil {
+		return err
+	}
+	c.log.Info("Stopped directory message consumer for %s", c.Target())
+	return nil
+}
+
+func (c *DirectoryConsumer) watch() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(c.config.PollIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Poll(); err != nil {
+			c.log.Error("Failed to scan %s: %v", c.Target(), err)
+		}
+
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll consumes the files that are ready in the drop directory
+func (c *DirectoryConsumer) Poll() error {
+	c.pollMu.Lock()
+	defer c.pollMu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(c.config.Dir, c.config.Pattern))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	settle := time.Duration(c.config.SettleMs) * time.Millisecond
+	for _, path := range paths {
+		if c.stopping() {
+			return nil
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || time.Since(info.ModTime()) < settle {
+			continue
+		}
+
+		if err := c.consumeFile(path); err != nil {
+			c.log.Warn("Consumption of %s interrupted, it resumes on the next scan: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// consumeFile processes the remaining records of a file and moves it once finished
+func (c *DirectoryConsumer) consumeFile(path string) error {
+	name := filepath.Base(path)
+	done, err := c.progress(name)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	records, err := c.records(file)
+	if err != nil {
+		file.Close()
+		return c.reject(path, 0, err)
+	}
+
+	for index := 1; ; index++ {
+		record, err := records()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return c.reject(path, index, err)
+		}
+		if index <= done {
+			continue
+		}
+		if c.stopping() {
+			file.Close()
+			return errors.New("consumer stopping")
+		}
+
+		ctx := context.WithValue(context.Background(), MessageSourceKey{}, path)
+		ctx = WithMessageHeaders(ctx, map[string]string{"file": name, "record": strconv.Itoa(index)})
+		if err := c.ProcessMessage(ctx, record); err != nil {
+			file.Close()
+			if !IsRetryable(err) {
+				return c.reject(path, index, err)
+			}
+			return fmt.Errorf("record %d: %w", index, err)
+		}
+
+		if err := c.saveProgress(name, index); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	file.Close()
+	if err := moveFile(path, c.config.ArchiveDir); err != nil {
+		return err
+	}
+	c.log.Info("Consumed %s", path)
+	return c.clearProgress(name)
+}
+
+// records returns an iterator over the records of a file, it returns io.EOF after the last record
+func (c *DirectoryConsumer) records(file *os.File) (func() ([]byte, error), error) {
+	switch c.config.Format {
+	case CSV:
+		reader := csv.NewReader(file)
+		header, err := reader.Read()
+		if err == io.EOF {
+			return func() ([]byte, error) { return nil, io.EOF }, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv header: %w", err)
+		}
+		return func() ([]byte, error) {
+			values, err := reader.Read()
+			if err != nil {
+				return nil, err
+			}
+			record := make(map[string]string, len(header))
+			for i, column := range header {
+				if i < len(values) {
+					record[column] = values[i]
+				}
+			}
+			return json.Marshal(record)
+		}, nil
+
+	case NDJSON:
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		return func() ([]byte, error) {
+			for scanner.Scan() {
+				if line := strings.TrimSpace(scanner.Text()); line != "" {
+					return []byte(line), nil
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported record format %s", c.config.Format)
+	}
+}
+
+// reject moves a file to the error directory with a report of the failing record
+func (c *DirectoryConsumer) reject(path string, record int, cause error) error {
+	name := filepath.Base(path)
+	c.log.Error("Moving %s to %s, record %d failed: %v", path, c.config.ErrorDir, record, cause)
+
+	if err := moveFile(path, c.config.ErrorDir); err != nil {
+		return err
+	}
+
+	report := fmt.Sprintf("file: %s\nrecord: %d\nerror: %v\n", name, record, cause)
+	if err := os.WriteFile(filepath.Join(c.config.ErrorDir, name+".error"), []byte(report), 0644); err != nil {
+		return fmt.Errorf("failed to write error report: %w", err)
+	}
+	return c.clearProgress(name)
+}
+
+func (c *DirectoryConsumer) stopping() bool {
+	select {
+	case <-c.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *DirectoryConsumer) progressPath(name string) string {
+	return filepath.Join(c.config.ProgressDir, name+".progress")
+}
+
+// progress returns how many records of a file were processed
+func (c *DirectoryConsumer) progress(name string) (int, error) {
+	data, err := os.ReadFile(c.progressPath(name))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read progress of %s: %w", name, err)
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func (c *DirectoryConsumer) saveProgress(name string, records int) error {
+	if err := writeFileAtomic(c.progressPath(name), []byte(strconv.Itoa(records))); err != nil {
+		return fmt.Errorf("failed to save progress of %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *DirectoryConsumer) clearProgress(name string) error {
+	if err := os.Remove(c.progressPath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// moveFile moves a file into a directory, suffixing its name with a timestamp if the name is taken
+func moveFile(path string, dir string) error {
+	target := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Stat(target); err == nil {
+		target = fmt.Sprintf("%s.%d", target, time.Now().UnixNano())
+	}
+	if err := os.Rename(path, target); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", path, dir, err)
+	}
+	return nil
+}
@@ -1,9 +1,17 @@
 package ddd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/gorilla/mux"
 )
@@ -21,15 +29,111 @@ const (
 	HEAD    HttpMethod = "HEAD"
 )
 
+// ErrRouteConflict is returned when two routes of a context handle the same method and path
+var ErrRouteConflict = errors.New("route conflict")
+
 type Endpoint interface {
 	OnInit() error
+	// Operations describes the routes the endpoint registered
+	Operations() []Operation
+}
+
+// Operation describes a registered route of an endpoint. Request and Response are the types a typed
+// handler decodes and returns, they are nil for handlers writing their response themselves.
+type Operation struct {
+	Route
+	// Template is the path template of the route, including the prefix of its context
+	Template string
+	Request  reflect.Type
+	Response reflect.Type
+}
+
+// Route maps a handler method of an endpoint to a request method and path, the name is optional.
+// Endpoints declare their routes with a Routes method, or with fields of type Route tagged with
+// the route, the handler method and the name:
+//
+//	_ ddd.Route `route:"GET /users/{userId}" handler:"GetUser" name:"user" summary:"Get a user"`
+//
+// A route requiring roles, any of which the principal must have, or permissions, all of which it
+// must have, answers 401 to anonymous requests and 403 to principals lacking them. Authenticated
+// routes require a principal alone:
+//
+//	_ ddd.Route `route:"DELETE /users/{userId}" handler:"Remove" roles:"admin" permissions:"users:delete"`
+//
+// A route may limit the rate of requests of each client, see ParseRateLimit, clients being told apart by
+// ip, principal or apiKey, and the number of requests in progress, in total or per client:
+//
+//	_ ddd.Route `route:"POST /users" handler:"Register" rateLimit:"10/1m slidingWindow" rateLimitKey:"principal" maxInFlight:"50"`
+//
+// Handler methods named after a request method, such as Get, that no route declares are
+// registered on the paths given to NewEndpoint.
+type Route struct {
+	Method        HttpMethod
+	Path          string
+	Handler       string
+	Name          string
+	Summary       string
+	Roles         []string
+	Permissions   []string
+	Authenticated bool
+	// RateLimit limits the requests of each client told apart by RateLimitBy, by remote address by default
+	RateLimit   *RateLimit
+	RateLimitBy RateLimitKey
+	// MaxInFlight limits the requests in progress, MaxInFlightPerClient those of each client
+	MaxInFlight          int
+	MaxInFlightPerClient int
+}
+
+// parseLimits reads the rate and concurrency limits of a route tag
+func (r *Route) parseLimits(tag reflect.StructTag) error {
+	if spec := tag.Get("rateLimit"); spec != "" {
+		limit, err := ParseRateLimit(spec)
+		if err != nil {
+			return err
+		}
+		r.RateLimit = &limit
+	}
+	if name := tag.Get("rateLimitKey"); name != "" {
+		key, ok := rateLimitKeys[name]
+		if !ok {
+			return fmt.Errorf("unknown rate limit key %s", name)
+		}
+		r.RateLimitBy = key
+	}
+	for name, target := range map[string]*int{"maxInFlight": &r.MaxInFlight, "maxInFlightPerClient": &r.MaxInFlightPerClient} {
+		if value := tag.Get(name); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit <= 0 {
+				return fmt.Errorf("invalid %s %q", name, value)
+			}
+			*target = limit
+		}
+	}
+	return nil
+}
+
+// requiresPrincipal tells whether anonymous requests are refused by the route
+func (r Route) requiresPrincipal() bool {
+	return r.Authenticated || len(r.Roles) > 0 || len(r.Permissions) > 0
+}
+
+// RouteTable is implemented by endpoints declaring their routes with a method
+type RouteTable interface {
+	Routes() []Route
 }
 
 type endpoint struct {
-	paths  []string
-	value  any
-	logger *Logger
-	router *mux.Router
+	paths      []string
+	value      any
+	logger     *Logger
+	router     *mux.Router
+	operations []Operation
+	mapper     ErrorMapper
+	mapperOnce sync.Once
+	limits     RateLimitStore
+	limitsOnce sync.Once
+	codec      *Codecs
+	codecsOnce sync.Once
 }
 
 func NewEndpoint(value any, paths []string, logger *Logger, router *mux.Router) Endpoint {
@@ -54,22 +158,175 @@ func NewEndpoint(value any, paths []string, logger *Logger, router *mux.Router)
 }
 
 func (e *endpoint) OnInit() error {
-	for _, path := range e.paths {
-		handlers := e.requestHandlers()
+	routes, err := e.routes()
+	if err != nil {
+		return err
+	}
 
-		for method, handler := range handlers {
-			e.router.HandleFunc(path, handler).Methods(string(method))
-			e.logger.Info("registered request handler at %s %s", string(method), path)
+	val := reflect.ValueOf(e.value)
+	for _, route := range routes {
+		method := val.MethodByName(route.Handler)
+		handler, ok := e.requestHandler(method)
+		if !ok {
+			return fmt.Errorf("route %s %s: %T has no handler method %s", route.Method, route.Path, e.value, route.Handler)
 		}
+		muxRoute := e.router.NewRoute().Path(route.Path).Methods(string(route.Method))
+		if route.Name != "" {
+			muxRoute.Name(route.Name)
+		}
+
+		template, _ := muxRoute.GetPathTemplate()
+		middleware := slices.Concat(e.middleware(), e.limit(route, template))
+		muxRoute.Handler(chainMiddleware(middleware, e.authorize(route, handler)))
+		request, response := handlerTypes(method.Type())
+		e.operations = append(e.operations, Operation{Route: route, Template: template, Request: request, Response: response})
+		e.logger.Info("registered request handler %s at %s %s", route.Handler, string(route.Method), route.Path)
+	}
+
+	// Routes of other endpoints of the context are registered already
+	return checkRouteConflicts(e.router)
+}
+
+func (e *endpoint) Operations() []Operation {
+	return e.operations
+}
+
+// middleware returns the middleware the endpoint wraps its routes with
+func (e *endpoint) middleware() []HttpMiddleware {
+	if provider, ok := e.value.(EndpointMiddleware); ok {
+		return provider.Middleware()
 	}
 	return nil
 }
 
-// requestHandlers returns a map of HTTP methods to their actual handler functions
-func (e *endpoint) requestHandlers() map[HttpMethod]http.HandlerFunc {
+// authorize refuses the requests of principals lacking the roles or permissions a route requires
+func (e *endpoint) authorize(route Route, handler http.Handler) http.Handler {
+	if !route.requiresPrincipal() {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := PrincipalOf(r.Context())
+		switch {
+		case principal == nil:
+			if ctx := GetContext(r); ctx != nil {
+				if authenticators, err := ResolveAll[Authenticator](ctx); err == nil {
+					challenge(w, authenticators)
+				}
+			}
+			e.respondError(w, r, Unauthorized("authentication required"))
+		case len(route.Roles) > 0 && !principal.HasRole(route.Roles...):
+			e.respondError(w, r, Forbidden(fmt.Sprintf("requires any of the roles %s", strings.Join(route.Roles, ", "))))
+		case !principal.HasPermissions(route.Permissions...):
+			e.respondError(w, r, Forbidden(fmt.Sprintf("requires the permissions %s", strings.Join(route.Permissions, ", "))))
+		default:
+			handler.ServeHTTP(w, r)
+		}
+	})
+}
+
+// limit returns the middleware applying the rate and concurrency limits of a route
+func (e *endpoint) limit(route Route, template string) []HttpMiddleware {
+	middleware := make([]HttpMiddleware, 0)
+	if route.RateLimit != nil {
+		name := string(route.Method) + " " + template
+		middleware = append(middleware, rateLimitMiddleware(name, *route.RateLimit, route.RateLimitBy, e.rateLimitStore, e.logger))
+	}
+	if route.MaxInFlight > 0 {
+		middleware = append(middleware, ConcurrencyLimitMiddleware(route.MaxInFlight, nil))
+	}
+	if route.MaxInFlightPerClient > 0 {
+		key := route.RateLimitBy
+		if key == nil {
+			key = KeyByClientIP
+		}
+		middleware = append(middleware, ConcurrencyLimitMiddleware(route.MaxInFlightPerClient, key))
+	}
+	return middleware
+}
+
+// rateLimitStore returns the rate limit store registered in the context of the request, or an in-memory one
+func (e *endpoint) rateLimitStore(r *http.Request) RateLimitStore {
+	e.limitsOnce.Do(func() {
+		e.limits = NewInMemoryRateLimitStore()
+		if ctx := GetContext(r); ctx != nil {
+			if stores, err := ResolveAll[RateLimitStore](ctx); err == nil && len(stores) > 0 {
+				e.limits = stores[0]
+			}
+		}
+	})
+	return e.limits
+}
+
+// tagList splits a comma separated tag value
+func tagList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	values := strings.Split(value, ",")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values
+}
+
+// routes returns the declared routes of the endpoint, followed by the routes of its handler methods named
+// after a request method on each of its paths
+func (e *endpoint) routes() ([]Route, error) {
+	routes := make([]Route, 0)
+	if table, ok := e.value.(RouteTable); ok {
+		routes = append(routes, table.Routes()...)
+	}
+
+	typ := reflect.TypeOf(e.value).Elem()
+	if typ.Kind() == reflect.Struct {
+		for i := range typ.NumField() {
+			field := typ.Field(i)
+			if field.Type != reflect.TypeOf(Route{}) {
+				continue
+			}
+			method, path, ok := strings.Cut(field.Tag.Get("route"), " ")
+			if !ok || path == "" || field.Tag.Get("handler") == "" {
+				return nil, fmt.Errorf("invalid route tag of %s: %q", typ.Name(), field.Tag)
+			}
+			route := Route{
+				Method:        HttpMethod(strings.ToUpper(method)),
+				Path:          strings.TrimSpace(path),
+				Handler:       field.Tag.Get("handler"),
+				Name:          field.Tag.Get("name"),
+				Summary:       field.Tag.Get("summary"),
+				Roles:         tagList(field.Tag.Get("roles")),
+				Permissions:   tagList(field.Tag.Get("permissions")),
+				Authenticated: field.Tag.Get("authenticated") == "true",
+			}
+			if err := route.parseLimits(field.Tag); err != nil {
+				return nil, fmt.Errorf("invalid route tag of %s: %w", typ.Name(), err)
+			}
+			routes = append(routes, route)
+		}
+	}
+
+	declared := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		declared[route.Handler] = true
+	}
+
+	handlers := e.requestHandlers()
+	for _, methodName := range sortedKeys(handlers) {
+		if declared[methodName] {
+			continue
+		}
+		for _, path := range e.paths {
+			routes = append(routes, Route{Method: handlers[methodName], Path: path, Handler: methodName})
+		}
+	}
+	return routes, nil
+}
+
+// requestHandlers returns the handler methods of the endpoint named after a request method
+func (e *endpoint) requestHandlers() map[string]HttpMethod {
 	typ := reflect.TypeOf(e.value)
 	val := reflect.ValueOf(e.value)
-	handlers := make(map[HttpMethod]http.HandlerFunc)
+	handlers := make(map[string]HttpMethod)
 
 	// Method name to HTTP method mapping
 	methodMap := map[string]HttpMethod{
@@ -84,25 +341,13 @@ func (e *endpoint) requestHandlers() map[HttpMethod]http.HandlerFunc {
 
 	// Check each method on the type
 	for i := range typ.NumMethod() {
-		method := typ.Method(i)
-		methodName := method.Name
+		methodName := typ.Method(i).Name
 
 		// Check if this method name matches our HTTP method convention
 		if httpMethod, exists := methodMap[methodName]; exists {
-			// Verify the method signature: func(http.ResponseWriter, *http.Request)
-			if isValidHandlerSignature(method.Type) {
-				// Get the actual method and create a handler function
-				methodValue := val.MethodByName(methodName)
-
-				// Create the handler function that calls the method directly
-				handler := func(w http.ResponseWriter, r *http.Request) {
-					methodValue.Call([]reflect.Value{
-						reflect.ValueOf(w),
-						reflect.ValueOf(r),
-					})
-				}
-
-				handlers[httpMethod] = handler
+			// Methods of an unsupported signature are not handlers
+			if _, ok := e.requestHandler(val.MethodByName(methodName)); ok {
+				handlers[methodName] = httpMethod
 			}
 		}
 	}
@@ -110,29 +355,88 @@ func (e *endpoint) requestHandlers() map[HttpMethod]http.HandlerFunc {
 	return handlers
 }
 
-// isValidHandlerSignature checks if a method has the correct HTTP handler signature
-func isValidHandlerSignature(methodType reflect.Type) bool {
-	// Should have 3 parameters: receiver, http.ResponseWriter, *http.Request
-	if methodType.NumIn() != 3 {
-		return false
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+	return keys
+}
 
-	// Should have no return values (or could be modified to allow error return)
-	if methodType.NumOut() != 0 {
-		return false
-	}
+// pathVariable matches the variables of a path template, their names do not tell routes apart
+var pathVariable = regexp.MustCompile(`\{[^}:]*(:[^}]*)?\}`)
+
+// checkRouteConflicts returns an error when two routes of a router share a method and path, or a name
+func checkRouteConflicts(router *mux.Router) error {
+	seen := make(map[string]bool)
+	names := make(map[string]bool)
+	var conflicts []error
+	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if name := route.GetName(); name != "" {
+			if names[name] {
+				conflicts = append(conflicts, fmt.Errorf("%w: route name %s registered twice", ErrRouteConflict, name))
+			}
+			names[name] = true
+		}
+
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		path := pathVariable.ReplaceAllString(template, "{$1}")
+		for _, method := range methods {
+			key := method + " " + path
+			if seen[key] {
+				conflicts = append(conflicts, fmt.Errorf("%w: %s %s registered twice", ErrRouteConflict, method, template))
+			}
+			seen[key] = true
+		}
+		return nil
+	})
+	return errors.Join(conflicts...)
+}
 
-	// Check parameter types
-	responseWriterType := reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
-	requestType := reflect.TypeOf((*http.Request)(nil))
+// methodNotAllowedHandler answers 405 with the allowed methods when a route of the router matches the
+// request path under other methods, and 404 otherwise. Gorilla only reports a method mismatch when no
+// route registered after the mismatching one is tried, this handler does not depend on route order.
+// Routes are matched with their compiled matchers, the request only reaches it when no route matched.
+func methodNotAllowedHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := make([]string, 0)
+		router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+			var match mux.RouteMatch
+			if route.Match(r, &match) || !errors.Is(match.MatchErr, mux.ErrMethodMismatch) {
+				return nil
+			}
+			if methods, err := route.GetMethods(); err == nil {
+				allowed = append(allowed, methods...)
+			}
+			return nil
+		})
 
-	return methodType.In(1).Implements(responseWriterType) &&
-		methodType.In(2) == requestType
+		if len(allowed) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	})
 }
 
 func GetContext(r *http.Request) *Context {
-	if ctx := r.Context().Value(AppContextKey); ctx != nil {
-		return ctx.(*Context)
+	return ContextOf(r.Context())
+}
+
+// ContextOf returns the application context of a request context, such as the one given to typed handlers
+func ContextOf(ctx context.Context) *Context {
+	if appCtx := ctx.Value(AppContextKey); appCtx != nil {
+		return appCtx.(*Context)
 	}
 	return nil
 }
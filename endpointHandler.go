@@ -0,0 +1,419 @@
+package ddd
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ErrBadRequest wraps the errors of decoding a request for a typed handler
+var ErrBadRequest = errors.New("bad request")
+
+// ErrRequestTooLarge is returned when the body of a request for a typed handler exceeds the limit of BodyLimitMiddleware
+var ErrRequestTooLarge = errors.New("request too large")
+
+// Response lets a typed handler choose the status and headers of its response.
+// Typed handlers returning any other value answer 201 to POST and 200 otherwise, or 204 for a nil value.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   any
+}
+
+// NewResponse creates a response with the given status and body
+func NewResponse(status int, body any) *Response {
+	return &Response{Status: status, Header: make(http.Header), Body: body}
+}
+
+// ErrorMapper turns the error returned by a typed handler into a response status and body.
+// An ErrorMapper registered as a resource of a context replaces the default one for its endpoints.
+type ErrorMapper interface {
+	MapError(err error) (status int, body any)
+}
+
+// ErrorMapperFunc adapts a function to an ErrorMapper
+type ErrorMapperFunc func(err error) (int, any)
+
+func (f ErrorMapperFunc) MapError(err error) (int, any) {
+	return f(err)
+}
+
+// DefaultErrorMapper renders the standard domain errors as problems, see NewProblemRegistry
+func DefaultErrorMapper() ErrorMapper {
+	return NewProblemRegistry()
+}
+
+var (
+	responseWriterType = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+	requestType        = reflect.TypeOf((*http.Request)(nil))
+	contextType        = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType          = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// requestHandler adapts an endpoint method to a handler function. Methods may have one of the signatures
+//
+//	func(http.ResponseWriter, *http.Request)
+//	func(*http.Request) (T, error)
+//	func(context.Context, Req) (Resp, error)
+//
+// Req is decoded from the body by the decoder of its Content-Type, see Codecs, and its fields tagged path,
+// query, header or form are bound to the path variables, query parameters, headers and form fields they name.
+// Fields may be of a scalar kind, a pointer or slice of one, a time.Duration, a TextUnmarshaler such as
+// time.Time, or a *multipart.FileHeader for form files. Results are encoded in the media type the Accept
+// header of the request prefers and tagged with an ETag: the one the handler sets, that of an ETagged or
+// Versioned result, or a hash of the body of GET responses. GET requests whose If-None-Match header names
+// it are answered with 304. Handlers pass the If-Match header on to repositories with
+// ExpectVersion. It returns false for other signatures.
+func (e *endpoint) requestHandler(method reflect.Value) (http.HandlerFunc, bool) {
+	typ := method.Type()
+
+	switch {
+	case typ.NumIn() == 2 && typ.NumOut() == 0 &&
+		typ.In(0).Implements(responseWriterType) && typ.In(1) == requestType:
+		return func(w http.ResponseWriter, r *http.Request) {
+			method.Call([]reflect.Value{reflect.ValueOf(w), reflect.ValueOf(withIfMatch(r))})
+		}, true
+
+	case typ.NumIn() == 1 && isTypedResult(typ) && typ.In(0) == requestType:
+		return func(w http.ResponseWriter, r *http.Request) {
+			// Requests are refused before the handler runs when their response could not be encoded
+			encoding, err := e.negotiate(r)
+			if err != nil {
+				e.respondError(w, r, err)
+				return
+			}
+			out := method.Call([]reflect.Value{reflect.ValueOf(withIfMatch(r))})
+			e.respond(w, r, encoding, out[0], out[1])
+		}, true
+
+	case typ.NumIn() == 2 && isTypedResult(typ) && typ.In(0) == contextType:
+		return func(w http.ResponseWriter, r *http.Request) {
+			encoding, err := e.negotiate(r)
+			if err != nil {
+				e.respondError(w, r, err)
+				return
+			}
+			req, err := decodeRequest(r, typ.In(1), e.codecs(r))
+			if err != nil {
+				e.respondError(w, r, err)
+				return
+			}
+			out := method.Call([]reflect.Value{reflect.ValueOf(withIfMatch(r).Context()), req})
+			e.respond(w, r, encoding, out[0], out[1])
+		}, true
+
+	default:
+		return nil, false
+	}
+}
+
+// handlerTypes returns the request and response types of a typed handler
+func handlerTypes(typ reflect.Type) (request reflect.Type, response reflect.Type) {
+	if !isTypedResult(typ) {
+		return nil, nil
+	}
+	if typ.NumIn() == 2 {
+		request = typ.In(1)
+	}
+	return request, typ.Out(0)
+}
+
+// isTypedResult checks that a method returns a value and an error
+func isTypedResult(typ reflect.Type) bool {
+	return typ.NumOut() == 2 && typ.Out(1) == errorType
+}
+
+// responseEncoding is the media type and the encoder negotiated for the response of a typed handler
+type responseEncoding struct {
+	mediaType string
+	encode    BodyEncoder
+}
+
+// negotiate chooses the encoding of the response to a request
+func (e *endpoint) negotiate(r *http.Request) (responseEncoding, error) {
+	mediaType, encode, err := e.codecs(r).negotiate(r)
+	return responseEncoding{mediaType: mediaType, encode: encode}, err
+}
+
+// respond writes the result of a typed handler
+func (e *endpoint) respond(w http.ResponseWriter, r *http.Request, encoding responseEncoding, result reflect.Value, errValue reflect.Value) {
+	if !errValue.IsNil() {
+		e.respondError(w, r, errValue.Interface().(error))
+		return
+	}
+
+	if isNilValue(result) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	status := http.StatusOK
+	if r.Method == string(POST) {
+		status = http.StatusCreated
+	}
+	body := result.Interface()
+	if response, ok := body.(*Response); ok {
+		for name, values := range response.Header {
+			w.Header()[name] = values
+		}
+		status, body = response.Status, response.Body
+	}
+	if body == nil || status == http.StatusNoContent || status == http.StatusNotModified {
+		w.WriteHeader(status)
+		return
+	}
+
+	// The body is encoded before the status is written, for encoding errors to be answered
+	var encoded bytes.Buffer
+	if err := encoding.encode(&encoded, body); err != nil {
+		e.respondError(w, r, fmt.Errorf("failed to encode response as %s: %w", encoding.mediaType, err))
+		return
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Accept")
+	if status >= http.StatusOK && status < http.StatusMultipleChoices {
+		if etag := entityTag(r, header, body, encoded.Bytes()); etag != "" {
+			header.Set("ETag", etag)
+			// Clients holding the representation already are told it did not change
+			safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+			if safe && status == http.StatusOK && !noneMatch(entityTags(r.Header, "If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+	header.Set("Content-Type", encoding.mediaType)
+	w.WriteHeader(status)
+	w.Write(encoded.Bytes())
+}
+
+// respondError writes the response the error mapper of the endpoint gives for an error
+func (e *endpoint) respondError(w http.ResponseWriter, r *http.Request, err error) {
+	if status := writeError(w, r, e.errorMapper(r), err); status >= http.StatusInternalServerError {
+		e.logger.Error("%s %s failed with status %d: %v", r.Method, r.URL.Path, status, err)
+	}
+}
+
+// errorMapper returns the error mapper registered in the context of the request, or the default one
+func (e *endpoint) errorMapper(r *http.Request) ErrorMapper {
+	e.mapperOnce.Do(func() {
+		e.mapper = errorMapperOf(GetContext(r))
+	})
+	return e.mapper
+}
+
+// codecs returns the codecs registered in the context of the request, or the default ones
+func (e *endpoint) codecs(r *http.Request) *Codecs {
+	e.codecsOnce.Do(func() {
+		e.codec = NewCodecs()
+		if ctx := GetContext(r); ctx != nil {
+			if codecs, err := ResolveAll[*Codecs](ctx); err == nil && len(codecs) > 0 {
+				e.codec = codecs[0]
+			}
+		}
+	})
+	return e.codec
+}
+
+// errorMapperOf returns the error mapper registered in a context, or the default one
+func errorMapperOf(ctx *Context) ErrorMapper {
+	if ctx != nil {
+		if mappers, err := ResolveAll[ErrorMapper](ctx); err == nil && len(mappers) > 0 {
+			return mappers[0]
+		}
+	}
+	return DefaultErrorMapper()
+}
+
+// writeError writes the response an error mapper gives for an error and returns its status
+func writeError(w http.ResponseWriter, r *http.Request, mapper ErrorMapper, err error) int {
+	status, body := mapper.MapError(err)
+	if problem, ok := body.(*Problem); ok {
+		// The problem may be shared, the instance is set on a copy
+		instance := *problem
+		WriteProblem(w, r, &instance)
+		return status
+	}
+	writeJson(w, status, body)
+	return status
+}
+
+// writeJson writes a json response, a nil body writes the status alone
+func writeJson(w http.ResponseWriter, status int, body any) {
+	if body == nil || status == http.StatusNoContent || status == http.StatusNotModified {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// isNilValue tells whether a handler result holds no value
+func isNilValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return value.IsNil()
+	default:
+		return false
+	}
+}
+
+// decodeRequest creates the request value of a typed handler from the body and the parameters of a request
+func decodeRequest(r *http.Request, typ reflect.Type, codecs *Codecs) (reflect.Value, error) {
+	isPtr := typ.Kind() == reflect.Ptr
+	elemType := typ
+	if isPtr {
+		elemType = typ.Elem()
+	}
+	target := reflect.New(elemType)
+
+	if r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+		decode, err := codecs.decoder(r)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if err := decode(r, target.Interface()); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return reflect.Value{}, fmt.Errorf("%w: %w", ErrRequestTooLarge, err)
+			}
+			return reflect.Value{}, fmt.Errorf("%w: %w", ErrBadRequest, err)
+		}
+	}
+
+	if elemType.Kind() == reflect.Struct {
+		if err := bindParameters(r, target.Elem()); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+
+	if isPtr {
+		return target, nil
+	}
+	return target.Elem(), nil
+}
+
+// bindParameters sets the fields of a request struct tagged path, query, header or form
+func bindParameters(r *http.Request, target reflect.Value) error {
+	vars, query := mux.Vars(r), r.URL.Query()
+	typ := target.Type()
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		var values []string
+		if name, ok := field.Tag.Lookup("path"); ok {
+			if value, found := vars[name]; found {
+				values = []string{value}
+			}
+		} else if name, ok := field.Tag.Lookup("query"); ok {
+			values = query[name]
+		} else if name, ok := field.Tag.Lookup("header"); ok {
+			values = r.Header.Values(name)
+		} else if name, ok := field.Tag.Lookup("form"); ok {
+			if field.Type == fileHeaderType {
+				if r.MultipartForm != nil && len(r.MultipartForm.File[name]) > 0 {
+					target.Field(i).Set(reflect.ValueOf(r.MultipartForm.File[name][0]))
+				}
+				continue
+			}
+			// The form is parsed by the decoder of form bodies alone
+			values = r.PostForm[name]
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(target.Field(i), values); err != nil {
+			return fmt.Errorf("%w: field %s: %w", ErrBadRequest, field.Name, err)
+		}
+	}
+	return nil
+}
+
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// setField parses the values of a parameter into a field, slices take all values and other fields the first
+func setField(field reflect.Value, values []string) error {
+	if reflect.PointerTo(field.Type()).Implements(textUnmarshalerType) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(values[0]))
+	}
+
+	switch field.Kind() {
+	case reflect.Ptr:
+		value := reflect.New(field.Type().Elem())
+		if err := setField(value.Elem(), values); err != nil {
+			return err
+		}
+		field.Set(value)
+		return nil
+	case reflect.Slice:
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setField(slice.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+
+	value := values[0]
+	if field.Type() == durationType {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(parsed))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(parsed)
+	default:
+		return fmt.Errorf("unsupported kind %s", field.Kind())
+	}
+	return nil
+}
@@ -22,6 +22,7 @@ type event struct {
 	eventType     string
 	timeStamp     time.Time
 	payload       any
+	principal     *Principal
 }
 
 func (e *event) AggregateType() string {
@@ -44,14 +45,24 @@ func (e *event) Payload() any {
 	return e.payload
 }
 
+// Principal returns the principal the event was raised on behalf of, see EventPrincipal
+func (e *event) Principal() *Principal {
+	return e.principal
+}
+
 func (e *event) ToJsonString() (string, error) {
-	data, err := json.Marshal(map[string]any{
+	fields := map[string]any{
 		"aggregate_type": e.aggregateType,
 		"aggregate_id":   e.aggregateID.String(),
 		"event_type":     e.eventType,
 		"time_stamp":     e.timeStamp,
 		"payload":        e.payload,
-	})
+	}
+	if e.principal != nil {
+		// Only the audit identity is kept, claims, roles and permissions are not written with the event
+		fields["principal"] = &Principal{ID: e.principal.ID, Method: e.principal.Method}
+	}
+	data, err := json.Marshal(fields)
 	if err != nil {
 		return "", err
 	}
@@ -62,23 +73,50 @@ func EventType(eventPayload any) string {
 	return reflect.TypeOf(eventPayload).PkgPath() + "." + reflect.TypeOf(eventPayload).Name()
 }
 
+// EventID identifies an event by its aggregate, type and timestamp
+func EventID(event Event) string {
+	return fmt.Sprintf("%s/%s/%s/%s", event.AggregateType(), event.AggregateID(), event.Type(),
+		event.TimeStamp().UTC().Format(time.RFC3339Nano))
+}
+
 func EventFromJsonString(jsonString string) (Event, error) {
 	var data map[string]any
 	if err := json.Unmarshal([]byte(jsonString), &data); err != nil {
 		return nil, err
 	}
 
-	timeStamp, err := time.Parse(time.RFC3339, data["time_stamp"].(string))
+	var principal *Principal
+	if _, ok := data["principal"]; ok {
+		var audit struct {
+			Principal *Principal `json:"principal"`
+		}
+		if err := json.Unmarshal([]byte(jsonString), &audit); err != nil {
+			return nil, fmt.Errorf("event json has an invalid principal: %w", err)
+		}
+		principal = audit.Principal
+	}
+
+	fields := make(map[string]string, 4)
+	for _, field := range []string{"aggregate_type", "aggregate_id", "event_type", "time_stamp"} {
+		value, ok := data[field].(string)
+		if !ok {
+			return nil, fmt.Errorf("event json has no %s", field)
+		}
+		fields[field] = value
+	}
+
+	timeStamp, err := time.Parse(time.RFC3339, fields["time_stamp"])
 	if err != nil {
 		return nil, err
 	}
 
 	return &event{
-		aggregateType: data["aggregate_type"].(string),
-		aggregateID:   NewID(data["aggregate_id"].(string)),
-		eventType:     data["event_type"].(string),
+		aggregateType: fields["aggregate_type"],
+		aggregateID:   NewID(fields["aggregate_id"]),
+		eventType:     fields["event_type"],
 		timeStamp:     timeStamp,
 		payload:       data["payload"],
+		principal:     principal,
 	}, nil
 }
 
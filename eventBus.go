@@ -4,11 +4,123 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"os"
+	"reflect"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	// ErrEventBusNotRunning is returned when dispatching to a stopped event bus
+	ErrEventBusNotRunning = errors.New("event bus is not running")
+	// ErrEventQueueFull is returned when the queue is saturated and the overflow policy rejects the event
+	ErrEventQueueFull = errors.New("event queue is full, event not published")
+)
+
+// OverflowPolicy decides what happens to an event dispatched while the queue is full
+type OverflowPolicy string
+
+const (
+	// OverflowBlock waits for room in the queue until the block timeout expires
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropOldest discards the oldest queued event to make room
+	OverflowDropOldest OverflowPolicy = "dropOldest"
+	// OverflowDropNewest rejects the dispatched event
+	OverflowDropNewest OverflowPolicy = "dropNewest"
+	// OverflowSpill writes the event to disk and feeds it back once the queue drains
+	OverflowSpill OverflowPolicy = "spill"
+)
+
+// PartitionKey returns the key of the partition an event is processed in.
+// Events with the same key are handled in dispatch order by a single worker.
+type PartitionKey func(event Event) string
+
+// AggregatePartitionKey keeps the events of each aggregate in order
+func AggregatePartitionKey(event Event) string {
+	return event.AggregateType() + ":" + event.AggregateID().String()
+}
+
+// EventBusConfig contains configuration for the event bus queue and its workers
+type EventBusConfig struct {
+	// QueueSize is the number of events buffered before the overflow policy applies
+	QueueSize int `json:"eventBusQueueSize"`
+	// WorkerCount is the number of workers that process events
+	WorkerCount int `json:"eventListenerWorkerCount"`
+	// MaxWorkerCount lets the bus add workers while the queue is backed up
+	MaxWorkerCount int `json:"eventListenerMaxWorkerCount"`
+	// OverflowPolicy is one of block, dropOldest, dropNewest or spill
+	OverflowPolicy OverflowPolicy `json:"eventBusOverflowPolicy"`
+	// BlockTimeoutMs bounds how long the block policy waits for room in the queue
+	BlockTimeoutMs int `json:"eventBusBlockTimeoutMs"`
+	// SpillDir is where the spill policy stores overflowing events
+	SpillDir string `json:"eventBusSpillDir"`
+	// CircuitBreakerThreshold is the number of consecutive panics after which a handler is no longer called
+	CircuitBreakerThreshold int `json:"eventBusCircuitBreakerThreshold"`
+	// CircuitBreakerCooldownMs is how long a tripped handler is skipped before it is tried again
+	CircuitBreakerCooldownMs int `json:"eventBusCircuitBreakerCooldownMs"`
+	// Partitioned processes the events of each aggregate in order, with one partition per worker
+	Partitioned bool `json:"eventBusPartitioned"`
+	// ScaleIntervalMs is how often queue depth is checked for scaling workers and draining spilled events
+	ScaleIntervalMs int `json:"eventBusScaleIntervalMs"`
+}
+
+// NewEventBusConfig loads the event bus configuration, falling back to defaults
+// when the configuration file does not exist
+func NewEventBusConfig(configPath ...string) *EventBusConfig {
+	var path string
+	if configPath == nil {
+		path = os.Getenv("DDD_EVENT_BUS_CONFIG_PATH")
+		if path == "" {
+			path = "configs/properties.json"
+		}
+	} else {
+		path = configPath[0]
+	}
+
+	config, err := Configuration[EventBusConfig](path)
+	if err != nil {
+		config = &EventBusConfig{}
+	}
+	return config.withDefaults()
+}
+
+// withDefaults fills unset values with the event bus defaults
+func (c *EventBusConfig) withDefaults() *EventBusConfig {
+	config := *c
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	if config.WorkerCount <= 0 {
+		config.WorkerCount = 1
+	}
+	if config.MaxWorkerCount < config.WorkerCount {
+		config.MaxWorkerCount = config.WorkerCount
+	}
+	if config.OverflowPolicy == "" {
+		config.OverflowPolicy = OverflowDropNewest
+	}
+	if config.BlockTimeoutMs <= 0 {
+		config.BlockTimeoutMs = 1000
+	}
+	if config.SpillDir == "" {
+		config.SpillDir = "data/spill"
+	}
+	if config.ScaleIntervalMs <= 0 {
+		config.ScaleIntervalMs = 100
+	}
+	if config.CircuitBreakerThreshold <= 0 {
+		config.CircuitBreakerThreshold = 5
+	}
+	if config.CircuitBreakerCooldownMs <= 0 {
+		config.CircuitBreakerCooldownMs = 30000
+	}
+	return &config
+}
+
 // EventBusMiddleware represents a middleware function that can wrap the dispatch process
 type EventBusMiddleware func(next HandleEvent) HandleEvent
 
@@ -16,27 +128,50 @@ type EventBusMiddleware func(next HandleEvent) HandleEvent
 type EventBus struct {
 	ctx           *Context
 	logger        *Logger
-	handlers      map[string][]HandleEvent
+	subscriptions *subscriptionIndex
 	handlersMutex sync.RWMutex
-	queue         chan Event
+	config        *EventBusConfig
+	queues        []chan Event
+	partitionKey  PartitionKey
+	spill         *eventSpill
 	running       bool
 	stopCh        chan struct{}
-	workerCount   int
+	retireCh      chan struct{}
+	activeWorkers atomic.Int32
+	workerIDs     atomic.Int64
 	listenerWg    sync.WaitGroup
 	mu            sync.RWMutex
 	middleware    []EventBusMiddleware
+	ctxMiddleware []EventBusMiddleware
 	dispatchChain HandleEvent
+	retryPolicy   RetryPolicy
+	deadLetters   DeadLetterStore
+	syncEvents    map[string]bool
 }
 
-// NewEventBus creates a new event bus
-func NewEventBus(ctx *Context) *EventBus {
+// NewEventBus creates a new event bus, loading its configuration when none is given
+func NewEventBus(ctx *Context, config ...*EventBusConfig) *EventBus {
+	var busConfig *EventBusConfig
+	if len(config) > 0 && config[0] != nil {
+		busConfig = config[0].withDefaults()
+	} else {
+		busConfig = NewEventBusConfig()
+	}
+
 	eb := &EventBus{
-		ctx:         ctx,
-		logger:      ctx.logger,
-		handlers:    make(map[string][]HandleEvent),
-		queue:       make(chan Event, 100), // Buffer size may come from configuration
-		workerCount: 1,                     // Default to 1 worker, could be configurable
-		middleware:  make([]EventBusMiddleware, 0),
+		ctx:           ctx,
+		logger:        ctx.logger,
+		subscriptions: newSubscriptionIndex(),
+		config:        busConfig,
+		retireCh:      make(chan struct{}),
+		middleware:    make([]EventBusMiddleware, 0),
+		retryPolicy:   DefaultRetryPolicy(),
+		deadLetters:   NewInMemoryDeadLetterStore(),
+		syncEvents:    make(map[string]bool),
+	}
+
+	if busConfig.Partitioned {
+		eb.partitionKey = AggregatePartitionKey
 	}
 
 	// Initialize the dispatch chain with the core dispatch logic
@@ -46,7 +181,18 @@ func NewEventBus(ctx *Context) *EventBus {
 }
 
 func (b *EventBus) Init() {
-	// TODO Find and add event bus middleware from the context
+	// Apply middleware providers and event logs of the context in declaration order, replacing
+	// those of a previous initialization
+	middleware := b.contextMiddleware()
+	b.mu.Lock()
+	b.ctxMiddleware = middleware
+	b.buildDispatchChain()
+	b.mu.Unlock()
+
+	// Use a dead letter store from the context if one is registered
+	if stores, err := ResolveAll[DeadLetterStore](b.ctx); err == nil && len(stores) > 0 {
+		b.WithDeadLetterStore(stores[0])
+	}
 
 	// Resolve all event handlers from the context
 	handlers, err := ResolveAll[EventHandler](b.ctx)
@@ -70,6 +216,68 @@ func (b *EventBus) WithMiddleware(middleware ...EventBusMiddleware) *EventBus {
 	return b
 }
 
+// contextMiddleware returns the middleware contributed by resources of the context.
+// Event logs that do not provide their own middleware are wrapped with EventLogMiddleware.
+func (b *EventBus) contextMiddleware() []EventBusMiddleware {
+	instances, err := b.ctx.resolveAll(
+		reflect.TypeOf((*EventBusMiddlewareProvider)(nil)).Elem(),
+		reflect.TypeOf((*EventLog)(nil)).Elem(),
+	)
+	if err != nil {
+		panic("can not get event bus middleware")
+	}
+
+	middleware := make([]EventBusMiddleware, 0, len(instances))
+	for _, instance := range instances {
+		switch provider := instance.(type) {
+		case EventBusMiddlewareProvider:
+			middleware = append(middleware, provider.Middleware)
+		case EventLog:
+			middleware = append(middleware, EventLogMiddleware(provider, b.logger))
+		}
+	}
+	return middleware
+}
+
+// WithRetryPolicy sets the retry policy of handlers that do not declare their own
+func (b *EventBus) WithRetryPolicy(policy RetryPolicy) *EventBus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.retryPolicy = policy
+	return b
+}
+
+// WithDeadLetterStore replaces the store receiving events that exhausted their retries
+func (b *EventBus) WithDeadLetterStore(store DeadLetterStore) *EventBus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deadLetters = store
+	return b
+}
+
+// WithSynchronousEvents runs all handlers of the given event types on the dispatching goroutine
+func (b *EventBus) WithSynchronousEvents(eventTypes ...string) *EventBus {
+	b.handlersMutex.Lock()
+	defer b.handlersMutex.Unlock()
+
+	for _, eventType := range eventTypes {
+		b.syncEvents[eventType] = true
+	}
+	return b
+}
+
+// WithPartitionKey partitions the queue by the given key so that events sharing a key are
+// processed in order while different partitions run in parallel. It must be set before Start.
+func (b *EventBus) WithPartitionKey(key PartitionKey) *EventBus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.partitionKey = key
+	return b
+}
+
 // buildDispatchChain constructs the middleware chain with the core dispatch logic at the end
 func (b *EventBus) buildDispatchChain() {
 	// Core dispatch function (the final handler in the chain)
@@ -77,10 +285,12 @@ func (b *EventBus) buildDispatchChain() {
 		return b.coreDispatch(event)
 	}
 
-	// Build the chain by wrapping from right to left (last middleware wraps first)
+	// Build the chain by wrapping from right to left (last middleware wraps first), the
+	// middleware added with WithMiddleware runs before the middleware of the context
+	middleware := append(append([]EventBusMiddleware{}, b.middleware...), b.ctxMiddleware...)
 	b.dispatchChain = coreDispatch
-	for i := len(b.middleware) - 1; i >= 0; i-- {
-		b.dispatchChain = b.middleware[i](b.dispatchChain)
+	for i := len(middleware) - 1; i >= 0; i-- {
+		b.dispatchChain = middleware[i](b.dispatchChain)
 	}
 }
 
@@ -92,16 +302,117 @@ func (b *EventBus) coreDispatch(event Event) error {
 	b.mu.RUnlock()
 
 	if !running {
-		return errors.New("event bus is not running")
+		return ErrEventBusNotRunning
+	}
+
+	// Run synchronous handlers first, a failure rejects the event before any asynchronous handler sees it
+	handled, _ := untrack(event)
+	if err := b.dispatchSynchronously(handled); err != nil {
+		return err
 	}
 
 	// Add event to queue for async processing
-	select {
-	case b.queue <- event:
+	return b.enqueue(event)
+}
+
+// dispatchSynchronously runs the synchronous handlers of an event on the caller's goroutine
+func (b *EventBus) dispatchSynchronously(event Event) error {
+	var errs []error
+	for _, sub := range b.subscriptionsOf(event) {
+		if !b.synchronous(sub, event) {
+			continue
+		}
+		if attempts, err := b.invoke(sub, event); err != nil {
+			b.logger.Warn("synchronous handler %s rejected event %s after %d attempt(s): %v", sub.handler, event.Type(), attempts, err)
+			errs = append(errs, fmt.Errorf("handler %s: %w", sub.handler, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// synchronous tells whether a subscription runs on the dispatching goroutine for an event
+func (b *EventBus) synchronous(sub *subscription, event Event) bool {
+	if sub.mode == Synchronous {
+		return true
+	}
+
+	b.handlersMutex.RLock()
+	defer b.handlersMutex.RUnlock()
+	return b.syncEvents[event.Type()]
+}
+
+// subscriptionsOf returns the subscriptions matching an event
+func (b *EventBus) subscriptionsOf(event Event) []*subscription {
+	b.handlersMutex.RLock()
+	defer b.handlersMutex.RUnlock()
+	return b.subscriptions.match(event)
+}
+
+// queueOf returns the queue of the partition an event belongs to
+func (b *EventBus) queueOf(event Event) chan Event {
+	if len(b.queues) == 1 {
+		return b.queues[0]
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(b.partitionKey(event)))
+	return b.queues[hash.Sum32()%uint32(len(b.queues))]
+}
+
+// enqueue adds an event to its queue, applying the overflow policy when the queue is full
+func (b *EventBus) enqueue(event Event) error {
+	queue := b.queueOf(event)
+
+	switch b.config.OverflowPolicy {
+	case OverflowBlock:
+		timer := time.NewTimer(time.Duration(b.config.BlockTimeoutMs) * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case queue <- event:
+			return nil
+		case <-timer.C:
+			return ErrEventQueueFull
+		}
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case queue <- event:
+				return nil
+			default:
+			}
+			select {
+			case dropped := <-queue:
+				b.logger.Warn("event queue is full, dropped oldest event %s", dropped.Type())
+				completeDelivery(dropped, ErrEventQueueFull)
+			default:
+			}
+		}
+
+	case OverflowSpill:
+		// Keep dispatch order: once events are spilled, new ones go behind them
+		if b.spill.Len() == 0 {
+			select {
+			case queue <- event:
+				return nil
+			default:
+			}
+		}
+		if err := b.spill.Append(event); err != nil {
+			return fmt.Errorf("%w: %v", ErrEventQueueFull, err)
+		}
+		completeDelivery(event, ErrDeliveryUntracked)
 		return nil
+
 	default:
-		// Queue is full - this is non-blocking
-		return errors.New("event queue is full, event not published")
+		select {
+		case queue <- event:
+			return nil
+		default:
+			// Queue is full - this is non-blocking
+			b.logger.Warn("event queue is full, dropped event %s", event.Type())
+			return ErrEventQueueFull
+		}
 	}
 }
 
@@ -113,16 +424,51 @@ func (b *EventBus) Subscribe(handlers []EventHandler) {
 	for _, handler := range handlers {
 		subscriptions := handler.SubscribedTo()
 
-		for eventType, handlerFunc := range subscriptions {
-			if _, ok := b.handlers[eventType]; !ok {
-				b.handlers[eventType] = []HandleEvent{}
-			}
+		b.mu.RLock()
+		policy := b.retryPolicy
+		b.mu.RUnlock()
+		if retrying, ok := handler.(RetryingEventHandler); ok {
+			policy = retrying.RetryPolicy()
+		}
+
+		mode := Asynchronous
+		if dispatching, ok := handler.(DispatchingEventHandler); ok {
+			mode = dispatching.DispatchMode()
+		}
 
-			b.handlers[eventType] = append(b.handlers[eventType], handlerFunc)
+		// All handler functions of a handler share its circuit breaker
+		breaker := newCircuitBreaker(
+			b.config.CircuitBreakerThreshold,
+			time.Duration(b.config.CircuitBreakerCooldownMs)*time.Millisecond)
+
+		name := handlerName(handler)
+		for eventType, handlerFunc := range subscriptions {
+			b.subscriptions.add(&subscription{
+				handler:   name,
+				eventType: eventType,
+				handle:    handlerFunc,
+				retry:     policy,
+				mode:      mode,
+				breaker:   breaker,
+			})
 
 			eventTypeParts := strings.Split(eventType, ".")
 			b.logger.Info("subscribed handler to event %s", eventTypeParts[len(eventTypeParts)-1])
 		}
+
+		if conditional, ok := handler.(PredicateEventHandler); ok {
+			for _, condition := range conditional.SubscribedWhen() {
+				b.subscriptions.add(&subscription{
+					handler: name,
+					handle:  condition.Handle,
+					retry:   policy,
+					mode:    mode,
+					when:    condition.When,
+					breaker: breaker,
+				})
+				b.logger.Info("subscribed handler %s to events matching a predicate", name)
+			}
+		}
 	}
 
 }
@@ -133,7 +479,17 @@ func (b *EventBus) Dispatch(event Event) error {
 	return b.dispatchChain(event)
 }
 
-// Dispatch sends an event through the middleware pipeline
+// DispatchWithResult sends an event through the middleware pipeline and returns its delivery,
+// which completes once the handlers of the event are done with it
+func (b *EventBus) DispatchWithResult(event Event) *Delivery {
+	delivery := newDelivery()
+	if err := b.dispatchChain(&trackedEvent{Event: event, delivery: delivery}); err != nil {
+		delivery.complete(err)
+	}
+	return delivery
+}
+
+// DispatchFrom sends the events raised by an aggregate through the middleware pipeline
 func (b *EventBus) DispatchFrom(aggregate Aggregate) error {
 	for _, event := range aggregate.GetAllEvents() {
 		err := b.Dispatch(event)
@@ -155,31 +511,56 @@ func (b *EventBus) Start() error {
 		return nil // Already running
 	}
 
+	if b.config.OverflowPolicy == OverflowSpill && b.spill == nil {
+		spill, err := newEventSpill(b.config.SpillDir)
+		if err != nil {
+			return err
+		}
+		b.spill = spill
+	}
+
+	if b.queues == nil {
+		b.queues = b.createQueues()
+	}
+
 	b.running = true
 	b.stopCh = make(chan struct{})
 
-	// Start worker goroutines to process events from the queue
+	// Start worker goroutines to process events from the queues,
+	// a partition is owned by a single worker to keep its events in order
 	ctx := context.Background()
-	for range b.workerCount {
+	if len(b.queues) > 1 {
+		for _, queue := range b.queues {
+			b.startWorker(ctx, queue)
+		}
+	} else {
+		for range b.config.WorkerCount {
+			b.startWorker(ctx, b.queues[0])
+		}
+	}
+
+	// Start the supervisor scaling workers and draining spilled events
+	if b.scalable() || b.spill != nil {
 		b.listenerWg.Add(1)
-		go b.listen(ctx, b.queue)
+		go b.supervise(ctx)
 	}
 
-	b.logger.Info("event bus started with %d workers", b.workerCount)
+	b.logger.Info("event bus started with %d workers", b.config.WorkerCount)
 	return nil
 }
 
 // Stop gracefully shuts down the event bus
 func (b *EventBus) Stop() error {
 	b.mu.Lock()
-	defer b.mu.Unlock()
-
 	if !b.running {
+		b.mu.Unlock()
 		return nil // Already stopped
 	}
 
 	close(b.stopCh)
 	b.running = false
+	// Release the lock so that workers finishing their events can still read the bus state
+	b.mu.Unlock()
 
 	// Wait for workers to finish with a reasonable timeout
 	done := make(chan struct{})
@@ -195,6 +576,12 @@ func (b *EventBus) Stop() error {
 	// Wait for workers to finish or timeout
 	select {
 	case <-done:
+		// Events still queued stay spilled, to be drained at the next start
+		if b.spill != nil {
+			if err := b.spill.Compact(); err != nil {
+				b.logger.Error("failed to compact spilled events: %v", err)
+			}
+		}
 		b.logger.Info("Event bus stopped")
 		return nil
 	case <-ctx.Done():
@@ -210,13 +597,52 @@ func (b *EventBus) IsRunning() bool {
 	return b.running
 }
 
+// createQueues creates one queue per partition, or a single queue shared by all workers
+func (b *EventBus) createQueues() []chan Event {
+	partitions := 1
+	if b.partitionKey != nil {
+		partitions = b.config.WorkerCount
+	}
+
+	queues := make([]chan Event, partitions)
+	for i := range queues {
+		queues[i] = make(chan Event, b.config.QueueSize)
+	}
+	return queues
+}
+
+// scalable tells whether workers may be added, which is only possible on a shared queue
+func (b *EventBus) scalable() bool {
+	return len(b.queues) == 1 && b.config.MaxWorkerCount > b.config.WorkerCount
+}
+
+// startWorker starts a new worker goroutine on a queue
+func (b *EventBus) startWorker(ctx context.Context, queue chan Event) {
+	b.activeWorkers.Add(1)
+	b.listenerWg.Add(1)
+	go b.listen(ctx, queue)
+}
+
 // listen is the worker goroutine that processes events from the queue
 func (b *EventBus) listen(ctx context.Context, eventQueue chan Event) {
 	defer b.listenerWg.Done()
+	defer b.activeWorkers.Add(-1)
 
-	workerID := fmt.Sprintf("worker-%d", time.Now().UnixNano()%1000) // Simple worker ID
+	workerID := fmt.Sprintf("worker-%d", b.workerIDs.Add(1))
 	b.logger.Info("worker %s started", workerID)
 
+	// Replace the worker if a panic escapes event processing, unless the bus is stopping
+	defer func() {
+		if r := recover(); r != nil {
+			b.logger.Error("worker %s: Recovered from panic: %v\n%s", workerID, r, debug.Stack())
+			select {
+			case <-b.stopCh:
+			default:
+				b.startWorker(ctx, eventQueue)
+			}
+		}
+	}()
+
 	for {
 		select {
 		case event, ok := <-eventQueue:
@@ -227,6 +653,10 @@ func (b *EventBus) listen(ctx context.Context, eventQueue chan Event) {
 			// Process the event by calling registered handlers
 			b.processEvent(event)
 
+		case <-b.retireCh:
+			b.logger.Info("worker %s: Retired as the queue drained", workerID)
+			return
+
 		case <-b.stopCh:
 			b.logger.Info("worker %s: Event bus is being stopped", workerID)
 			return
@@ -238,23 +668,96 @@ func (b *EventBus) listen(ctx context.Context, eventQueue chan Event) {
 	}
 }
 
-// processEvent executes all registered handlers for an event
-func (b *EventBus) processEvent(event Event) {
-	b.handlersMutex.RLock()
-	handlers, ok := b.handlers[event.Type()]
-	b.handlersMutex.RUnlock()
+// supervise periodically scales workers with the queue depth and feeds spilled events back to the queue
+func (b *EventBus) supervise(ctx context.Context) {
+	defer b.listenerWg.Done()
+
+	ticker := time.NewTicker(time.Duration(b.config.ScaleIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.drainSpill()
+			if b.scalable() {
+				b.scaleWorkers(ctx)
+			}
 
-	if !ok {
+		case <-b.stopCh:
+			return
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scaleWorkers adds a worker while the queue is backed up and retires one when it is empty
+func (b *EventBus) scaleWorkers(ctx context.Context) {
+	queue := b.queues[0]
+	depth := len(queue)
+	active := int(b.activeWorkers.Load())
+
+	switch {
+	case depth > cap(queue)/4 && active < b.config.MaxWorkerCount:
+		b.startWorker(ctx, queue)
+		b.logger.Info("queue depth %d, scaled up to %d workers", depth, active+1)
+
+	case depth == 0 && active > b.config.WorkerCount:
+		select {
+		case b.retireCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// drainSpill moves spilled events back into the queue while there is room
+func (b *EventBus) drainSpill() {
+	if b.spill == nil {
+		return
+	}
+
+	err := b.spill.Drain(func(event Event) bool {
+		select {
+		case b.queueOf(event) <- event:
+			return true
+		default:
+			return false
+		}
+	})
+	if err != nil {
+		b.logger.Error("failed to drain spilled events: %v", err)
+	}
+}
+
+// processEvent executes all registered handlers for an event and completes its delivery.
+// A spilled event is removed from the spill once its handlers are done with it.
+func (b *EventBus) processEvent(queued Event) {
+	queued, seq := unspill(queued)
+	if seq >= 0 {
+		defer b.spill.Handled(seq)
+	}
+	event, delivery := untrack(queued)
+
+	subscriptions := b.subscriptionsOf(event)
+	if len(subscriptions) == 0 {
 		// No handlers for this event type
+		if delivery != nil {
+			delivery.complete(nil)
+		}
 		return
 	}
 
-	// Execute all handlers for this event
+	// Execute all asynchronous handlers for this event
 	var errs []error
-	for _, handle := range handlers {
-		if err := handle(event); err != nil {
-			b.logger.Error("Error handling event %s: %v", event.Type(), err)
-			errs = append(errs, err)
+	for _, sub := range subscriptions {
+		if b.synchronous(sub, event) {
+			continue
+		}
+		if attempts, err := b.invoke(sub, event); err != nil {
+			b.logger.Error("handler %s failed on event %s after %d attempt(s): %v", sub.handler, event.Type(), attempts, err)
+			b.deadLetter(sub, event, attempts, err)
+			errs = append(errs, fmt.Errorf("handler %s: %w", sub.handler, err))
 			// Continue processing other handlers even if one fails
 		}
 	}
@@ -262,4 +765,161 @@ func (b *EventBus) processEvent(event Event) {
 	if len(errs) > 0 {
 		b.logger.Error("Errors encountered while processing event %s: %d errors", event.Type(), len(errs))
 	}
+	if delivery != nil {
+		delivery.complete(errors.Join(errs...))
+	}
+}
+
+// invoke calls a handler function, retrying retryable errors with backoff as its policy allows.
+// It returns the number of attempts made and the last error.
+func (b *EventBus) invoke(sub *subscription, event Event) (int, error) {
+	maxAttempts := sub.retry.attempts()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = b.call(sub, event); err == nil {
+			return attempt, nil
+		}
+
+		if attempt >= maxAttempts || !sub.retry.retryable(err) {
+			return attempt, err
+		}
+
+		backoff := sub.retry.Backoff(attempt)
+		b.logger.Warn("handler %s failed on event %s (attempt %d/%d), retrying in %v: %v",
+			sub.handler, event.Type(), attempt, maxAttempts, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-b.stopCh:
+			return attempt, err
+		}
+	}
+}
+
+// call runs a handler function once behind its circuit breaker, turning a panic into a PanicError
+func (b *EventBus) call(sub *subscription, event Event) (err error) {
+	if sub.breaker != nil && !sub.breaker.allow() {
+		return Fatal(fmt.Errorf("%w for handler %s", ErrCircuitOpen, sub.handler))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+			b.logger.Error("handler %s panicked on event %s: %v\n%s", sub.handler, event.Type(), r, err.(*PanicError).Stack)
+		}
+		if sub.breaker != nil && sub.breaker.record(err) {
+			b.logger.Error("circuit breaker of handler %s is open after repeated panics", sub.handler)
+		}
+	}()
+
+	return sub.handle(event)
+}
+
+// deadLetter hands an event that exhausted its retries over to the dead letter store
+func (b *EventBus) deadLetter(sub *subscription, event Event, attempts int, cause error) {
+	store := b.deadLetterStore()
+	if store == nil {
+		return
+	}
+
+	letter := &DeadLetter{
+		ID:       GenerateUUID().String(),
+		Event:    event,
+		Handler:  sub.handler,
+		Attempts: attempts,
+		Error:    cause.Error(),
+		FailedAt: time.Now(),
+	}
+	if err := store.Put(letter); err != nil {
+		b.logger.Error("failed to dead-letter event %s for handler %s: %v", event.Type(), sub.handler, err)
+	}
+}
+
+// deadLetterStore returns the dead letter store, which WithDeadLetterStore may replace at any time
+func (b *EventBus) deadLetterStore() DeadLetterStore {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.deadLetters
+}
+
+// DeadLetters returns the events that handlers failed to process
+func (b *EventBus) DeadLetters() ([]*DeadLetter, error) {
+	store := b.deadLetterStore()
+	if store == nil {
+		return []*DeadLetter{}, nil
+	}
+	return store.List()
+}
+
+// Replay runs the handler of a dead letter once more on the caller's goroutine.
+// The letter is removed from the store on success and updated on failure.
+func (b *EventBus) Replay(id string) error {
+	store := b.deadLetterStore()
+	if store == nil {
+		return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	stored, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	// Concurrent replays of a letter update their own copy of it
+	letter := *stored
+
+	sub := b.subscriptionOf(letter.Handler, letter.Event)
+	if sub == nil {
+		return fmt.Errorf("handler %s is not subscribed to event %s", letter.Handler, letter.Event.Type())
+	}
+
+	if err := b.call(sub, letter.Event); err != nil {
+		letter.Attempts++
+		letter.Error = err.Error()
+		letter.FailedAt = time.Now()
+		if putErr := store.Put(&letter); putErr != nil {
+			return errors.Join(err, putErr)
+		}
+		return err
+	}
+
+	b.logger.Info("replayed event %s for handler %s", letter.Event.Type(), letter.Handler)
+	return store.Remove(id)
+}
+
+// ReplayAll replays every dead letter and returns the errors of those that failed again
+func (b *EventBus) ReplayAll() error {
+	letters, err := b.DeadLetters()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, letter := range letters {
+		if err := b.Replay(letter.ID); err != nil {
+			errs = append(errs, fmt.Errorf("replay of %s failed: %w", letter.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// subscriptionOf finds the subscription of a named handler matching an event
+func (b *EventBus) subscriptionOf(handler string, event Event) *subscription {
+	for _, sub := range b.subscriptionsOf(event) {
+		if sub.handler == handler {
+			return sub
+		}
+	}
+	return nil
+}
+
+// handlerName returns the name identifying an event handler in logs and dead letters
+func handlerName(handler EventHandler) string {
+	typ := reflect.TypeOf(handler)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Name() == "" {
+		return fmt.Sprintf("%T", handler)
+	}
+	return ResourceName(typ)
 }
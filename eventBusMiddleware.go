@@ -0,0 +1,202 @@
+package ddd
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// EventBusMiddlewareProvider is a resource stereotype contributing middleware to the event bus
+// of its context. Providers are applied in the order their resources are declared.
+type EventBusMiddlewareProvider interface {
+	Middleware(next HandleEvent) HandleEvent
+}
+
+// Middleware lets an EventBusMiddleware function be registered as a resource
+func (m EventBusMiddleware) Middleware(next HandleEvent) HandleEvent {
+	return m(next)
+}
+
+// EventLogMiddleware appends every event accepted by the event bus to an event log
+func EventLogMiddleware(eventLog EventLog, logger *Logger) EventBusMiddleware {
+	return func(next HandleEvent) HandleEvent {
+		return func(event Event) error {
+			if err := next(event); err != nil {
+				return err
+			}
+
+			if err := eventLog.Append(event); err != nil {
+				// The event is already dispatched, failing to log it must not fail the dispatch
+				logger.Error("Failed to append event to log: %v", err)
+			}
+			return nil
+		}
+	}
+}
+
+// EventMetrics receives the outcome of every dispatch
+type EventMetrics interface {
+	ObserveDispatch(eventType string, duration time.Duration, err error)
+}
+
+// MetricsMiddleware times every dispatch and reports it to the given metrics
+func MetricsMiddleware(metrics EventMetrics) EventBusMiddleware {
+	return func(next HandleEvent) HandleEvent {
+		return func(event Event) error {
+			start := time.Now()
+			err := next(event)
+			metrics.ObserveDispatch(event.Type(), time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// EventTypeMetrics aggregates the dispatches of an event type
+type EventTypeMetrics struct {
+	Count         int
+	Errors        int
+	TotalDuration time.Duration
+	MaxDuration   time.Duration
+}
+
+// InMemoryEventMetrics keeps dispatch metrics per event type in memory
+type InMemoryEventMetrics struct {
+	metrics map[string]EventTypeMetrics
+	mu      sync.RWMutex
+}
+
+// NewInMemoryEventMetrics creates new in-memory event metrics
+func NewInMemoryEventMetrics() *InMemoryEventMetrics {
+	return &InMemoryEventMetrics{
+		metrics: make(map[string]EventTypeMetrics),
+	}
+}
+
+// ObserveDispatch records a dispatch of an event type
+func (m *InMemoryEventMetrics) ObserveDispatch(eventType string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metrics := m.metrics[eventType]
+	metrics.Count++
+	if err != nil {
+		metrics.Errors++
+	}
+	metrics.TotalDuration += duration
+	if duration > metrics.MaxDuration {
+		metrics.MaxDuration = duration
+	}
+	m.metrics[eventType] = metrics
+}
+
+// Snapshot returns a copy of the metrics per event type
+func (m *InMemoryEventMetrics) Snapshot() map[string]EventTypeMetrics {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]EventTypeMetrics, len(m.metrics))
+	for eventType, metrics := range m.metrics {
+		result[eventType] = metrics
+	}
+	return result
+}
+
+// PanicError is the error a recovered panic is turned into
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// RecoveryMiddleware turns a panic raised while dispatching into an error
+func RecoveryMiddleware(logger *Logger) EventBusMiddleware {
+	return func(next HandleEvent) HandleEvent {
+		return func(event Event) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &PanicError{Value: r, Stack: debug.Stack()}
+					logger.Error("recovered from panic while dispatching event %s: %v", event.Type(), r)
+				}
+			}()
+			return next(event)
+		}
+	}
+}
+
+// Span is a unit of work reported to a tracer
+type Span interface {
+	// End finishes the span with the outcome of the work
+	End(err error)
+}
+
+// Tracer starts spans, it can be backed by any tracing system
+type Tracer interface {
+	StartSpan(name string, attributes map[string]string) Span
+}
+
+// TracingMiddleware wraps every dispatch in a span
+func TracingMiddleware(tracer Tracer) EventBusMiddleware {
+	return func(next HandleEvent) HandleEvent {
+		return func(event Event) error {
+			span := tracer.StartSpan("dispatch "+event.Type(), map[string]string{
+				"event.type":     event.Type(),
+				"aggregate.type": event.AggregateType(),
+				"aggregate.id":   event.AggregateID().String(),
+			})
+			err := next(event)
+			span.End(err)
+			return err
+		}
+	}
+}
+
+// loggingTracer is a Tracer that logs span durations
+type loggingTracer struct {
+	logger *Logger
+}
+
+// NewLoggingTracer creates a tracer writing finished spans to the logger
+func NewLoggingTracer(logger *Logger) Tracer {
+	return &loggingTracer{logger: logger}
+}
+
+func (t *loggingTracer) StartSpan(name string, attributes map[string]string) Span {
+	return &loggingSpan{logger: t.logger, name: name, start: time.Now()}
+}
+
+type loggingSpan struct {
+	logger *Logger
+	name   string
+	start  time.Time
+}
+
+func (s *loggingSpan) End(err error) {
+	if err != nil {
+		s.logger.Warn("span %s failed after %v: %v", s.name, time.Since(s.start), err)
+		return
+	}
+	s.logger.Info("span %s finished in %v", s.name, time.Since(s.start))
+}
+
+// Validator is implemented by event payloads that can check their own consistency
+type Validator interface {
+	Validate() error
+}
+
+// ValidationMiddleware rejects events whose payload implements Validator and is invalid
+func ValidationMiddleware() EventBusMiddleware {
+	return func(next HandleEvent) HandleEvent {
+		return func(event Event) error {
+			if validator, ok := event.Payload().(Validator); ok {
+				if err := validator.Validate(); err != nil {
+					return fmt.Errorf("invalid payload for event %s: %w", event.Type(), err)
+				}
+			}
+			return next(event)
+		}
+	}
+}
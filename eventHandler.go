@@ -4,6 +4,58 @@ package ddd
 type HandleEvent func(event Event) error
 
 type EventHandler interface {
-	// SubscribedTo returns a map of command types to handler functions
+	// SubscribedTo returns a map of event types to handler functions.
+	// Besides exact event types, keys may be AllEvents, AggregateEvents or EventsIn patterns.
 	SubscribedTo() map[string]HandleEvent
 }
+
+// RetryingEventHandler is an EventHandler that overrides the retry policy of the event bus
+type RetryingEventHandler interface {
+	EventHandler
+	// RetryPolicy returns the policy applied to all handler functions of this handler
+	RetryPolicy() RetryPolicy
+}
+
+// DispatchMode tells whether handler functions run on an event bus worker or on the dispatching goroutine
+type DispatchMode int
+
+const (
+	// Asynchronous handlers run on event bus workers after Dispatch returns
+	Asynchronous DispatchMode = iota
+	// Synchronous handlers run before Dispatch returns and their errors are returned by Dispatch
+	Synchronous
+)
+
+func (m DispatchMode) String() string {
+	switch m {
+	case Asynchronous:
+		return "Asynchronous"
+	case Synchronous:
+		return "Synchronous"
+	default:
+		return "Unknown"
+	}
+}
+
+// DispatchingEventHandler is an EventHandler that chooses how its handler functions are dispatched
+type DispatchingEventHandler interface {
+	EventHandler
+	// DispatchMode returns the mode applied to all handler functions of this handler
+	DispatchMode() DispatchMode
+}
+
+// EventPredicate selects the events a conditional subscription handles
+type EventPredicate func(event Event) bool
+
+// ConditionalSubscription handles every event matching its predicate
+type ConditionalSubscription struct {
+	When   EventPredicate
+	Handle HandleEvent
+}
+
+// PredicateEventHandler is an EventHandler that also subscribes to events selected by predicates
+type PredicateEventHandler interface {
+	EventHandler
+	// SubscribedWhen returns the conditional subscriptions of this handler
+	SubscribedWhen() []ConditionalSubscription
+}
@@ -20,6 +20,14 @@ type EventLog interface {
 	Close() error
 }
 
+// ReplayableEventLog is an EventLog that returns all of its events in the order they were appended,
+// letting clients of an EventStream resume from the last event they received
+type ReplayableEventLog interface {
+	EventLog
+	// AllEvents retrieves all events in the order they were appended
+	AllEvents() ([]Event, error)
+}
+
 // InMemoryEventLogConfig contains configuration for in-memory event log
 type InMemoryEventLogConfig struct {
 	BufferSize int `json:"inMemoryEventLogBufferSize"`
@@ -51,6 +59,7 @@ func NewInMemoryEventLog(config *InMemoryEventLogConfig) EventLog {
 	}
 
 	return &inMemoryEventLog{
+		logger:          NewLogger(),
 		aggregateEvents: make(map[string][]Event),
 		typeEvents:      make(map[string][]Event),
 		allEvents:       make([]Event, 0, config.BufferSize),
@@ -60,17 +69,7 @@ func NewInMemoryEventLog(config *InMemoryEventLogConfig) EventLog {
 
 // Middleware returns the middleware function for event logging
 func (e *inMemoryEventLog) Middleware(next HandleEvent) HandleEvent {
-	return func(event Event) error {
-		// Log the event before passing to next middleware
-		if err := e.Append(event); err != nil {
-			e.logger.Error("Failed to append event to log: %v", err)
-			// Decide whether to continue or fail the dispatch
-			// For now, we'll continue but you might want to make this configurable
-		}
-
-		// Continue to next middleware/handler
-		return next(event)
-	}
+	return EventLogMiddleware(e, e.logger)(next)
 }
 
 // EventsOf returns all events for a specific aggregate
@@ -167,6 +166,11 @@ func (e *inMemoryEventLog) Close() error {
 	return nil
 }
 
+// AllEvents returns all events in the order they were appended
+func (e *inMemoryEventLog) AllEvents() ([]Event, error) {
+	return e.GetAllEvents(), nil
+}
+
 // GetAllEvents returns all events in the log (useful for debugging/testing)
 func (e *inMemoryEventLog) GetAllEvents() []Event {
 	e.mu.RLock()
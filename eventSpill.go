@@ -0,0 +1,199 @@
+package ddd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// eventSpill is an append-only file holding events that did not fit in the event bus queue.
+// Spilled events survive restarts and are drained back into the queue in dispatch order. An event
+// stays in the file until its handlers are done with it, so that the events in the queue when the
+// process stops are drained again at the next start.
+type eventSpill struct {
+	path string
+	// head is the sequence number of the first event of the file
+	head int
+	// count is the number of events in the file, of which the first offered ones are in the queue
+	count   int
+	offered int
+	handled map[int]bool
+	mu      sync.Mutex
+}
+
+// spilledEvent is an event drained from the spill, with its sequence number in the spill
+type spilledEvent struct {
+	Event
+	seq int
+}
+
+// unspill returns a drained event and its sequence number, -1 when it was not spilled
+func unspill(event Event) (Event, int) {
+	if spilled, ok := event.(*spilledEvent); ok {
+		return spilled.Event, spilled.seq
+	}
+	return event, -1
+}
+
+// newEventSpill opens the spill file in the given directory, counting events left by a previous run
+func newEventSpill(dir string) (*eventSpill, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+
+	spill := &eventSpill{path: filepath.Join(dir, "events.spill"), handled: make(map[int]bool)}
+
+	lines, err := spill.readLines()
+	if err != nil {
+		return nil, err
+	}
+	spill.count = len(lines)
+
+	return spill, nil
+}
+
+// Len returns the number of spilled events not drained yet
+func (s *eventSpill) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count - s.offered
+}
+
+// Append writes an event at the end of the spill file
+func (s *eventSpill) Append(event Event) error {
+	line, err := event.ToJsonString()
+	if err != nil {
+		return fmt.Errorf("failed to serialize spilled event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open spill file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+
+	s.count++
+	return nil
+}
+
+// Handled records that the handlers of a drained event are done with it, the event is removed from
+// the file at the next drain
+func (s *eventSpill) Handled(seq int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handled[seq] = true
+}
+
+// Drain removes the handled events from the file, then offers the spilled events not drained yet
+// in order until offer declines one
+func (s *eventSpill) Drain(offer func(event Event) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.compact(); err != nil {
+		return err
+	}
+	if s.offered == s.count {
+		return nil
+	}
+
+	lines, err := s.readLines()
+	if err != nil {
+		return err
+	}
+
+	for ; s.offered < len(lines); s.offered++ {
+		seq := s.head + s.offered
+		event, err := EventFromJsonString(string(lines[s.offered]))
+		if err != nil {
+			// A corrupt line can never be delivered, skip it
+			s.handled[seq] = true
+			continue
+		}
+		if !offer(&spilledEvent{Event: event, seq: seq}) {
+			break
+		}
+	}
+	return nil
+}
+
+// Compact removes the handled events from the file
+func (s *eventSpill) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+// compact rewrites the file without its leading handled events, an event handled before those drained
+// ahead of it stays in the file until they are handled
+func (s *eventSpill) compact() error {
+	handled := 0
+	for s.handled[s.head+handled] {
+		handled++
+	}
+	if handled == 0 {
+		return nil
+	}
+
+	lines, err := s.readLines()
+	if err != nil {
+		return err
+	}
+
+	remaining := lines[min(handled, len(lines)):]
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(bytes.Join(remaining, []byte("\n")), newline(len(remaining))...), 0644); err != nil {
+		return fmt.Errorf("failed to rewrite spill file: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to replace spill file: %w", err)
+	}
+
+	for seq := s.head; seq < s.head+handled; seq++ {
+		delete(s.handled, seq)
+	}
+	s.head += handled
+	s.count -= handled
+	s.offered -= handled
+	return nil
+}
+
+// readLines returns the non-empty lines of the spill file
+func (s *eventSpill) readLines() ([][]byte, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open spill file: %w", err)
+	}
+	defer file.Close()
+
+	lines := make([][]byte, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			lines = append(lines, bytes.Clone(line))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// newline returns a trailing line break when there is content to terminate
+func newline(lines int) []byte {
+	if lines == 0 {
+		return nil
+	}
+	return []byte("\n")
+}
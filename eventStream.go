@@ -0,0 +1,456 @@
+package ddd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// EventAuthorizer tells whether the principal of a connection may receive an event, the principal is nil
+// for anonymous connections
+type EventAuthorizer func(principal *Principal, event Event) bool
+
+// streamWriteTimeout bounds the time an event takes to reach a client of a server-sent event stream
+const streamWriteTimeout = 10 * time.Second
+
+// EventStream is an endpoint streaming the events of the event bus of its context to clients, as server-sent
+// events or, for requests upgrading to one, over a WebSocket. It serves GET /events by default, clients
+// choose the events they receive with the repeatable query parameters type, aggregateType and aggregateId,
+// types matching either in full or by their name alone:
+//
+//	GET /test/events?type=UserApproved&aggregateId=42
+//
+// Server-sent events are named after the type of their event and carry it as json data, without the principal
+// it was raised on behalf of. WebSocket messages are json objects with the id, the type name and the event.
+//
+// Events are identified by EventID. Clients reconnecting with a Last-Event-ID header, or a lastEventId query
+// parameter, first receive the events they missed from the event log of the context when it is a
+// ReplayableEventLog, or new events alone when the log does not hold the last one they received. Clients
+// too slow to take their events are disconnected, to reconnect and resume the same way.
+//
+// The route of the stream may require a principal like any other route, see WithRoute, and an authorizer
+// decides which events the principal of each connection receives, see WithAuthorizer. A stream with neither
+// refuses its clients. WebSocket requests from browsers are accepted from the origin of the stream alone,
+// see WithAllowedOrigins.
+type EventStream struct {
+	Endpoint
+	route       *Route
+	authorize   EventAuthorizer
+	origins     []string
+	bufferSize  int
+	heartbeat   time.Duration
+	connections map[*eventConnection]bool
+	closed      bool
+	mu          sync.RWMutex
+	log         ReplayableEventLog
+	logOnce     sync.Once
+	logger      *Logger
+}
+
+// NewEventStream creates an event stream endpoint, its clients are refused until it has an authorizer or
+// its route requires a principal
+func NewEventStream(logger *Logger, router *mux.Router) *EventStream {
+	stream := &EventStream{
+		route:       &Route{Method: GET, Path: "/events", Handler: "Stream", Name: "events", Summary: "Stream events"},
+		bufferSize:  64,
+		heartbeat:   15 * time.Second,
+		connections: make(map[*eventConnection]bool),
+		logger:      logger,
+	}
+	stream.Endpoint = NewEndpoint(stream, nil, logger, router)
+	return stream
+}
+
+// WithRoute sets the path, the access requirements and the limits of the stream route, its method and
+// handler are those of the stream
+func (s *EventStream) WithRoute(route Route) *EventStream {
+	route.Method, route.Handler = GET, s.route.Handler
+	if route.Path == "" {
+		route.Path = s.route.Path
+	}
+	s.route = &route
+	return s
+}
+
+// WithAuthorizer sets the authorizer deciding which events the principal of each connection receives
+func (s *EventStream) WithAuthorizer(authorize EventAuthorizer) *EventStream {
+	s.authorize = authorize
+	return s
+}
+
+// WithAllowedOrigins sets the origins besides the one of the stream that WebSocket requests may come from,
+// * allowing any origin
+func (s *EventStream) WithAllowedOrigins(origins ...string) *EventStream {
+	s.origins = origins
+	return s
+}
+
+// WithBufferSize sets the number of events buffered for each client before it is disconnected, 64 by default
+func (s *EventStream) WithBufferSize(size int) *EventStream {
+	s.bufferSize = size
+	return s
+}
+
+// WithHeartbeat sets the interval of the comments or pings keeping idle connections open, 15 seconds by default.
+// An interval that is not positive keeps the current one.
+func (s *EventStream) WithHeartbeat(interval time.Duration) *EventStream {
+	if interval > 0 {
+		s.heartbeat = interval
+	}
+	return s
+}
+
+func (s *EventStream) Routes() []Route {
+	return []Route{*s.route}
+}
+
+// SubscribedTo subscribes the stream to all events of the event bus
+func (s *EventStream) SubscribedTo() map[string]HandleEvent {
+	return map[string]HandleEvent{AllEvents: s.publish}
+}
+
+// OnShutdown disconnects all clients, the server calls it once it starts shutting down
+func (s *EventStream) OnShutdown() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for connection := range s.connections {
+		connection.close()
+	}
+	clear(s.connections)
+	return nil
+}
+
+// OnDestroy disconnects all clients
+func (s *EventStream) OnDestroy() error {
+	return s.OnShutdown()
+}
+
+// Stream handles the requests of clients
+func (s *EventStream) Stream(w http.ResponseWriter, r *http.Request) {
+	if s.authorize == nil && !s.route.requiresPrincipal() {
+		writeError(w, r, errorMapperOf(GetContext(r)), Forbidden("event stream has no authorizer"))
+		return
+	}
+
+	connection := s.connect(r)
+	if connection == nil {
+		WriteProblem(w, r, NewProblem(http.StatusServiceUnavailable, "event stream closed"))
+		return
+	}
+	defer s.disconnect(connection)
+
+	// Clients are connected before the log is read, so that no event falls between the two
+	missed, err := s.missed(r, connection)
+	if err != nil {
+		s.logger.Warn("Failed to read the events missed by a client: %v", err)
+	}
+
+	var sink eventSink
+	if isWebSocketUpgrade(r) {
+		ws, err := upgradeWebSocket(w, r, s.origins)
+		if err != nil {
+			writeError(w, r, errorMapperOf(GetContext(r)), err)
+			return
+		}
+		sink = &webSocketSink{ws: ws}
+	} else {
+		sink = newServerSentEventSink(w, r)
+	}
+	defer sink.close()
+
+	s.serve(connection, sink, missed)
+}
+
+// serve sends the missed events and then the events published, skipping those sent already
+func (s *EventStream) serve(connection *eventConnection, sink eventSink, missed []Event) {
+	sent := make(map[string]bool, len(missed))
+	for _, event := range missed {
+		id := EventID(event)
+		if err := sink.send(id, event); err != nil {
+			return
+		}
+		sent[id] = true
+	}
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event := <-connection.events:
+			id := EventID(event)
+			if sent[id] {
+				delete(sent, id)
+				continue
+			}
+			if err := sink.send(id, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := sink.heartbeat(); err != nil {
+				return
+			}
+		case <-connection.closed:
+			return
+		case <-sink.done():
+			return
+		}
+	}
+}
+
+// publish passes an event to the clients accepting it, disconnecting those whose buffer is full
+func (s *EventStream) publish(event Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for connection := range s.connections {
+		if !connection.accepts(event) {
+			continue
+		}
+		select {
+		case connection.events <- event:
+		default:
+			s.logger.Warn("Disconnecting a client of the event stream too slow to take event %s", event.Type())
+			connection.close()
+		}
+	}
+	return nil
+}
+
+// connect registers the client of a request, it returns nil once the stream is closed
+func (s *EventStream) connect(r *http.Request) *eventConnection {
+	query := r.URL.Query()
+	connection := &eventConnection{
+		types:          query["type"],
+		aggregateTypes: query["aggregateType"],
+		aggregateIDs:   query["aggregateId"],
+		principal:      PrincipalOf(r.Context()),
+		authorize:      s.authorize,
+		events:         make(chan Event, max(s.bufferSize, 1)),
+		closed:         make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.connections[connection] = true
+	return connection
+}
+
+func (s *EventStream) disconnect(connection *eventConnection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.connections, connection)
+	connection.close()
+}
+
+// missed returns the events a client accepts that were logged after the last one it received
+func (s *EventStream) missed(r *http.Request, connection *eventConnection) ([]Event, error) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	log := s.eventLog(r)
+	if lastEventID == "" || log == nil {
+		return nil, nil
+	}
+
+	events, err := log.AllEvents()
+	if err != nil {
+		return nil, err
+	}
+	last := slices.IndexFunc(events, func(event Event) bool { return EventID(event) == lastEventID })
+	if last < 0 {
+		return nil, nil
+	}
+	missed := make([]Event, 0)
+	for _, event := range events[last+1:] {
+		if connection.accepts(event) {
+			missed = append(missed, event)
+		}
+	}
+	return missed, nil
+}
+
+// eventLog returns the replayable event log of the context of the request, nil when there is none
+func (s *EventStream) eventLog(r *http.Request) ReplayableEventLog {
+	s.logOnce.Do(func() {
+		if ctx := GetContext(r); ctx != nil {
+			logs, _ := ResolveAll[EventLog](ctx)
+			for _, log := range logs {
+				if replayable, ok := log.(ReplayableEventLog); ok {
+					s.log = replayable
+					break
+				}
+			}
+		}
+	})
+	return s.log
+}
+
+// eventConnection is a client of an event stream, with the events it chose
+type eventConnection struct {
+	types          []string
+	aggregateTypes []string
+	aggregateIDs   []string
+	principal      *Principal
+	authorize      EventAuthorizer
+	events         chan Event
+	closed         chan struct{}
+	once           sync.Once
+}
+
+// accepts tells whether the client chose an event and may receive it
+func (c *eventConnection) accepts(event Event) bool {
+	if !matchesName(c.types, event.Type()) || !matchesName(c.aggregateTypes, event.AggregateType()) {
+		return false
+	}
+	if len(c.aggregateIDs) > 0 && !slices.Contains(c.aggregateIDs, event.AggregateID().String()) {
+		return false
+	}
+	return c.authorize == nil || c.authorize(c.principal, event)
+}
+
+func (c *eventConnection) close() {
+	c.once.Do(func() { close(c.closed) })
+}
+
+// matchesName tells whether a qualified type name is one of the given names, in full or by its name alone.
+// Any name matches an empty list.
+func matchesName(names []string, qualified string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, name := range names {
+		if name == qualified || name == shortName(qualified) {
+			return true
+		}
+	}
+	return false
+}
+
+// shortName returns a qualified type name without its package
+func shortName(qualified string) string {
+	return qualified[strings.LastIndex(qualified, ".")+1:]
+}
+
+// eventProjection is the json of an event sent to clients, the principal the event was raised on behalf
+// of is left out
+func eventProjection(event Event) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"aggregate_type": event.AggregateType(),
+		"aggregate_id":   event.AggregateID().String(),
+		"event_type":     event.Type(),
+		"time_stamp":     event.TimeStamp(),
+		"payload":        event.Payload(),
+	})
+}
+
+// eventSink sends the events of a connection to its client
+type eventSink interface {
+	send(id string, event Event) error
+	// heartbeat keeps an idle connection open
+	heartbeat() error
+	// done is closed once the client is gone
+	done() <-chan struct{}
+	close()
+}
+
+// serverSentEventSink writes events as a text/event-stream response
+type serverSentEventSink struct {
+	w          http.ResponseWriter
+	r          *http.Request
+	controller *http.ResponseController
+}
+
+func newServerSentEventSink(w http.ResponseWriter, r *http.Request) *serverSentEventSink {
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// Proxies must not buffer the stream
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sink := &serverSentEventSink{w: w, r: r, controller: http.NewResponseController(w)}
+	sink.flush()
+	return sink
+}
+
+func (s *serverSentEventSink) send(id string, event Event) error {
+	data, err := eventProjection(event)
+	if err != nil {
+		return fmt.Errorf("failed to serialize event %s: %w", event.Type(), err)
+	}
+	s.controller.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if _, err := fmt.Fprintf(s.w, "id: %s\nevent: %s\ndata: %s\n\n", id, shortName(event.Type()), data); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *serverSentEventSink) heartbeat() error {
+	s.controller.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if _, err := fmt.Fprint(s.w, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *serverSentEventSink) flush() error {
+	if err := s.controller.Flush(); err != nil && err != http.ErrNotSupported {
+		return err
+	}
+	return nil
+}
+
+func (s *serverSentEventSink) done() <-chan struct{} {
+	return s.r.Context().Done()
+}
+
+func (s *serverSentEventSink) close() {}
+
+// webSocketSink sends events as json text messages
+type webSocketSink struct {
+	ws *webSocket
+}
+
+// streamedEvent is the message a WebSocket client receives for an event
+type streamedEvent struct {
+	ID    string          `json:"id"`
+	Type  string          `json:"type"`
+	Event json.RawMessage `json:"event"`
+}
+
+func (s *webSocketSink) send(id string, event Event) error {
+	data, err := eventProjection(event)
+	if err != nil {
+		return fmt.Errorf("failed to serialize event %s: %w", event.Type(), err)
+	}
+	message, err := json.Marshal(streamedEvent{ID: id, Type: shortName(event.Type()), Event: json.RawMessage(data)})
+	if err != nil {
+		return err
+	}
+	return s.ws.WriteText(message)
+}
+
+func (s *webSocketSink) heartbeat() error {
+	return s.ws.Ping()
+}
+
+func (s *webSocketSink) done() <-chan struct{} {
+	return s.ws.Done()
+}
+
+// close tells the client the server is going away
+func (s *webSocketSink) close() {
+	s.ws.Close(1001)
+}
@@ -0,0 +1,514 @@
+package ddd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HttpMiddleware wraps the handling of requests
+type HttpMiddleware func(next http.Handler) http.Handler
+
+// HttpMiddlewareProvider is a resource stereotype contributing middleware to the routes of its context.
+// Providers wrap each other in the order their resources are declared, unless they are ordered.
+type HttpMiddlewareProvider interface {
+	Wrap(next http.Handler) http.Handler
+}
+
+// Wrap lets an HttpMiddleware function be registered as a resource
+func (m HttpMiddleware) Wrap(next http.Handler) http.Handler {
+	return m(next)
+}
+
+// OrderedHttpMiddleware is a provider choosing its position in the middleware of its context. Lower orders
+// wrap higher ones, providers that are not ordered have order 0.
+type OrderedHttpMiddleware interface {
+	HttpMiddlewareProvider
+	Order() int
+}
+
+type orderedMiddleware struct {
+	HttpMiddleware
+	order int
+}
+
+func (m orderedMiddleware) Order() int {
+	return m.order
+}
+
+// OrderedMiddleware gives a middleware a position in the middleware of its context
+func OrderedMiddleware(order int, middleware HttpMiddleware) OrderedHttpMiddleware {
+	return orderedMiddleware{HttpMiddleware: middleware, order: order}
+}
+
+// EndpointMiddleware is implemented by endpoints wrapping their own routes with middleware, the first
+// middleware being the outermost. It runs inside the middleware of the context.
+type EndpointMiddleware interface {
+	Middleware() []HttpMiddleware
+}
+
+// chainMiddleware wraps a handler with middleware, the first middleware being the outermost
+func chainMiddleware(middleware []HttpMiddleware, handler http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// sortMiddleware orders the middleware providers of a context, keeping the declaration order of equal orders
+func sortMiddleware(providers []HttpMiddlewareProvider) []HttpMiddleware {
+	order := func(provider HttpMiddlewareProvider) int {
+		if ordered, ok := provider.(OrderedHttpMiddleware); ok {
+			return ordered.Order()
+		}
+		return 0
+	}
+	sort.SliceStable(providers, func(i, j int) bool {
+		return order(providers[i]) < order(providers[j])
+	})
+
+	middleware := make([]HttpMiddleware, 0, len(providers))
+	for _, provider := range providers {
+		middleware = append(middleware, provider.Wrap)
+	}
+	return middleware
+}
+
+// responseRecorder records the status and size of a response, it keeps the flushing and hijacking
+// abilities of the writer it wraps
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	if recorder, ok := w.(*responseRecorder); ok {
+		return recorder
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Status returns the status written, 200 when the handler wrote a body without a status
+func (r *responseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// RequestIDHeader is the header carrying the id of a request
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// RequestID returns the id given to a request by RequestIDMiddleware
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware gives every request an id, the one of its X-Request-Id header or a new one.
+// The id is available to handlers with RequestID and is returned in the X-Request-Id response header.
+func RequestIDMiddleware() HttpMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if id == "" {
+				id = GenerateUUID().String()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+// AccessLogMiddleware logs the method, path, status, size and duration of every request
+func AccessLogMiddleware(logger *Logger) HttpMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := newResponseRecorder(w)
+			defer func() {
+				entry := fmt.Sprintf("%s %s %d %dB %v", r.Method, r.URL.RequestURI(), recorder.Status(), recorder.bytes, time.Since(start))
+				if id := RequestID(r.Context()); id != "" {
+					entry += " request-id=" + id
+				}
+				logger.Info("%s", entry)
+			}()
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+// HttpRecoveryMiddleware turns a panic raised while handling a request into an internal server error problem
+func HttpRecoveryMiddleware(logger *Logger) HttpMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := newResponseRecorder(w)
+			defer func() {
+				value := recover()
+				if value == nil {
+					return
+				}
+				if value == http.ErrAbortHandler {
+					// The server aborts the response on purpose
+					panic(value)
+				}
+				logger.Error("recovered from panic while handling %s %s: %v\n%s", r.Method, r.URL.Path, value, debug.Stack())
+				if recorder.status == 0 {
+					WriteProblem(recorder, r, NewProblem(http.StatusInternalServerError, ""))
+				}
+			}()
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+// GzipMiddleware compresses the responses of requests accepting gzip. Responses without a body, and
+// responses the handler encoded itself, are left as they are.
+func GzipMiddleware() HttpMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			writer := &gzipWriter{ResponseWriter: w}
+			defer writer.close()
+			next.ServeHTTP(writer, r)
+		})
+	}
+}
+
+// acceptsGzip tells whether a request accepts gzip encoded responses
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipWriter decides to compress once the status is written
+type gzipWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	header := w.Header()
+	compress := status != http.StatusNoContent && status != http.StatusNotModified && status >= http.StatusOK &&
+		header.Get("Content-Encoding") == ""
+	if compress {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			// Sniff the content type of the uncompressed body
+			w.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.gz.Write(data)
+}
+
+func (w *gzipWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *gzipWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// CorsConfig is the cross-origin resource sharing policy of CorsMiddleware. An allowed origin of "*"
+// allows any origin, allowed methods default to the common request methods and allowed headers to the
+// headers a preflight request asks for. Credentials are only allowed for origins listed explicitly.
+type CorsConfig struct {
+	AllowedOrigins   []string `json:"corsAllowedOrigins"`
+	AllowedMethods   []string `json:"corsAllowedMethods"`
+	AllowedHeaders   []string `json:"corsAllowedHeaders"`
+	ExposedHeaders   []string `json:"corsExposedHeaders"`
+	AllowCredentials bool     `json:"corsAllowCredentials"`
+	MaxAgeSeconds    int      `json:"corsMaxAgeSeconds"`
+}
+
+// NewCorsConfig loads the CORS policy from a json configuration file
+func NewCorsConfig(configPath ...string) *CorsConfig {
+	var path string
+	if configPath == nil {
+		path = os.Getenv("DDD_CORS_CONFIG_PATH")
+		if path == "" {
+			path = "configs/properties.json"
+		}
+	} else {
+		path = configPath[0]
+	}
+	config, err := Configuration[CorsConfig](path)
+	if err != nil {
+		panic(err)
+	}
+	return config
+}
+
+// allows tells whether the policy allows an origin, and whether it lists the origin explicitly
+func (c *CorsConfig) allows(origin string) (allowed bool, listed bool) {
+	for _, allowedOrigin := range c.AllowedOrigins {
+		if strings.EqualFold(allowedOrigin, origin) {
+			return true, true
+		}
+		if allowedOrigin == "*" {
+			allowed = true
+		}
+	}
+	return allowed, false
+}
+
+// CorsMiddleware applies a cross-origin resource sharing policy. Preflight requests are answered by the
+// middleware, requests from origins the policy does not allow are handled without CORS headers.
+func CorsMiddleware(config *CorsConfig) HttpMiddleware {
+	methods := strings.Join(config.AllowedMethods, ", ")
+	if methods == "" {
+		methods = "GET, POST, PUT, PATCH, DELETE, HEAD"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			header := w.Header()
+			header.Add("Vary", "Origin")
+			allowed, listed := config.allows(origin)
+			if origin == "" || !allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header.Set("Access-Control-Allow-Origin", origin)
+			// A wildcard echoes any origin, sharing credentials with it would let any site act as the user
+			if config.AllowCredentials && listed {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			requestedMethod := r.Header.Get("Access-Control-Request-Method")
+			if r.Method != http.MethodOptions || requestedMethod == "" {
+				if len(config.ExposedHeaders) > 0 {
+					header.Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Preflight
+			header.Set("Access-Control-Allow-Methods", methods)
+			if len(config.AllowedHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+			} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				header.Set("Access-Control-Allow-Headers", requested)
+			}
+			if config.MaxAgeSeconds > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAgeSeconds))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// BodyLimitMiddleware rejects request bodies larger than the given number of bytes with a 413 problem
+func BodyLimitMiddleware(maxBytes int64) HttpMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				WriteProblem(w, r, NewProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBytes)))
+				return
+			}
+			if r.Body != nil {
+				// Bodies of unknown length fail to read past the limit, typed handlers answer ErrRequestTooLarge
+				r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TimeoutMiddleware cancels the context of requests running longer than the timeout and answers them with a
+// 503 problem, unless the handler started its response already. Writes of the handler fail after the timeout,
+// a panic of the handler after the timeout is logged with its stack.
+func TimeoutMiddleware(logger *Logger, timeout time.Duration) HttpMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			writer := &timeoutWriter{ResponseWriter: w, header: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan any)
+			returned := make(chan struct{})
+			defer close(returned)
+			go func() {
+				defer func() {
+					if value := recover(); value != nil {
+						select {
+						case panicked <- value:
+						case <-returned:
+							logger.Error("recovered from panic after %s %s timed out: %v\n%s", r.Method, r.URL.Path, value, debug.Stack())
+						}
+					}
+				}()
+				next.ServeHTTP(writer, r)
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case value := <-panicked:
+				// Panics reach the middleware around this one, such as HttpRecoveryMiddleware
+				panic(value)
+			case <-ctx.Done():
+				writer.timeout(r, ctx.Err())
+			}
+		})
+	}
+}
+
+// timeoutWriter stops passing writes once its request timed out. The handler sets headers of its own,
+// copied to the response when it is written, so that they do not race with the timeout response.
+type timeoutWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	wroteHeader bool
+	timedOut    bool
+	mu          sync.Mutex
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.wroteHeader {
+		return
+	}
+	w.writeHeader(status)
+}
+
+// writeHeader copies the headers of the handler and writes the status, the lock is held
+func (w *timeoutWriter) writeHeader(status int) {
+	w.wroteHeader = true
+	header := w.ResponseWriter.Header()
+	for name, values := range w.header {
+		header[name] = values
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !w.wroteHeader {
+		if w.header.Get("Content-Type") == "" {
+			w.header.Set("Content-Type", http.DetectContentType(data))
+		}
+		w.writeHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	if !w.wroteHeader {
+		w.writeHeader(http.StatusOK)
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// timeout answers the request unless the handler responded already
+func (w *timeoutWriter) timeout(r *http.Request, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timedOut = true
+	if !w.wroteHeader && errors.Is(err, context.DeadlineExceeded) {
+		WriteProblem(w.ResponseWriter, r, NewProblem(http.StatusServiceUnavailable, "request timed out"))
+	}
+}
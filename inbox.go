@@ -0,0 +1,271 @@
+package ddd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrMessageInProgress is returned when a message is redelivered while its first delivery is still processed
+var ErrMessageInProgress = errors.New("message already in progress")
+
+// MessageIDExtractor identifies a message from its raw form or the event it translates to
+type MessageIDExtractor func(ctx context.Context, msg []byte, event Event) (string, error)
+
+// HeaderMessageID identifies messages by a header set on the context with WithMessageHeaders
+func HeaderMessageID(name string) MessageIDExtractor {
+	return func(ctx context.Context, msg []byte, event Event) (string, error) {
+		if id := GetMessageHeaders(ctx)[name]; id != "" {
+			return id, nil
+		}
+		return "", fmt.Errorf("message has no header %s", name)
+	}
+}
+
+// JsonFieldMessageID identifies json messages by a field, nested fields are separated with dots
+func JsonFieldMessageID(path string) MessageIDExtractor {
+	field := JsonFieldDiscriminator(path)
+	return func(ctx context.Context, msg []byte, event Event) (string, error) {
+		return field(ctx, msg)
+	}
+}
+
+// EventMessageID identifies messages by the aggregate, type and timestamp of their event
+func EventMessageID() MessageIDExtractor {
+	return func(ctx context.Context, msg []byte, event Event) (string, error) {
+		return EventID(event), nil
+	}
+}
+
+// Inbox remembers the messages a consumer processed for a retention window, so that
+// redelivered messages are acknowledged without dispatching their event again
+type Inbox interface {
+	// Processed tells whether a message was processed within the retention window
+	Processed(id string) (bool, error)
+	// MarkProcessed records that a message was processed
+	MarkProcessed(id string) error
+}
+
+// inbox checks and records the messages of a consumer, guarding against concurrent deliveries of a message
+type inbox struct {
+	store     Inbox
+	extractor MessageIDExtractor
+	inFlight  sync.Map
+}
+
+// claim returns the id of a message not processed yet, or an empty id for a duplicate
+func (i *inbox) claim(ctx context.Context, msg []byte, event Event) (string, error) {
+	id, err := i.extractor(ctx, msg, event)
+	if err != nil {
+		return "", Fatal(fmt.Errorf("%w: %w", ErrInvalidMessage, err))
+	}
+
+	if _, busy := i.inFlight.LoadOrStore(id, struct{}{}); busy {
+		return "", fmt.Errorf("%w: %s", ErrMessageInProgress, id)
+	}
+
+	processed, err := i.store.Processed(id)
+	if err != nil || processed {
+		i.inFlight.Delete(id)
+		return "", err
+	}
+	return id, nil
+}
+
+// release records the outcome of a claimed message, it is marked processed on success only
+func (i *inbox) release(id string, err error) error {
+	defer i.inFlight.Delete(id)
+	if err != nil {
+		return err
+	}
+	if err := i.store.MarkProcessed(id); err != nil {
+		return fmt.Errorf("failed to mark message %s processed: %w", id, err)
+	}
+	return nil
+}
+
+// pruneProcessed removes the ids processed before the cutoff
+func pruneProcessed(processed map[string]time.Time, cutoff time.Time) {
+	for id, at := range processed {
+		if at.Before(cutoff) {
+			delete(processed, id)
+		}
+	}
+}
+
+//-------------------------------------------------------------
+// In-memory inbox
+//-------------------------------------------------------------
+
+// inMemoryInbox keeps processed message ids in memory
+type inMemoryInbox struct {
+	retention time.Duration
+	processed map[string]time.Time
+	mu        sync.Mutex
+}
+
+// NewInMemoryInbox creates a new in-memory inbox remembering messages for the given retention
+func NewInMemoryInbox(retention time.Duration) Inbox {
+	return &inMemoryInbox{
+		retention: retention,
+		processed: make(map[string]time.Time),
+	}
+}
+
+func (i *inMemoryInbox) Processed(id string) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	at, ok := i.processed[id]
+	return ok && time.Since(at) < i.retention, nil
+}
+
+func (i *inMemoryInbox) MarkProcessed(id string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	pruneProcessed(i.processed, now.Add(-i.retention))
+	i.processed[id] = now
+	return nil
+}
+
+//-------------------------------------------------------------
+// File inbox
+//-------------------------------------------------------------
+
+// inboxCompactEvery is the number of journaled messages after which the file inbox is compacted
+const inboxCompactEvery = 1000
+
+// fileInbox keeps processed message ids in a file, so that duplicates are recognized across restarts.
+// Processed messages are appended to a journal, which is folded into the inbox file once it grows.
+type fileInbox struct {
+	filePath    string
+	journalPath string
+	retention   time.Duration
+	processed   map[string]time.Time
+	journaled   int
+	mu          sync.Mutex
+}
+
+// inboxRecord is a line of the file inbox journal
+type inboxRecord struct {
+	ID string    `json:"id"`
+	At time.Time `json:"at"`
+}
+
+// NewFileInbox opens the inbox stored in the given directory, remembering messages for the given retention
+func NewFileInbox(dir string, retention time.Duration) (Inbox, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create inbox directory: %w", err)
+	}
+
+	inbox := &fileInbox{
+		filePath:    filepath.Join(dir, "inbox.json"),
+		journalPath: filepath.Join(dir, "inbox.journal"),
+		retention:   retention,
+		processed:   make(map[string]time.Time),
+	}
+
+	data, err := os.ReadFile(inbox.filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read inbox: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &inbox.processed); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal inbox: %w", err)
+		}
+	}
+
+	journal, err := os.ReadFile(inbox.journalPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read inbox journal: %w", err)
+	}
+	for _, line := range bytes.Split(journal, []byte("\n")) {
+		var record inboxRecord
+		// A line cut short by a crash is skipped, its message was not acknowledged
+		if json.Unmarshal(line, &record) == nil {
+			inbox.processed[record.ID] = record.At
+		}
+	}
+
+	if err := inbox.compact(time.Now()); err != nil {
+		return nil, err
+	}
+	return inbox, nil
+}
+
+func (i *fileInbox) Processed(id string) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	at, ok := i.processed[id]
+	return ok && time.Since(at) < i.retention, nil
+}
+
+func (i *fileInbox) MarkProcessed(id string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	if err := i.append(inboxRecord{ID: id, At: now}); err != nil {
+		return fmt.Errorf("failed to write inbox journal: %w", err)
+	}
+	i.processed[id] = now
+	i.journaled++
+
+	if i.journaled >= inboxCompactEvery {
+		// The message is recorded in the journal, a failed compaction is tried again later
+		if err := i.compact(now); err != nil {
+			NewLogger().Warn("Failed to compact inbox %s: %v", i.filePath, err)
+		}
+	}
+	return nil
+}
+
+// append writes a record at the end of the journal, the lock is held
+func (i *fileInbox) append(record inboxRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(i.journalPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// compact prunes expired messages, writes the inbox file and empties the journal, the lock is held
+// or the inbox is being opened. A crash before the journal is emptied replays it again.
+func (i *fileInbox) compact(now time.Time) error {
+	pruneProcessed(i.processed, now.Add(-i.retention))
+
+	data, err := json.Marshal(i.processed)
+	if err != nil {
+		return fmt.Errorf("failed to marshal inbox: %w", err)
+	}
+	if err := writeFileAtomic(i.filePath, data); err != nil {
+		return fmt.Errorf("failed to write inbox: %w", err)
+	}
+	if err := os.Remove(i.journalPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove inbox journal: %w", err)
+	}
+	i.journaled = 0
+	return nil
+}
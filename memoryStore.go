@@ -0,0 +1,68 @@
+package ddd
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps items by ID in memory, listed by the time returned by at. It backs the in-memory
+// dead letter store and parking lot.
+type memoryStore[T any] struct {
+	items    map[string]*T
+	at       func(item *T) time.Time
+	notFound error
+	mu       sync.RWMutex
+}
+
+func newMemoryStore[T any](at func(item *T) time.Time, notFound error) *memoryStore[T] {
+	return &memoryStore[T]{
+		items:    make(map[string]*T),
+		at:       at,
+		notFound: notFound,
+	}
+}
+
+func (s *memoryStore[T]) put(id string, item *T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[id] = item
+}
+
+func (s *memoryStore[T]) get(id string) (*T, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", s.notFound, id)
+	}
+	return item, nil
+}
+
+func (s *memoryStore[T]) list() []*T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*T, 0, len(s.items))
+	for _, item := range s.items {
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return s.at(result[i]).Before(s.at(result[j]))
+	})
+	return result
+}
+
+func (s *memoryStore[T]) remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[id]; !ok {
+		return fmt.Errorf("%w: %s", s.notFound, id)
+	}
+	delete(s.items, id)
+	return nil
+}
@@ -3,12 +3,17 @@ package ddd
 import (
 	"context"
 	"errors"
+	"fmt"
+	"runtime/debug"
 
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// ErrInvalidMessage wraps the errors of translating a message into an event
+var ErrInvalidMessage = errors.New("invalid message")
+
 // MessageSourceKey is the type for the message source context key
 type MessageSourceKey struct{}
 
@@ -21,7 +26,9 @@ type MessageConsumer interface {
 	// SetEventBus attaches an EventBus to the consumer
 	SetEventBus(eventBus *EventBus)
 
-	// ProcessMessage handles a single message from the source
+	// ProcessMessage handles a single message from the source. It returns once every handler of the
+	// translated event succeeded, or with the errors of those that gave up, so that the message can
+	// be acknowledged or rejected accordingly.
 	ProcessMessage(ctx context.Context, msg []byte) error
 
 	// Start begins the message consumption process
@@ -41,6 +48,8 @@ type MessageTranslator func(from []byte) (Event, error)
 type baseMessageConsumer struct {
 	target     string
 	translator MessageTranslator
+	registry   *TranslatorRegistry
+	inbox      *inbox
 	running    atomic.Bool
 	eventBus   *EventBus
 	mutex      sync.RWMutex
@@ -55,6 +64,23 @@ func NewBaseMessageConsumer(target string, translator MessageTranslator) *baseMe
 	}
 }
 
+// WithTranslatorRegistry routes messages to the translators of a registry instead of the single translator
+func (c *baseMessageConsumer) WithTranslatorRegistry(registry *TranslatorRegistry) *baseMessageConsumer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.registry = registry
+	return c
+}
+
+// WithInbox skips messages already processed according to the inbox, identified by the given extractor.
+// Duplicates are acknowledged without dispatching their event, a message is recorded once all its handlers succeeded.
+func (c *baseMessageConsumer) WithInbox(store Inbox, extractor MessageIDExtractor) *baseMessageConsumer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.inbox = &inbox{store: store, extractor: extractor}
+	return c
+}
+
 // Target returns the name of the targeted message source
 func (c *baseMessageConsumer) Target() string {
 	return c.target
@@ -102,34 +128,63 @@ func (c *baseMessageConsumer) Running() bool {
 	return c.running.Load()
 }
 
-// ProcessMessage handles a single message
+// ProcessMessage translates a message, dispatches the event and waits for its handlers
 func (c *baseMessageConsumer) ProcessMessage(ctx context.Context, msg []byte) error {
 	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	translator, registry, inbox, eventBus := c.translator, c.registry, c.inbox, c.eventBus
+	c.mutex.RUnlock()
 
 	if !c.running.Load() {
 		return errors.New("cannot process message: consumer not running")
 	}
 
-	if c.translator == nil {
+	if translator == nil && registry == nil {
 		return errors.New("cannot process message: translator not set")
 	}
 
-	if c.eventBus == nil {
+	if eventBus == nil {
 		return errors.New("cannot process message: event bus not set")
 	}
 
-	event, err := c.translator(msg)
+	var event Event
+	var err error
+	if registry != nil {
+		if _, ok := GetMessageSource(ctx); !ok {
+			ctx = context.WithValue(ctx, MessageSourceKey{}, c.target)
+		}
+		event, err = registry.Translate(ctx, msg)
+	} else {
+		event, err = translator(msg)
+	}
+	if errors.Is(err, ErrMessageParked) {
+		// The parking lot keeps the message, the message can be acknowledged
+		return nil
+	}
 	if err != nil {
-		return err
+		// An invalid message fails again on redelivery
+		return Fatal(fmt.Errorf("%w: %w", ErrInvalidMessage, err))
 	}
 
-	// Enhance the context with message source information
-	// Use a proper type instead of string as key
-	// msgCtx := context.WithValue(ctx, MessageSourceKey{}, c.target)
+	if inbox == nil {
+		return dispatchAndWait(ctx, eventBus, event)
+	}
 
-	// Dispatch the event with context
-	return c.eventBus.Dispatch(event)
+	id, err := inbox.claim(ctx, msg, event)
+	if err != nil || id == "" {
+		// A duplicate has no id, it is acknowledged
+		return err
+	}
+	return inbox.release(id, dispatchAndWait(ctx, eventBus, event))
+}
+
+// dispatchAndWait dispatches an event and waits for its handlers. An event spilled to disk is
+// acknowledged, the event bus handles it once the queue drains.
+func dispatchAndWait(ctx context.Context, eventBus *EventBus, event Event) error {
+	err := eventBus.DispatchWithResult(event).Wait(ctx)
+	if errors.Is(err, ErrDeliveryUntracked) {
+		return nil
+	}
+	return err
 }
 
 //-------------------------------------------------------------
@@ -142,6 +197,7 @@ type InMemoryMessageConsumer struct {
 	log        *Logger
 	channel    chan string
 	processing chan string
+	redelivery RetryPolicy
 	stopWait   sync.WaitGroup
 	ctx        context.Context    // Internal context for goroutine management
 	cancel     context.CancelFunc // Cancel function for cleanup
@@ -158,9 +214,18 @@ func NewInMemoryMessageConsumer(target string, translator MessageTranslator, cha
 		log:                 NewLogger(),
 		baseMessageConsumer: base,
 		channel:             channel,
+		redelivery:          NoRetry(),
 	}
 }
 
+// WithRedelivery sets how failed messages are redelivered, they are not redelivered otherwise since the event bus
+// already retries the handlers.
+// Redelivery dispatches the event again to all its handlers, including those that already succeeded.
+func (c *InMemoryMessageConsumer) WithRedelivery(policy RetryPolicy) *InMemoryMessageConsumer {
+	c.redelivery = policy
+	return c
+}
+
 // OnStart begins consuming messages from the channel
 func (c *InMemoryMessageConsumer) OnStart() error {
 	// Call the base implementation first
@@ -208,14 +273,7 @@ func (c *InMemoryMessageConsumer) OnStart() error {
 					return // Channel closed
 				}
 
-				// Create a derived context for each message
-				msgCtx, cancel := context.WithCancel(c.ctx)
-				err := c.ProcessMessage(msgCtx, []byte(jsonString))
-				cancel() // Clean up the message context
-
-				if err != nil {
-					c.log.Error("Error processing message: %v", err)
-				}
+				c.deliver([]byte(jsonString))
 			}
 		}
 	}()
@@ -224,6 +282,44 @@ func (c *InMemoryMessageConsumer) OnStart() error {
 	return nil
 }
 
+// deliver processes a message, redelivering it with backoff while it fails and the redelivery policy allows
+func (c *InMemoryMessageConsumer) deliver(msg []byte) {
+	maxAttempts := c.redelivery.attempts()
+	for attempt := 1; ; attempt++ {
+		// Create a derived context for each delivery
+		msgCtx, cancel := context.WithCancel(c.ctx)
+		err := c.processSafely(msgCtx, msg)
+		cancel() // Clean up the message context
+
+		if err == nil {
+			return
+		}
+		if attempt >= maxAttempts || !c.redelivery.retryable(err) {
+			c.log.Error("Error processing message after %d attempt(s): %v", attempt, err)
+			return
+		}
+
+		backoff := c.redelivery.Backoff(attempt)
+		c.log.Warn("Error processing message (attempt %d/%d), redelivering in %v: %v", attempt, maxAttempts, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// processSafely processes a message, turning a panic into an error so that the consumer keeps running
+func (c *InMemoryMessageConsumer) processSafely(ctx context.Context, msg []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+			c.log.Error("Recovered from panic while processing message: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return c.ProcessMessage(ctx, msg)
+}
+
 // OnDestroy gracefully stops consumption and waits for processing to complete
 func (c *InMemoryMessageConsumer) OnDestroy() error {
 	if !c.Running() {
@@ -272,3 +368,32 @@ func GetMessageSource(ctx context.Context) (string, bool) {
 	source, ok := ctx.Value(MessageSourceKey{}).(string)
 	return source, ok
 }
+
+// messageHeadersKey is the context key of the headers of the message being processed
+type messageHeadersKey struct{}
+
+// messageTypeKey is the context key of the type attribute of the message being processed
+type messageTypeKey struct{}
+
+// WithMessageHeaders returns a context carrying the headers of the message being processed
+func WithMessageHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, messageHeadersKey{}, headers)
+}
+
+// GetMessageHeaders extracts the headers of the message being processed from a context
+func GetMessageHeaders(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(messageHeadersKey{}).(map[string]string)
+	return headers
+}
+
+// WithMessageType returns a context carrying the type attribute of the message being processed,
+// for transports such as AMQP whose messages have one besides their headers
+func WithMessageType(ctx context.Context, messageType string) context.Context {
+	return context.WithValue(ctx, messageTypeKey{}, messageType)
+}
+
+// GetMessageType extracts the type attribute of the message being processed from a context
+func GetMessageType(ctx context.Context) (string, bool) {
+	messageType, ok := ctx.Value(messageTypeKey{}).(string)
+	return messageType, ok && messageType != ""
+}
@@ -0,0 +1,299 @@
+package ddd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrMessagePublisherNotRunning is returned when publishing through a publisher that is not started
+var ErrMessagePublisherNotRunning = errors.New("message publisher not running")
+
+// MessagePublisher represents a component that publishes events as messages to an external target,
+// the outbound counterpart of MessageConsumer. A MessagePublisher is also an EventPublisher,
+// so that an OutboxRelay can publish through it.
+type MessagePublisher interface {
+	// Target returns the name/identifier of the destination this publisher targets
+	Target() string
+
+	// Publish encodes an event and sends it, it returns once the transport confirmed the delivery
+	Publish(event Event) error
+
+	// Start begins accepting messages
+	OnStart() error
+
+	// Stop gracefully stops publishing
+	OnDestroy() error
+
+	// Running returns the current state of the publisher
+	Running() bool
+}
+
+// MessageEncoder converts domain events into raw messages
+type MessageEncoder func(event Event) ([]byte, error)
+
+// JsonMessageEncoder encodes an event in the json form read by EventFromJsonString
+func JsonMessageEncoder(event Event) ([]byte, error) {
+	jsonString, err := event.ToJsonString()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(jsonString), nil
+}
+
+// baseMessagePublisher provides basic functionality for message publishers
+type baseMessagePublisher struct {
+	target  string
+	encoder MessageEncoder
+	running atomic.Bool
+	mutex   sync.RWMutex
+}
+
+// NewBaseMessagePublisher creates a new base message publisher, events are encoded in json when no encoder is given
+func NewBaseMessagePublisher(target string, encoder MessageEncoder) *baseMessagePublisher {
+	if encoder == nil {
+		encoder = JsonMessageEncoder
+	}
+	return &baseMessagePublisher{
+		target:  target,
+		encoder: encoder,
+	}
+}
+
+// Target returns the name of the targeted destination
+func (p *baseMessagePublisher) Target() string {
+	return p.target
+}
+
+// OnStart begins accepting messages
+func (p *baseMessagePublisher) OnStart() error {
+	p.running.Store(true)
+	return nil
+}
+
+// OnDestroy stops accepting messages
+func (p *baseMessagePublisher) OnDestroy() error {
+	p.running.Store(false)
+	return nil
+}
+
+// Running returns whether the publisher is currently active
+func (p *baseMessagePublisher) Running() bool {
+	return p.running.Load()
+}
+
+// encode checks that the publisher runs and encodes the event
+func (p *baseMessagePublisher) encode(event Event) ([]byte, error) {
+	if !p.Running() {
+		return nil, ErrMessagePublisherNotRunning
+	}
+
+	msg, err := p.encoder(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event %s: %w", event.Type(), err)
+	}
+	return msg, nil
+}
+
+//-------------------------------------------------------------
+// InMemoryMessagePublisher for channel-based message transport
+//-------------------------------------------------------------
+
+// InMemoryMessagePublisher is a MessagePublisher that writes to an in-memory channel,
+// a publish is confirmed once the channel accepted the message
+type InMemoryMessagePublisher struct {
+	*baseMessagePublisher
+	log     *Logger
+	channel chan string
+	stopCh  chan struct{}
+}
+
+// NewInMemoryMessagePublisher creates a new publisher that writes to a string channel
+func NewInMemoryMessagePublisher(target string, encoder MessageEncoder, channel chan string) MessagePublisher {
+	if channel == nil {
+		panic(errors.New("channel cannot be nil"))
+	}
+
+	return &InMemoryMessagePublisher{
+		baseMessagePublisher: NewBaseMessagePublisher(target, encoder),
+		log:                  NewLogger(),
+		channel:              channel,
+	}
+}
+
+// OnStart begins accepting messages
+func (p *InMemoryMessagePublisher) OnStart() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.Running() {
+		return nil // Already running
+	}
+
+	p.stopCh = make(chan struct{})
+	p.baseMessagePublisher.OnStart()
+
+	p.log.Info("Started in-memory message publisher for target %s", p.Target())
+	return nil
+}
+
+// OnDestroy stops accepting messages and releases blocked publishers
+func (p *InMemoryMessagePublisher) OnDestroy() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.Running() {
+		return nil // Already stopped
+	}
+
+	p.baseMessagePublisher.OnDestroy()
+	close(p.stopCh)
+
+	p.log.Info("Stopped in-memory message publisher for target %s", p.Target())
+	return nil
+}
+
+// Publish sends the encoded event to the channel, blocking until it is accepted or the publisher stops
+func (p *InMemoryMessagePublisher) Publish(event Event) error {
+	p.mutex.RLock()
+	stopCh := p.stopCh
+	p.mutex.RUnlock()
+
+	msg, err := p.encode(event)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case p.channel <- string(msg):
+		return nil
+	case <-stopCh:
+		return ErrMessagePublisherNotRunning
+	}
+}
+
+//-------------------------------------------------------------
+// FileSpoolMessagePublisher for file-based message transport
+//-------------------------------------------------------------
+
+// FileSpoolMessagePublisher is a MessagePublisher appending messages to a spool file named after
+// its target, one message per line, for another process to pick up. A publish is confirmed once
+// the message is synced to disk.
+type FileSpoolMessagePublisher struct {
+	*baseMessagePublisher
+	log      *Logger
+	dir      string
+	filePath string
+	file     *os.File
+}
+
+// NewFileSpoolMessagePublisher creates a new publisher spooling messages in the given directory
+func NewFileSpoolMessagePublisher(target string, encoder MessageEncoder, dir string) MessagePublisher {
+	return &FileSpoolMessagePublisher{
+		baseMessagePublisher: NewBaseMessagePublisher(target, encoder),
+		log:                  NewLogger(),
+		dir:                  dir,
+		filePath:             filepath.Join(dir, target+".spool"),
+	}
+}
+
+// SpoolPath returns the path of the spool file
+func (p *FileSpoolMessagePublisher) SpoolPath() string {
+	return p.filePath
+}
+
+// OnStart opens the spool file
+func (p *FileSpoolMessagePublisher) OnStart() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.Running() {
+		return nil // Already running
+	}
+
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	file, err := os.OpenFile(p.filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open spool file: %w", err)
+	}
+	p.file = file
+	p.baseMessagePublisher.OnStart()
+
+	p.log.Info("Started file spool message publisher for target %s", p.Target())
+	return nil
+}
+
+// OnDestroy closes the spool file
+func (p *FileSpoolMessagePublisher) OnDestroy() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.Running() {
+		return nil // Already stopped
+	}
+
+	p.baseMessagePublisher.OnDestroy()
+	if err := p.file.Close(); err != nil {
+		return fmt.Errorf("failed to close spool file: %w", err)
+	}
+
+	p.log.Info("Stopped file spool message publisher for target %s", p.Target())
+	return nil
+}
+
+// Publish appends the encoded event to the spool file and syncs it
+func (p *FileSpoolMessagePublisher) Publish(event Event) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	msg, err := p.encode(event)
+	if err != nil {
+		return err
+	}
+	for _, b := range msg {
+		if b == '\n' {
+			return fmt.Errorf("cannot spool event %s: encoded message spans several lines", event.Type())
+		}
+	}
+
+	if _, err := p.file.Write(append(msg, '\n')); err != nil {
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spool file: %w", err)
+	}
+	return nil
+}
+
+//-------------------------------------------------------------
+// Event bus bridge
+//-------------------------------------------------------------
+
+// messagePublishingHandler is an EventHandler forwarding events to a message publisher
+type messagePublishingHandler struct {
+	publisher  MessagePublisher
+	eventTypes []string
+}
+
+// PublishEvents bridges the event bus to a message publisher: the returned event handler forwards
+// the events of the given types to the publisher. Types may be any subscription key, such as
+// AllEvents or AggregateEvents. A failed publish is retried like any failing handler.
+func PublishEvents(publisher MessagePublisher, eventTypes ...string) EventHandler {
+	return &messagePublishingHandler{
+		publisher:  publisher,
+		eventTypes: eventTypes,
+	}
+}
+
+func (h *messagePublishingHandler) SubscribedTo() map[string]HandleEvent {
+	subscriptions := make(map[string]HandleEvent, len(h.eventTypes))
+	for _, eventType := range h.eventTypes {
+		subscriptions[eventType] = h.publisher.Publish
+	}
+	return subscriptions
+}
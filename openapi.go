@@ -0,0 +1,507 @@
+package ddd
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// OpenApiConfig holds where the server serves the OpenAPI document of its endpoints.
+// The document is served when a path is set, and the documentation page when a docs path is set.
+type OpenApiConfig struct {
+	Path       string `json:"serverOpenApiPath"`
+	DocsPath   string `json:"serverDocsPath"`
+	ApiTitle   string `json:"serverApiTitle"`
+	ApiVersion string `json:"serverApiVersion"`
+}
+
+// SecurityScheme is an OpenAPI security scheme, such as
+//
+//	SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+//	SecurityScheme{Type: "apiKey", In: "header", Name: "X-Api-Key"}
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// openApiGenerator builds an OpenAPI 3.1 document from the operations of the endpoints of contexts
+type openApiGenerator struct {
+	schemes map[string]SecurityScheme
+	schemas map[string]any
+	names   map[reflect.Type]string
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	bytesType       = reflect.TypeOf([]byte{})
+	responsePtrType = reflect.TypeOf((*Response)(nil))
+	problemPtrType  = reflect.TypeOf((*Problem)(nil))
+	marshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	routeVariable   = regexp.MustCompile(`\{([^}:]+)(?::([^}]*))?\}`)
+	unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// generateOpenApi returns the OpenAPI document of the endpoints of the given contexts
+func generateOpenApi(config OpenApiConfig, schemes map[string]SecurityScheme, contexts []*Context) (map[string]any, error) {
+	g := &openApiGenerator{
+		schemes: schemes,
+		schemas: map[string]any{"Problem": problemSchema()},
+		names:   map[reflect.Type]string{problemPtrType.Elem(): "Problem"},
+	}
+
+	paths := make(map[string]map[string]any)
+	tags := make([]map[string]any, 0, len(contexts))
+	for _, ctx := range contexts {
+		endpoints, err := ResolveAll[Endpoint](ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve endpoints of context '%s': %w", ctx.Name(), err)
+		}
+		tags = append(tags, map[string]any{"name": ctx.Name()})
+
+		for _, endpoint := range endpoints {
+			for _, operation := range endpoint.Operations() {
+				path := routeVariable.ReplaceAllString(operation.Template, "{$1}")
+				if paths[path] == nil {
+					paths[path] = make(map[string]any)
+				}
+				paths[path][strings.ToLower(string(operation.Method))] = g.operation(ctx.Name(), operation)
+			}
+		}
+	}
+
+	components := map[string]any{"schemas": g.schemas}
+	document := map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   valueOr(config.ApiTitle, "API"),
+			"version": valueOr(config.ApiVersion, "1.0.0"),
+		},
+		"tags":       tags,
+		"paths":      paths,
+		"components": components,
+	}
+
+	if len(g.schemes) > 0 {
+		components["securitySchemes"] = g.schemes
+	}
+	return document, nil
+}
+
+// security describes the requirements of a route refusing anonymous requests, any of the schemes satisfies them
+func (g *openApiGenerator) security(operation Operation, result map[string]any, responses map[string]any) {
+	if !operation.requiresPrincipal() {
+		return
+	}
+	if len(g.schemes) > 0 {
+		security := make([]map[string][]string, 0, len(g.schemes))
+		for _, name := range sortedKeys(g.schemes) {
+			security = append(security, map[string][]string{name: {}})
+		}
+		result["security"] = security
+	}
+	if len(operation.Roles) > 0 {
+		result["x-required-roles"] = operation.Roles
+	}
+	if len(operation.Permissions) > 0 {
+		result["x-required-permissions"] = operation.Permissions
+	}
+
+	problem := map[string]any{ProblemContentType: map[string]any{"schema": ref("Problem")}}
+	responses["401"] = map[string]any{"description": "Authentication is required", "content": problem}
+	if len(operation.Roles) > 0 || len(operation.Permissions) > 0 {
+		responses["403"] = map[string]any{"description": "The principal lacks the required roles or permissions", "content": problem}
+	}
+}
+
+// operation describes a route
+func (g *openApiGenerator) operation(tag string, operation Operation) map[string]any {
+	result := map[string]any{"tags": []string{tag}}
+	if operation.Summary != "" {
+		result["summary"] = operation.Summary
+	}
+	if operation.Name != "" {
+		result["operationId"] = operation.Name
+	}
+
+	if parameters := g.parameters(operation); len(parameters) > 0 {
+		result["parameters"] = parameters
+	}
+
+	responses := make(map[string]any)
+	g.security(operation, result, responses)
+	if operation.RateLimit != nil || operation.MaxInFlight > 0 || operation.MaxInFlightPerClient > 0 {
+		responses["429"] = map[string]any{
+			"description": "The client exceeded a rate or concurrency limit",
+			"content":     map[string]any{ProblemContentType: map[string]any{"schema": ref("Problem")}},
+		}
+	}
+	if operation.Response == nil {
+		responses["default"] = map[string]any{"description": "Response written by the handler"}
+		result["responses"] = responses
+		return result
+	}
+
+	if body := g.requestBody(operation); body != nil {
+		result["requestBody"] = body
+	}
+
+	status := http.StatusOK
+	if operation.Method == POST {
+		status = http.StatusCreated
+	}
+	if operation.Response == responsePtrType {
+		// The handler chooses the status and the body
+		responses["2XX"] = map[string]any{"description": "Success"}
+	} else {
+		success := map[string]any{"description": http.StatusText(status)}
+		if schema := g.schema(operation.Response); len(schema) > 0 {
+			success["content"] = map[string]any{"application/json": map[string]any{"schema": schema}}
+		}
+		responses[fmt.Sprint(status)] = success
+	}
+
+	problem := map[string]any{ProblemContentType: map[string]any{"schema": ref("Problem")}}
+	switch operation.Method {
+	case GET:
+		responses["304"] = map[string]any{"description": "The representation named by If-None-Match did not change"}
+	case PUT, PATCH, DELETE:
+		responses["412"] = map[string]any{"description": "The resource changed since the version named by If-Match", "content": problem}
+	}
+	if operation.Request != nil {
+		responses["400"] = map[string]any{"description": "The request cannot be decoded", "content": problem}
+	}
+	if result["requestBody"] != nil {
+		responses["415"] = map[string]any{"description": "The content type of the request is not supported", "content": problem}
+	}
+	responses["default"] = map[string]any{"description": "Error", "content": problem}
+	result["responses"] = responses
+	return result
+}
+
+// parameters describes the path variables of a route and the query and header parameters of its request
+func (g *openApiGenerator) parameters(operation Operation) []map[string]any {
+	fields := make(map[string]reflect.StructField)
+	request := derefType(operation.Request)
+	if request != nil && request.Kind() == reflect.Struct {
+		for _, field := range exportedFields(request) {
+			if name, ok := field.Tag.Lookup("path"); ok {
+				fields["path:"+name] = field
+			} else if name, ok := field.Tag.Lookup("query"); ok {
+				fields["query:"+name] = field
+			} else if name, ok := field.Tag.Lookup("header"); ok {
+				fields["header:"+name] = field
+			}
+		}
+	}
+
+	parameters := make([]map[string]any, 0)
+	for _, match := range routeVariable.FindAllStringSubmatch(operation.Template, -1) {
+		schema := map[string]any{"type": "string"}
+		if field, ok := fields["path:"+match[1]]; ok {
+			schema = g.schema(field.Type)
+		} else if match[2] != "" {
+			schema["pattern"] = "^" + match[2] + "$"
+		}
+		parameters = append(parameters, map[string]any{"name": match[1], "in": "path", "required": true, "schema": schema})
+	}
+
+	for _, key := range sortedKeys(fields) {
+		in, name, _ := strings.Cut(key, ":")
+		if in == "query" || in == "header" {
+			parameters = append(parameters, map[string]any{"name": name, "in": in, "schema": g.schema(fields[key].Type)})
+		}
+	}
+	return parameters
+}
+
+// requestBody describes the body of a typed request, without its parameter fields
+func (g *openApiGenerator) requestBody(operation Operation) map[string]any {
+	request := derefType(operation.Request)
+	if request == nil || operation.Method == GET || operation.Method == DELETE || operation.Method == HEAD {
+		return nil
+	}
+
+	var schema map[string]any
+	if request.Kind() == reflect.Struct && hasParameterFields(request) {
+		schema = g.structSchema(request, true)
+		if properties, _ := schema["properties"].(map[string]any); len(properties) == 0 {
+			return nil
+		}
+	} else {
+		schema = g.schema(operation.Request)
+	}
+	content := map[string]any{"application/json": map[string]any{"schema": schema}}
+	if form := g.formSchema(request); form != nil {
+		content["application/x-www-form-urlencoded"] = map[string]any{"schema": form}
+	}
+	return map[string]any{"content": content}
+}
+
+// formSchema describes the fields of a request bound from form bodies, nil when it has none
+func (g *openApiGenerator) formSchema(request reflect.Type) map[string]any {
+	if request.Kind() != reflect.Struct {
+		return nil
+	}
+	properties := make(map[string]any)
+	for _, field := range exportedFields(request) {
+		if name, ok := field.Tag.Lookup("form"); ok {
+			properties[name] = g.schema(field.Type)
+		}
+	}
+	if len(properties) == 0 {
+		return nil
+	}
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+// schema reflects the json schema of a type, named structs are described once as components
+func (g *openApiGenerator) schema(typ reflect.Type) map[string]any {
+	switch {
+	case typ == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case typ == rawMessageType:
+		return map[string]any{}
+	case typ == bytesType:
+		return map[string]any{"type": "string", "contentEncoding": "base64"}
+	case typ.Kind() != reflect.Ptr && typ != problemPtrType.Elem() &&
+		(typ.Implements(marshalerType) || reflect.PointerTo(typ).Implements(marshalerType)):
+		// The json form of the type is its own
+		return map[string]any{}
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return g.schema(typ.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(typ.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(typ.Elem())}
+	case reflect.Struct:
+		if typ.Name() == "" {
+			return g.structSchema(typ, false)
+		}
+		if name, ok := g.names[typ]; ok {
+			return ref(name)
+		}
+		name := g.componentName(typ)
+		g.names[typ] = name
+		// The name is taken before the fields are described, so that nested structs do not reuse it
+		g.schemas[name] = map[string]any{}
+		g.schemas[name] = g.structSchema(typ, false)
+		return ref(name)
+	default:
+		// Interfaces and other kinds may hold any value
+		return map[string]any{}
+	}
+}
+
+// structSchema describes the json fields of a struct, the fields bound to parameters are skipped for bodies
+func (g *openApiGenerator) structSchema(typ reflect.Type, body bool) map[string]any {
+	properties := make(map[string]any)
+	required := make([]string, 0)
+	for _, field := range exportedFields(typ) {
+		if body && isParameterField(field) {
+			continue
+		}
+		name, omitEmpty, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+		properties[name] = g.schema(field.Type)
+		if !omitEmpty && field.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// componentName names the component of a struct by its type name. A struct named like the component of a
+// struct in another package is qualified with its package, e.g. model_User.
+func (g *openApiGenerator) componentName(typ reflect.Type) string {
+	name := unsafeNameChars.ReplaceAllString(typ.Name(), "_")
+	if g.schemas[name] == nil {
+		return name
+	}
+
+	base := unsafeNameChars.ReplaceAllString(path.Base(typ.PkgPath())+"_"+typ.Name(), "_")
+	name = base
+	for i := 2; g.schemas[name] != nil; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	return name
+}
+
+// exportedFields returns the exported fields of a struct, with the fields of embedded structs flattened
+func exportedFields(typ reflect.Type) []reflect.StructField {
+	fields := make([]reflect.StructField, 0, typ.NumField())
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		if field.Anonymous && derefType(field.Type).Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			fields = append(fields, exportedFields(derefType(field.Type))...)
+			continue
+		}
+		if field.IsExported() {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// jsonFieldName returns the json name of a field and whether it is omitted when empty or always skipped
+func jsonFieldName(field reflect.StructField) (name string, omitEmpty bool, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, strings.Contains(options, "omitempty") || strings.Contains(options, "omitzero"), false
+}
+
+func isParameterField(field reflect.StructField) bool {
+	_, path := field.Tag.Lookup("path")
+	_, query := field.Tag.Lookup("query")
+	_, header := field.Tag.Lookup("header")
+	return path || query || header
+}
+
+func hasParameterFields(typ reflect.Type) bool {
+	for _, field := range exportedFields(typ) {
+		if isParameterField(field) {
+			return true
+		}
+	}
+	return false
+}
+
+func derefType(typ reflect.Type) reflect.Type {
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func valueOr(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// problemSchema describes the problem details of error responses
+func problemSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"type":     map[string]any{"type": "string", "format": "uri-reference"},
+			"title":    map[string]any{"type": "string"},
+			"status":   map[string]any{"type": "integer", "format": "int32"},
+			"detail":   map[string]any{"type": "string"},
+			"instance": map[string]any{"type": "string", "format": "uri-reference"},
+		},
+		"required":             []string{"type", "title", "status"},
+		"additionalProperties": true,
+	}
+}
+
+// docsPage renders the OpenAPI document in the browser without loading anything but the document
+var docsPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>API documentation</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; color: #222; }
+.operation { border: 1px solid #ddd; border-radius: 4px; margin: 0.5em 0; }
+.operation summary { cursor: pointer; padding: 0.5em; }
+.method { display: inline-block; width: 5em; font-weight: bold; text-transform: uppercase; }
+.operation div { padding: 0 1em 1em; }
+pre { background: #f6f6f6; padding: 0.5em; overflow: auto; }
+</style>
+</head>
+<body>
+<h1 id="title"></h1>
+<div id="operations"></div>
+<script>
+const specUrl = {{.}};
+fetch(specUrl).then(response => response.json()).then(spec => {
+  document.getElementById("title").textContent = spec.info.title + " " + spec.info.version;
+  const container = document.getElementById("operations");
+  const resolve = schema => {
+    if (schema && schema.$ref) {
+      return spec.components.schemas[schema.$ref.split("/").pop()];
+    }
+    return schema;
+  };
+  for (const tag of spec.tags || []) {
+    const heading = document.createElement("h2");
+    heading.textContent = tag.name;
+    container.appendChild(heading);
+    for (const [path, operations] of Object.entries(spec.paths)) {
+      for (const [method, operation] of Object.entries(operations)) {
+        if (!(operation.tags || []).includes(tag.name)) continue;
+        const details = document.createElement("details");
+        details.className = "operation";
+        const summary = document.createElement("summary");
+        summary.innerHTML = "<span class=method></span><code></code> <em></em>";
+        summary.querySelector(".method").textContent = method;
+        summary.querySelector("code").textContent = path;
+        summary.querySelector("em").textContent = operation.summary || "";
+        details.appendChild(summary);
+        const body = document.createElement("div");
+        const sections = {
+          parameters: operation.parameters,
+          requestBody: operation.requestBody && resolve(Object.values(operation.requestBody.content)[0].schema),
+          responses: Object.fromEntries(Object.entries(operation.responses).map(([status, response]) =>
+            [status, response.content ? resolve(Object.values(response.content)[0].schema) : response.description]))
+        };
+        for (const [name, value] of Object.entries(sections)) {
+          if (!value) continue;
+          const title = document.createElement("h4");
+          title.textContent = name;
+          const pre = document.createElement("pre");
+          pre.textContent = JSON.stringify(value, null, 2);
+          body.append(title, pre);
+        }
+        details.appendChild(body);
+        container.appendChild(details);
+      }
+    }
+  }
+});
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,591 @@
+package ddd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrOutboxEntryNotFound is returned when an outbox entry does not exist
+var ErrOutboxEntryNotFound = errors.New("outbox entry not found")
+
+// OutboxEntry is an event waiting to be published by the outbox relay
+type OutboxEntry struct {
+	ID          string
+	Event       Event
+	RecordedAt  time.Time
+	Attempts    int
+	LastError   string
+	DeliveredAt time.Time
+	ParkedAt    time.Time
+}
+
+// Delivered tells whether the entry was published
+func (e *OutboxEntry) Delivered() bool {
+	return !e.DeliveredAt.IsZero()
+}
+
+// Parked tells whether the entry was set aside after failing too often
+func (e *OutboxEntry) Parked() bool {
+	return !e.ParkedAt.IsZero()
+}
+
+// Outbox stores the events raised by a state change until they are published.
+// Repositories record events through the outbox within the transaction persisting the state change,
+// so that the change and its events are committed together or not at all.
+type Outbox interface {
+	// Record stores events as pending publication
+	Record(events ...Event) error
+	// Pending returns up to limit undelivered entries in recording order
+	Pending(limit int) ([]*OutboxEntry, error)
+	// MarkDelivered marks entries as published
+	MarkDelivered(ids ...string) error
+	// MarkFailed records a failed publication attempt of an entry
+	MarkFailed(id string, cause error) error
+	// Park sets aside an entry that can not be published, it is no longer pending until it is unparked
+	Park(id string) error
+	// Parked returns the parked entries in recording order
+	Parked() ([]*OutboxEntry, error)
+	// Unpark makes parked entries pending again
+	Unpark(ids ...string) error
+	// Cleanup removes entries delivered before the given time and returns how many were removed
+	Cleanup(deliveredBefore time.Time) (int, error)
+}
+
+// newOutboxEntries wraps events into new pending entries
+func newOutboxEntries(events []Event) []*OutboxEntry {
+	now := time.Now()
+	entries := make([]*OutboxEntry, 0, len(events))
+	for _, event := range events {
+		entries = append(entries, &OutboxEntry{
+			ID:         GenerateUUID().String(),
+			Event:      event,
+			RecordedAt: now,
+		})
+	}
+	return entries
+}
+
+//-------------------------------------------------------------
+// In-memory outbox
+//-------------------------------------------------------------
+
+// inMemoryOutbox keeps entries in memory, it suits repositories that keep their state in memory as well
+type inMemoryOutbox struct {
+	entries []*OutboxEntry
+	mu      sync.Mutex
+}
+
+// NewInMemoryOutbox creates a new in-memory outbox
+func NewInMemoryOutbox() Outbox {
+	return &inMemoryOutbox{
+		entries: make([]*OutboxEntry, 0),
+	}
+}
+
+func (o *inMemoryOutbox) Record(events ...Event) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.entries = append(o.entries, newOutboxEntries(events)...)
+	return nil
+}
+
+func (o *inMemoryOutbox) Pending(limit int) ([]*OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return pendingEntries(o.entries, limit), nil
+}
+
+func (o *inMemoryOutbox) MarkDelivered(ids ...string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return markDelivered(o.entries, ids)
+}
+
+func (o *inMemoryOutbox) MarkFailed(id string, cause error) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return markFailed(o.entries, id, cause)
+}
+
+func (o *inMemoryOutbox) Park(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return park(o.entries, id)
+}
+
+func (o *inMemoryOutbox) Parked() ([]*OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return parkedEntries(o.entries), nil
+}
+
+func (o *inMemoryOutbox) Unpark(ids ...string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return unpark(o.entries, ids)
+}
+
+func (o *inMemoryOutbox) Cleanup(deliveredBefore time.Time) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var removed int
+	o.entries, removed = removeDelivered(o.entries, deliveredBefore)
+	return removed, nil
+}
+
+//-------------------------------------------------------------
+// File outbox
+//-------------------------------------------------------------
+
+// FileOutbox is an Outbox persisted in a directory. Besides Record, it offers Commit to write
+// a state file and its events atomically through a write-ahead journal: the journal is written
+// first in a single rename, then applied and removed. A journal left by a crash is applied
+// again when the outbox is opened or read.
+type FileOutbox struct {
+	dir        string
+	filePath   string
+	journalDir string
+	mu         sync.Mutex
+}
+
+// fileOutboxEntry is the stored form of an OutboxEntry
+type fileOutboxEntry struct {
+	ID          string    `json:"id"`
+	Event       string    `json:"event"`
+	RecordedAt  time.Time `json:"recordedAt"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError,omitempty"`
+	DeliveredAt time.Time `json:"deliveredAt,omitempty"`
+	ParkedAt    time.Time `json:"parkedAt,omitempty"`
+}
+
+// outboxJournal is a state change and its events waiting to be applied
+type outboxJournal struct {
+	StatePath string            `json:"statePath"`
+	State     []byte            `json:"state"`
+	Entries   []fileOutboxEntry `json:"entries"`
+}
+
+// NewFileOutbox opens the outbox stored in the given directory
+func NewFileOutbox(dir string) (*FileOutbox, error) {
+	outbox := &FileOutbox{
+		dir:        dir,
+		filePath:   filepath.Join(dir, "outbox.json"),
+		journalDir: filepath.Join(dir, "journal"),
+	}
+
+	if err := os.MkdirAll(outbox.journalDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+	if err := outbox.applyJournals(); err != nil {
+		return nil, err
+	}
+	return outbox, nil
+}
+
+// Commit atomically writes the state file and records its events as pending
+func (o *FileOutbox) Commit(statePath string, state []byte, events ...Event) error {
+	entries, err := toFileOutboxEntries(newOutboxEntries(events))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&outboxJournal{StatePath: statePath, State: state, Entries: entries})
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox journal: %w", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	journalPath := filepath.Join(o.journalDir, entriesJournalName(entries))
+	if err := writeFileAtomic(journalPath, data); err != nil {
+		return fmt.Errorf("failed to write outbox journal: %w", err)
+	}
+
+	// Once the journal is written the commit is durable, applying it can be repeated after a crash
+	return o.applyJournal(journalPath)
+}
+
+func (o *FileOutbox) Record(events ...Event) error {
+	entries, err := toFileOutboxEntries(newOutboxEntries(events))
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	stored, err := o.load()
+	if err != nil {
+		return err
+	}
+	return o.save(append(stored, entries...))
+}
+
+func (o *FileOutbox) Pending(limit int) ([]*OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := o.applyJournals(); err != nil {
+		return nil, err
+	}
+
+	entries, err := o.entries()
+	if err != nil {
+		return nil, err
+	}
+	return pendingEntries(entries, limit), nil
+}
+
+func (o *FileOutbox) MarkDelivered(ids ...string) error {
+	return o.update(func(entries []*OutboxEntry) ([]*OutboxEntry, error) {
+		return entries, markDelivered(entries, ids)
+	})
+}
+
+func (o *FileOutbox) MarkFailed(id string, cause error) error {
+	return o.update(func(entries []*OutboxEntry) ([]*OutboxEntry, error) {
+		return entries, markFailed(entries, id, cause)
+	})
+}
+
+func (o *FileOutbox) Park(id string) error {
+	return o.update(func(entries []*OutboxEntry) ([]*OutboxEntry, error) {
+		return entries, park(entries, id)
+	})
+}
+
+func (o *FileOutbox) Parked() ([]*OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries, err := o.entries()
+	if err != nil {
+		return nil, err
+	}
+	return parkedEntries(entries), nil
+}
+
+func (o *FileOutbox) Unpark(ids ...string) error {
+	return o.update(func(entries []*OutboxEntry) ([]*OutboxEntry, error) {
+		return entries, unpark(entries, ids)
+	})
+}
+
+func (o *FileOutbox) Cleanup(deliveredBefore time.Time) (int, error) {
+	var removed int
+	err := o.update(func(entries []*OutboxEntry) ([]*OutboxEntry, error) {
+		var remaining []*OutboxEntry
+		remaining, removed = removeDelivered(entries, deliveredBefore)
+		return remaining, nil
+	})
+	return removed, err
+}
+
+// update loads the entries, changes them and saves the result
+func (o *FileOutbox) update(change func(entries []*OutboxEntry) ([]*OutboxEntry, error)) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries, err := o.entries()
+	if err != nil {
+		return err
+	}
+
+	entries, err = change(entries)
+	if err != nil {
+		return err
+	}
+
+	stored, err := toFileOutboxEntries(entries)
+	if err != nil {
+		return err
+	}
+	return o.save(stored)
+}
+
+// applyJournals applies the journals left by interrupted commits, oldest first
+func (o *FileOutbox) applyJournals() error {
+	files, err := os.ReadDir(o.journalDir)
+	if err != nil {
+		return fmt.Errorf("failed to read outbox journal: %w", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		if err := o.applyJournal(filepath.Join(o.journalDir, file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyJournal writes the state of a journal, records its entries unless already recorded and removes it
+func (o *FileOutbox) applyJournal(journalPath string) error {
+	data, err := os.ReadFile(journalPath)
+	if err != nil {
+		return fmt.Errorf("failed to read outbox journal: %w", err)
+	}
+
+	var journal outboxJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return fmt.Errorf("failed to unmarshal outbox journal: %w", err)
+	}
+
+	if journal.StatePath != "" {
+		if err := writeFileAtomic(journal.StatePath, journal.State); err != nil {
+			return fmt.Errorf("failed to write state file: %w", err)
+		}
+	}
+
+	stored, err := o.load()
+	if err != nil {
+		return err
+	}
+	recorded := make(map[string]bool, len(stored))
+	for _, entry := range stored {
+		recorded[entry.ID] = true
+	}
+	for _, entry := range journal.Entries {
+		if !recorded[entry.ID] {
+			stored = append(stored, entry)
+		}
+	}
+	if err := o.save(stored); err != nil {
+		return err
+	}
+
+	return os.Remove(journalPath)
+}
+
+// entries loads and deserializes the stored entries
+func (o *FileOutbox) entries() ([]*OutboxEntry, error) {
+	stored, err := o.load()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*OutboxEntry, 0, len(stored))
+	for _, entry := range stored {
+		event, err := EventFromJsonString(entry.Event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize outbox entry %s: %w", entry.ID, err)
+		}
+		entries = append(entries, &OutboxEntry{
+			ID:          entry.ID,
+			Event:       event,
+			RecordedAt:  entry.RecordedAt,
+			Attempts:    entry.Attempts,
+			LastError:   entry.LastError,
+			DeliveredAt: entry.DeliveredAt,
+			ParkedAt:    entry.ParkedAt,
+		})
+	}
+	return entries, nil
+}
+
+func (o *FileOutbox) load() ([]fileOutboxEntry, error) {
+	data, err := os.ReadFile(o.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []fileOutboxEntry{}, nil
+		}
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+
+	var stored []fileOutboxEntry
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal outbox: %w", err)
+	}
+	return stored, nil
+}
+
+func (o *FileOutbox) save(stored []fileOutboxEntry) error {
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox: %w", err)
+	}
+	if err := writeFileAtomic(o.filePath, data); err != nil {
+		return fmt.Errorf("failed to write outbox: %w", err)
+	}
+	return nil
+}
+
+func toFileOutboxEntries(entries []*OutboxEntry) ([]fileOutboxEntry, error) {
+	stored := make([]fileOutboxEntry, 0, len(entries))
+	for _, entry := range entries {
+		event, err := entry.Event.ToJsonString()
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize event %s: %w", entry.Event.Type(), err)
+		}
+		stored = append(stored, fileOutboxEntry{
+			ID:          entry.ID,
+			Event:       event,
+			RecordedAt:  entry.RecordedAt,
+			Attempts:    entry.Attempts,
+			LastError:   entry.LastError,
+			DeliveredAt: entry.DeliveredAt,
+			ParkedAt:    entry.ParkedAt,
+		})
+	}
+	return stored, nil
+}
+
+// entriesJournalName names a journal so that journals sort in commit order
+func entriesJournalName(entries []fileOutboxEntry) string {
+	name := fmt.Sprintf("%020d", time.Now().UnixNano())
+	if len(entries) > 0 {
+		name += "-" + entries[0].ID
+	}
+	return name + ".json"
+}
+
+// writeFileAtomic replaces a file with new content through a rename
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+//-------------------------------------------------------------
+// Entry helpers shared by outbox implementations
+//-------------------------------------------------------------
+
+func pendingEntries(entries []*OutboxEntry, limit int) []*OutboxEntry {
+	pending := make([]*OutboxEntry, 0)
+	for _, entry := range entries {
+		if entry.Delivered() || entry.Parked() {
+			continue
+		}
+		if limit > 0 && len(pending) >= limit {
+			break
+		}
+		copied := *entry
+		pending = append(pending, &copied)
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].RecordedAt.Before(pending[j].RecordedAt)
+	})
+	return pending
+}
+
+func markDelivered(entries []*OutboxEntry, ids []string) error {
+	now := time.Now()
+	for _, id := range ids {
+		entry := findOutboxEntry(entries, id)
+		if entry == nil {
+			return fmt.Errorf("%w: %s", ErrOutboxEntryNotFound, id)
+		}
+		entry.Attempts++
+		entry.LastError = ""
+		entry.DeliveredAt = now
+	}
+	return nil
+}
+
+func markFailed(entries []*OutboxEntry, id string, cause error) error {
+	entry := findOutboxEntry(entries, id)
+	if entry == nil {
+		return fmt.Errorf("%w: %s", ErrOutboxEntryNotFound, id)
+	}
+	entry.Attempts++
+	if cause != nil {
+		entry.LastError = cause.Error()
+	}
+	return nil
+}
+
+func park(entries []*OutboxEntry, id string) error {
+	entry := findOutboxEntry(entries, id)
+	if entry == nil {
+		return fmt.Errorf("%w: %s", ErrOutboxEntryNotFound, id)
+	}
+	entry.ParkedAt = time.Now()
+	return nil
+}
+
+func parkedEntries(entries []*OutboxEntry) []*OutboxEntry {
+	parked := make([]*OutboxEntry, 0)
+	for _, entry := range entries {
+		if entry.Parked() {
+			copied := *entry
+			parked = append(parked, &copied)
+		}
+	}
+	sort.SliceStable(parked, func(i, j int) bool {
+		return parked[i].RecordedAt.Before(parked[j].RecordedAt)
+	})
+	return parked
+}
+
+func unpark(entries []*OutboxEntry, ids []string) error {
+	for _, id := range ids {
+		entry := findOutboxEntry(entries, id)
+		if entry == nil {
+			return fmt.Errorf("%w: %s", ErrOutboxEntryNotFound, id)
+		}
+		entry.ParkedAt = time.Time{}
+		entry.Attempts = 0
+	}
+	return nil
+}
+
+func removeDelivered(entries []*OutboxEntry, deliveredBefore time.Time) ([]*OutboxEntry, int) {
+	remaining := make([]*OutboxEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Delivered() && entry.DeliveredAt.Before(deliveredBefore) {
+			continue
+		}
+		remaining = append(remaining, entry)
+	}
+	return remaining, len(entries) - len(remaining)
+}
+
+func findOutboxEntry(entries []*OutboxEntry, id string) *OutboxEntry {
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry
+		}
+	}
+	return nil
+}
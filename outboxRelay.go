@@ -0,0 +1,272 @@
+package ddd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// EventPublisher publishes events outside of the application
+type EventPublisher interface {
+	Publish(event Event) error
+}
+
+// OutboxRelayConfig holds the configuration of an outbox relay
+type OutboxRelayConfig struct {
+	IntervalMs  int `json:"outboxRelayIntervalMs"`
+	BatchSize   int `json:"outboxRelayBatchSize"`
+	RetentionMs int `json:"outboxRetentionMs"`
+	// MaxAttempts is the number of failed publications after which an entry is parked
+	MaxAttempts int `json:"outboxRelayMaxAttempts"`
+}
+
+// NewOutboxRelayConfig loads the outbox relay configuration from the given path, the
+// DDD_OUTBOX_RELAY_CONFIG_PATH environment variable or configs/properties.json.
+// Defaults are used for values missing from the file or when the file does not exist.
+func NewOutboxRelayConfig(configPath ...string) *OutboxRelayConfig {
+	var path string
+	if configPath == nil {
+		path = os.Getenv("DDD_OUTBOX_RELAY_CONFIG_PATH")
+		if path == "" {
+			path = "configs/properties.json"
+		}
+	} else {
+		path = configPath[0]
+	}
+
+	config, err := Configuration[OutboxRelayConfig](path)
+	if err != nil {
+		config = &OutboxRelayConfig{}
+	}
+	return config.withDefaults()
+}
+
+// withDefaults fills unset values with the outbox relay defaults
+func (c *OutboxRelayConfig) withDefaults() *OutboxRelayConfig {
+	config := *c
+	if config.IntervalMs <= 0 {
+		config.IntervalMs = 500
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.RetentionMs <= 0 {
+		config.RetentionMs = int(24 * time.Hour / time.Millisecond)
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 10
+	}
+	return &config
+}
+
+// OutboxRelay publishes the pending events of outboxes to the event bus and to external publishers.
+// Delivery is at least once: an entry stays pending until every target accepted it, so targets
+// may receive an event again when a later target failed. An entry failing MaxAttempts times is
+// parked for the entries after it to be published. A relay registered as a resource relays
+// every Outbox resource of its context, and those added with WithOutboxes. Relays stop before
+// the event bus of their context, after publishing what was committed until then.
+type OutboxRelay struct {
+	ctx        *Context
+	logger     *Logger
+	config     *OutboxRelayConfig
+	outboxes   []Outbox
+	publishers []EventPublisher
+	stopCh     chan struct{}
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+}
+
+// NewOutboxRelay creates an outbox relay dispatching to the event bus of the context
+func NewOutboxRelay(ctx *Context) *OutboxRelay {
+	relay := &OutboxRelay{
+		ctx:        ctx,
+		logger:     ctx.Logger(),
+		config:     NewOutboxRelayConfig(),
+		outboxes:   make([]Outbox, 0),
+		publishers: make([]EventPublisher, 0),
+	}
+	ctx.addOutboxRelay(relay)
+	return relay
+}
+
+// WithConfig replaces the relay configuration, it must be set before the relay starts
+func (r *OutboxRelay) WithConfig(config *OutboxRelayConfig) *OutboxRelay {
+	r.config = config.withDefaults()
+	return r
+}
+
+// WithOutboxes adds outboxes to relay besides the Outbox resources of the context
+func (r *OutboxRelay) WithOutboxes(outboxes ...Outbox) *OutboxRelay {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.outboxes = append(r.outboxes, outboxes...)
+	return r
+}
+
+// WithPublishers adds external publishers every event is published to after the event bus
+func (r *OutboxRelay) WithPublishers(publishers ...EventPublisher) *OutboxRelay {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.publishers = append(r.publishers, publishers...)
+	return r
+}
+
+// OnStart starts relaying periodically
+func (r *OutboxRelay) OnStart() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopCh != nil {
+		return nil // Already running
+	}
+	r.stopCh = make(chan struct{})
+
+	r.wg.Add(1)
+	go r.run(r.stopCh)
+
+	r.logger.Info("outbox relay started")
+	return nil
+}
+
+// OnDestroy stops relaying and waits for the current pass to finish
+func (r *OutboxRelay) OnDestroy() error {
+	r.mu.Lock()
+	if r.stopCh == nil {
+		r.mu.Unlock()
+		return nil
+	}
+	close(r.stopCh)
+	r.stopCh = nil
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	r.logger.Info("outbox relay stopped")
+	return nil
+}
+
+func (r *OutboxRelay) run(stopCh chan struct{}) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(r.config.IntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			// Publish what was committed until now before stopping, the event bus stops after the relay
+			if _, err := r.Relay(); err != nil {
+				r.logger.Warn("failed to relay pending events before stopping: %v", err)
+			}
+			return
+		case <-ticker.C:
+			r.Relay()
+		}
+	}
+}
+
+// Relay makes a single pass over the outboxes, publishing up to a batch of pending entries of each,
+// and removes the entries delivered before the retention period. It returns the number of entries delivered.
+func (r *OutboxRelay) Relay() (int, error) {
+	var errs []error
+	delivered := 0
+
+	for _, outbox := range r.relayedOutboxes() {
+		count, err := r.relay(outbox)
+		delivered += count
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		retention := time.Duration(r.config.RetentionMs) * time.Millisecond
+		if _, err := outbox.Cleanup(time.Now().Add(-retention)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to clean up outbox: %w", err))
+		}
+	}
+	return delivered, errors.Join(errs...)
+}
+
+// relay publishes pending entries in order and stops at the first failure, so that events are never
+// published before the events recorded earlier. An entry that failed MaxAttempts times is parked and
+// the entries after it are published.
+func (r *OutboxRelay) relay(outbox Outbox) (int, error) {
+	entries, err := outbox.Pending(r.config.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read pending outbox entries: %w", err)
+	}
+
+	delivered := 0
+	for _, entry := range entries {
+		if err := r.publish(entry.Event); err != nil {
+			if errors.Is(err, ErrEventBusNotRunning) {
+				// Not a failure of the entry, it is published once the event bus runs
+				return delivered, err
+			}
+			r.logger.Warn("failed to relay event %s of outbox entry %s: %v", entry.Event.Type(), entry.ID, err)
+			if markErr := outbox.MarkFailed(entry.ID, err); markErr != nil {
+				return delivered, markErr
+			}
+			if entry.Attempts+1 < r.config.MaxAttempts {
+				return delivered, nil
+			}
+			r.logger.Error("parked outbox entry %s after %d failed attempts to relay event %s",
+				entry.ID, entry.Attempts+1, entry.Event.Type())
+			if parkErr := outbox.Park(entry.ID); parkErr != nil {
+				return delivered, parkErr
+			}
+			continue
+		}
+
+		if err := outbox.MarkDelivered(entry.ID); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// publish dispatches an event to the event bus and then to every publisher
+func (r *OutboxRelay) publish(event Event) error {
+	if err := r.ctx.eventBus.Dispatch(event); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	publishers := append([]EventPublisher{}, r.publishers...)
+	r.mu.Unlock()
+
+	for _, publisher := range publishers {
+		if err := publisher.Publish(event); err != nil {
+			return fmt.Errorf("publisher %T: %w", publisher, err)
+		}
+	}
+	return nil
+}
+
+// relayedOutboxes returns the outboxes added to the relay followed by the Outbox resources of the context
+func (r *OutboxRelay) relayedOutboxes() []Outbox {
+	r.mu.Lock()
+	outboxes := append([]Outbox{}, r.outboxes...)
+	r.mu.Unlock()
+
+	resources, err := ResolveAll[Outbox](r.ctx)
+	if err != nil {
+		r.logger.Error("failed to resolve outboxes: %v", err)
+		return outboxes
+	}
+
+	seen := make(map[Outbox]bool, len(outboxes))
+	for _, outbox := range outboxes {
+		seen[outbox] = true
+	}
+	for _, outbox := range resources {
+		if !seen[outbox] {
+			seen[outbox] = true
+			outboxes = append(outboxes, outbox)
+		}
+	}
+	return outboxes
+}
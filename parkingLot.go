@@ -0,0 +1,64 @@
+package ddd
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrMessageParked is returned when a message could not be translated and was parked instead.
+// Consumers acknowledge parked messages, the parking lot keeps them for inspection.
+var ErrMessageParked = errors.New("message parked")
+
+// ErrParkedMessageNotFound is returned when a parked message does not exist
+var ErrParkedMessageNotFound = errors.New("parked message not found")
+
+// ParkedMessage is an inbound message no translator could handle
+type ParkedMessage struct {
+	ID       string
+	Target   string
+	Body     []byte
+	Headers  map[string]string
+	Type     string
+	Reason   string
+	ParkedAt time.Time
+}
+
+// ParkingLot keeps unroutable messages so that they can be inspected
+type ParkingLot interface {
+	Park(msg *ParkedMessage) error
+	Get(id string) (*ParkedMessage, error)
+	List() ([]*ParkedMessage, error)
+	Remove(id string) error
+}
+
+// inMemoryParkingLot is a ParkingLot keeping messages in memory
+type inMemoryParkingLot struct {
+	messages *memoryStore[ParkedMessage]
+}
+
+// NewInMemoryParkingLot creates a new in-memory parking lot
+func NewInMemoryParkingLot() ParkingLot {
+	return &inMemoryParkingLot{
+		messages: newMemoryStore(func(msg *ParkedMessage) time.Time { return msg.ParkedAt }, ErrParkedMessageNotFound),
+	}
+}
+
+func (p *inMemoryParkingLot) Park(msg *ParkedMessage) error {
+	if msg == nil {
+		return errors.New("parked message cannot be nil")
+	}
+	p.messages.put(msg.ID, msg)
+	return nil
+}
+
+func (p *inMemoryParkingLot) Get(id string) (*ParkedMessage, error) {
+	return p.messages.get(id)
+}
+
+func (p *inMemoryParkingLot) List() ([]*ParkedMessage, error) {
+	return p.messages.list(), nil
+}
+
+func (p *inMemoryParkingLot) Remove(id string) error {
+	return p.messages.remove(id)
+}
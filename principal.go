@@ -0,0 +1,88 @@
+package ddd
+
+import (
+	"context"
+	"slices"
+)
+
+// Principal is the identity a request is made on behalf of
+type Principal struct {
+	// ID identifies the principal, the subject of a token or the user name
+	ID          string         `json:"id"`
+	Name        string         `json:"name,omitempty"`
+	Roles       []string       `json:"roles,omitempty"`
+	Permissions []string       `json:"permissions,omitempty"`
+	Claims      map[string]any `json:"claims,omitempty"`
+	// Method names the authenticator that authenticated the principal, such as jwt, apiKey or basic
+	Method string `json:"method,omitempty"`
+}
+
+// HasRole tells whether the principal has any of the given roles
+func (p *Principal) HasRole(roles ...string) bool {
+	if p == nil {
+		return false
+	}
+	for _, role := range roles {
+		if slices.Contains(p.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermissions tells whether the principal has all of the given permissions
+func (p *Principal) HasPermissions(permissions ...string) bool {
+	if p == nil {
+		return len(permissions) == 0
+	}
+	for _, permission := range permissions {
+		if !slices.Contains(p.Permissions, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of a context carrying a principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalOf returns the principal of a request context, nil for anonymous requests
+func PrincipalOf(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// Acting carries the principal a command acts for. Commands embed it, set from the context of the request
+// they are created for, and the aggregates they act on raise their events on behalf of its principal.
+type Acting struct {
+	principal *Principal
+}
+
+// ActingFor returns the principal of a request context as the one commands act for
+func ActingFor(ctx context.Context) Acting {
+	return Acting{principal: PrincipalOf(ctx)}
+}
+
+// Principal returns the principal the command acts for, nil when anonymous
+func (a Acting) Principal() *Principal {
+	return a.principal
+}
+
+// Act makes aggregates raise their events on behalf of the principal the command acts for
+func (a Acting) Act(aggregates ...Aggregate) {
+	for _, aggregate := range aggregates {
+		aggregate.ActAs(a.principal)
+	}
+}
+
+// EventPrincipal returns the principal an event was raised on behalf of, nil when unknown
+func EventPrincipal(event Event) *Principal {
+	if audited, ok := event.(interface{ Principal() *Principal }); ok {
+		return audited.Principal()
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package ddd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details
+const ProblemContentType = "application/problem+json"
+
+// Standard kinds of domain errors, each rendered with its own status
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrValidation         = errors.New("validation failed")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrForbidden          = errors.New("forbidden")
+	ErrTooManyRequests    = errors.New("too many requests")
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// DomainError is an error of a standard kind with the detail and extension fields of its problem
+type DomainError struct {
+	Kind       error
+	Detail     string
+	Extensions map[string]any
+}
+
+func (e *DomainError) Error() string {
+	if e.Detail == "" {
+		return e.Kind.Error()
+	}
+	return fmt.Sprintf("%v: %s", e.Kind, e.Detail)
+}
+
+func (e *DomainError) Unwrap() error {
+	return e.Kind
+}
+
+// NotFound creates an error for a resource that does not exist
+func NotFound(detail string) error {
+	return &DomainError{Kind: ErrNotFound, Detail: detail}
+}
+
+// Conflict creates an error for a request conflicting with the state of a resource
+func Conflict(detail string) error {
+	return &DomainError{Kind: ErrConflict, Detail: detail}
+}
+
+// Validation creates an error for invalid input, with the message of each invalid field
+func Validation(detail string, fields map[string]string) error {
+	err := &DomainError{Kind: ErrValidation, Detail: detail}
+	if len(fields) > 0 {
+		err.Extensions = map[string]any{"errors": fields}
+	}
+	return err
+}
+
+// Unauthorized creates an error for a request lacking valid credentials
+func Unauthorized(detail string) error {
+	return &DomainError{Kind: ErrUnauthorized, Detail: detail}
+}
+
+// Forbidden creates an error for a principal lacking the roles or permissions a request requires
+func Forbidden(detail string) error {
+	return &DomainError{Kind: ErrForbidden, Detail: detail}
+}
+
+// TooManyRequests creates an error for a client exceeding a rate or concurrency limit
+func TooManyRequests(detail string) error {
+	return &DomainError{Kind: ErrTooManyRequests, Detail: detail}
+}
+
+// PreconditionFailed creates an error for a request whose preconditions do not hold
+func PreconditionFailed(detail string) error {
+	return &DomainError{Kind: ErrPreconditionFailed, Detail: detail}
+}
+
+// Problem is an RFC 7807 problem details object, extensions are serialized as top level members
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]any
+}
+
+// NewProblem creates a problem of the given status, titled with the status text
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return fmt.Sprintf("%s: %s", p.Title, p.Detail)
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]any, len(p.Extensions)+5)
+	for name, value := range p.Extensions {
+		members[name] = value
+	}
+	members["type"] = p.Type
+	members["title"] = p.Title
+	members["status"] = p.Status
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		members["instance"] = p.Instance
+	}
+	return json.Marshal(members)
+}
+
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	standard := map[string]any{"type": &p.Type, "title": &p.Title, "status": &p.Status, "detail": &p.Detail, "instance": &p.Instance}
+	for name, raw := range members {
+		if target, ok := standard[name]; ok {
+			if err := json.Unmarshal(raw, target); err != nil {
+				return fmt.Errorf("invalid problem member %s: %w", name, err)
+			}
+			continue
+		}
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		if p.Extensions == nil {
+			p.Extensions = make(map[string]any)
+		}
+		p.Extensions[name] = value
+	}
+	return nil
+}
+
+// WriteProblem writes a problem response, the instance defaults to the request path
+func WriteProblem(w http.ResponseWriter, r *http.Request, problem *Problem) {
+	if problem.Instance == "" && r != nil {
+		problem.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// problemMapping renders the errors matching a target as problems
+type problemMapping struct {
+	target error
+	build  func(err error) *Problem
+}
+
+// ProblemRegistry is an ErrorMapper rendering errors as problems. It knows the standard domain errors, the errors of
+// decoding requests and negotiating responses, and each bounded context registers its own errors, either onto a standard kind or as a
+// problem of its own. Later registrations take precedence, errors matching none are internal server errors.
+type ProblemRegistry struct {
+	mappings []problemMapping
+	mu       sync.RWMutex
+}
+
+// NewProblemRegistry creates a registry of the standard domain errors
+func NewProblemRegistry() *ProblemRegistry {
+	registry := &ProblemRegistry{mappings: make([]problemMapping, 0)}
+	registry.RegisterProblem(ErrBadRequest, http.StatusBadRequest, "about:blank", http.StatusText(http.StatusBadRequest))
+	registry.RegisterProblem(ErrRequestTooLarge, http.StatusRequestEntityTooLarge, "about:blank", http.StatusText(http.StatusRequestEntityTooLarge))
+	registry.RegisterProblem(ErrUnsupportedMediaType, http.StatusUnsupportedMediaType, "about:blank", http.StatusText(http.StatusUnsupportedMediaType))
+	registry.RegisterProblem(ErrNotAcceptable, http.StatusNotAcceptable, "about:blank", http.StatusText(http.StatusNotAcceptable))
+	registry.RegisterProblem(ErrNotFound, http.StatusNotFound, "about:blank", http.StatusText(http.StatusNotFound))
+	registry.RegisterProblem(ErrConflict, http.StatusConflict, "about:blank", http.StatusText(http.StatusConflict))
+	registry.RegisterProblem(ErrValidation, http.StatusUnprocessableEntity, "about:blank", "Validation Failed")
+	registry.RegisterProblem(ErrUnauthorized, http.StatusUnauthorized, "about:blank", http.StatusText(http.StatusUnauthorized))
+	registry.RegisterProblem(ErrForbidden, http.StatusForbidden, "about:blank", http.StatusText(http.StatusForbidden))
+	registry.RegisterProblem(ErrTooManyRequests, http.StatusTooManyRequests, "about:blank", http.StatusText(http.StatusTooManyRequests))
+	registry.RegisterProblem(ErrPreconditionFailed, http.StatusPreconditionFailed, "about:blank", http.StatusText(http.StatusPreconditionFailed))
+	registry.RegisterProblem(ErrVersionConflict, http.StatusPreconditionFailed, "about:blank", http.StatusText(http.StatusPreconditionFailed))
+	return registry
+}
+
+// Register renders the errors matching target, with errors.Is, as problems of a standard kind
+func (r *ProblemRegistry) Register(target error, kind error) *ProblemRegistry {
+	return r.RegisterFunc(target, func(err error) *Problem {
+		return r.lookup(kind, err)
+	})
+}
+
+// RegisterProblem renders the errors matching target, with errors.Is, as problems of the given type
+func (r *ProblemRegistry) RegisterProblem(target error, status int, problemType string, title string) *ProblemRegistry {
+	return r.RegisterFunc(target, func(err error) *Problem {
+		problem := &Problem{Type: problemType, Title: title, Status: status, Detail: err.Error()}
+		var domainErr *DomainError
+		if errors.As(err, &domainErr) {
+			problem.Detail = domainErr.Detail
+			problem.Extensions = domainErr.Extensions
+		}
+		return problem
+	})
+}
+
+// RegisterFunc renders the errors matching target, with errors.Is, as the problems built by a function
+func (r *ProblemRegistry) RegisterFunc(target error, build func(err error) *Problem) *ProblemRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.mappings = append(r.mappings, problemMapping{target: target, build: build})
+	return r
+}
+
+// Problem renders an error as a problem
+func (r *ProblemRegistry) Problem(err error) *Problem {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		return problem
+	}
+	return r.lookup(err, err)
+}
+
+// lookup renders err with the latest mapping matching target
+func (r *ProblemRegistry) lookup(target error, err error) *Problem {
+	r.mu.RLock()
+	var build func(err error) *Problem
+	for i := len(r.mappings) - 1; i >= 0; i-- {
+		if errors.Is(target, r.mappings[i].target) {
+			build = r.mappings[i].build
+			break
+		}
+	}
+	r.mu.RUnlock()
+
+	if build == nil {
+		// The details of unexpected errors are not disclosed
+		return NewProblem(http.StatusInternalServerError, "")
+	}
+	return build(err)
+}
+
+// MapError renders an error as a problem and its status
+func (r *ProblemRegistry) MapError(err error) (int, any) {
+	problem := r.Problem(err)
+	return problem.Status, problem
+}
@@ -0,0 +1,342 @@
+package ddd
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitAlgorithm is the way requests are counted against a rate limit
+type RateLimitAlgorithm string
+
+const (
+	// TokenBucket lets bursts of Burst requests through, refilled at Limit requests per Window
+	TokenBucket RateLimitAlgorithm = "tokenBucket"
+	// SlidingWindow lets Limit requests through in any Window, weighing the previous window by its overlap
+	SlidingWindow RateLimitAlgorithm = "slidingWindow"
+)
+
+// RateLimit is a number of requests allowed per window to each client
+type RateLimit struct {
+	Algorithm RateLimitAlgorithm
+	Limit     int
+	Window    time.Duration
+	// Burst is the capacity of a token bucket, the limit by default
+	Burst int
+}
+
+// ParseRateLimit parses a rate limit of the form limit/window, such as 100/1m, and an optional algorithm,
+// the token bucket by default: "100/1m slidingWindow"
+func ParseRateLimit(spec string) (RateLimit, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 || len(fields) > 2 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q", spec)
+	}
+	count, window, ok := strings.Cut(fields[0], "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: expected limit/window", spec)
+	}
+	limit, err := strconv.Atoi(count)
+	if err != nil || limit <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: limit must be a positive number", spec)
+	}
+	if window == "s" || window == "m" || window == "h" {
+		window = "1" + window
+	}
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: invalid window", spec)
+	}
+
+	rateLimit := RateLimit{Algorithm: TokenBucket, Limit: limit, Window: duration}
+	if len(fields) == 2 {
+		rateLimit.Algorithm = RateLimitAlgorithm(fields[1])
+		if rateLimit.Algorithm != TokenBucket && rateLimit.Algorithm != SlidingWindow {
+			return RateLimit{}, fmt.Errorf("invalid rate limit %q: unknown algorithm %s", spec, fields[1])
+		}
+	}
+	return rateLimit, nil
+}
+
+// policy describes the limit in the RateLimit-Policy header
+func (l RateLimit) policy() string {
+	policy := fmt.Sprintf("%d;w=%d", l.Limit, int(math.Ceil(l.Window.Seconds())))
+	if l.Algorithm != SlidingWindow && l.capacity() != l.Limit {
+		policy += fmt.Sprintf(";burst=%d", l.capacity())
+	}
+	return policy
+}
+
+func (l RateLimit) capacity() int {
+	if l.Algorithm != SlidingWindow && l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Limit
+}
+
+// RateLimitResult is the outcome of counting a request against a rate limit
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the client has its whole limit again
+	Reset time.Duration
+	// RetryAfter is the time until a refused client may be allowed again
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the state of rate limits per key. A store shared by several instances of a service
+// limits the clients of all of them.
+type RateLimitStore interface {
+	// Take counts a request of a key against a limit
+	Take(key string, limit RateLimit, now time.Time) (RateLimitResult, error)
+}
+
+// RateLimitKey identifies the client of a request, requests with an empty key are not limited
+type RateLimitKey func(r *http.Request) string
+
+// KeyByClientIP limits each remote address
+func KeyByClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// KeyByPrincipal limits each principal, and anonymous requests by remote address
+func KeyByPrincipal(r *http.Request) string {
+	if principal := PrincipalOf(r.Context()); principal != nil {
+		return "principal:" + principal.ID
+	}
+	return KeyByClientIP(r)
+}
+
+// KeyByApiKey limits each api key given in a header, X-Api-Key by default, and requests without one by
+// remote address. Keys are held as digests.
+func KeyByApiKey(header string) RateLimitKey {
+	header = valueOr(header, "X-Api-Key")
+	return func(r *http.Request) string {
+		if key := r.Header.Get(header); key != "" {
+			return "apiKey:" + apiKeyDigest(key)
+		}
+		return KeyByClientIP(r)
+	}
+}
+
+// rateLimitKeys are the keys routes name in their rateLimitKey tag
+var rateLimitKeys = map[string]RateLimitKey{
+	"ip":        KeyByClientIP,
+	"principal": KeyByPrincipal,
+	"apiKey":    KeyByApiKey(""),
+}
+
+// RateLimitMiddleware refuses the requests of clients exceeding a limit with a 429 problem. Responses carry
+// the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers, refusals a
+// Retry-After header. The name keeps the counts of the limit apart from those of other limits in the store.
+// Requests are let through when the store fails, a nil key limits each remote address.
+func RateLimitMiddleware(name string, limit RateLimit, key RateLimitKey, store RateLimitStore, logger *Logger) HttpMiddleware {
+	return rateLimitMiddleware(name, limit, key, func(*http.Request) RateLimitStore { return store }, logger)
+}
+
+// rateLimitMiddleware limits requests with the store a function gives for them
+func rateLimitMiddleware(name string, limit RateLimit, key RateLimitKey, storeOf func(r *http.Request) RateLimitStore, logger *Logger) HttpMiddleware {
+	if key == nil {
+		key = KeyByClientIP
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := key(r)
+			if client == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			result, err := storeOf(r).Take(name+"|"+client, limit, time.Now())
+			if err != nil {
+				logger.Error("Failed to apply rate limit %s: %v", name, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+			header.Set("RateLimit-Policy", limit.policy())
+			if !result.Allowed {
+				header.Set("Retry-After", strconv.Itoa(max(seconds(result.RetryAfter), 1)))
+				writeError(w, r, errorMapperOf(GetContext(r)), TooManyRequests("rate limit exceeded"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ConcurrencyLimitMiddleware refuses requests with a 429 problem while a client has the given number of
+// requests in progress. A nil key limits all clients together.
+func ConcurrencyLimitMiddleware(maxInFlight int, key RateLimitKey) HttpMiddleware {
+	var mu sync.Mutex
+	inFlight := make(map[string]int)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := ""
+			if key != nil {
+				client = key(r)
+			}
+
+			mu.Lock()
+			if inFlight[client] >= maxInFlight {
+				mu.Unlock()
+				w.Header().Set("Retry-After", "1")
+				writeError(w, r, errorMapperOf(GetContext(r)), TooManyRequests("too many concurrent requests"))
+				return
+			}
+			inFlight[client]++
+			mu.Unlock()
+
+			defer func() {
+				mu.Lock()
+				inFlight[client]--
+				if inFlight[client] == 0 {
+					delete(inFlight, client)
+				}
+				mu.Unlock()
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds a duration up to whole seconds
+func seconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
+
+// rateLimitState is the state of a key, a token bucket or the counts of a sliding window
+type rateLimitState struct {
+	tokens      float64
+	windowStart time.Time
+	current     int
+	previous    int
+	updated     time.Time
+	expires     time.Time
+}
+
+// inMemoryRateLimitStore keeps rate limits in memory, states of idle keys are removed once their limit resets
+type inMemoryRateLimitStore struct {
+	states    map[string]*rateLimitState
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// NewInMemoryRateLimitStore creates a store keeping rate limits in memory
+func NewInMemoryRateLimitStore() RateLimitStore {
+	return &inMemoryRateLimitStore{states: make(map[string]*rateLimitState)}
+}
+
+func (s *inMemoryRateLimitStore) Take(key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	if limit.Limit <= 0 || limit.Window <= 0 {
+		return RateLimitResult{}, fmt.Errorf("invalid rate limit %d/%v", limit.Limit, limit.Window)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now, limit.Window)
+	state, ok := s.states[key]
+	if !ok {
+		state = &rateLimitState{tokens: float64(limit.capacity()), windowStart: now, updated: now}
+		s.states[key] = state
+	}
+
+	var result RateLimitResult
+	if limit.Algorithm == SlidingWindow {
+		result = state.slidingWindow(limit, now)
+	} else {
+		result = state.tokenBucket(limit, now)
+	}
+	state.expires = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep removes the states of keys whose limit reset, at most once per window
+func (s *inMemoryRateLimitStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	s.lastSweep = now
+	for key, state := range s.states {
+		if now.After(state.expires) {
+			delete(s.states, key)
+		}
+	}
+}
+
+// tokenBucket refills the bucket for the time elapsed and takes a token
+func (s *rateLimitState) tokenBucket(limit RateLimit, now time.Time) RateLimitResult {
+	capacity := float64(limit.capacity())
+	rate := float64(limit.Limit) / limit.Window.Seconds()
+	s.tokens = math.Min(capacity, s.tokens+now.Sub(s.updated).Seconds()*rate)
+	s.updated = now
+
+	result := RateLimitResult{Limit: limit.capacity()}
+	if s.tokens >= 1 {
+		s.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsDuration((1 - s.tokens) / rate)
+	}
+	result.Remaining = int(s.tokens)
+	result.Reset = secondsDuration((capacity - s.tokens) / rate)
+	return result
+}
+
+// slidingWindow counts the request in the current window, weighing the count of the previous window by
+// the part of it the sliding window still covers
+func (s *rateLimitState) slidingWindow(limit RateLimit, now time.Time) RateLimitResult {
+	elapsed := now.Sub(s.windowStart)
+	if elapsed >= limit.Window {
+		windows := elapsed / limit.Window
+		s.previous = s.current
+		if windows > 1 {
+			s.previous = 0
+		}
+		s.current = 0
+		s.windowStart = s.windowStart.Add(windows * limit.Window)
+		elapsed = now.Sub(s.windowStart)
+	}
+
+	weight := 1 - elapsed.Seconds()/limit.Window.Seconds()
+	estimate := float64(s.previous)*weight + float64(s.current)
+	untilNextWindow := limit.Window - elapsed
+
+	result := RateLimitResult{Limit: limit.Limit}
+	if estimate+1 <= float64(limit.Limit) {
+		s.current++
+		estimate++
+		result.Allowed = true
+	} else if s.previous > 0 && s.current < limit.Limit {
+		// Wait for enough of the previous window to slide out
+		needed := 1 - (float64(limit.Limit-s.current)-1)/float64(s.previous)
+		result.RetryAfter = time.Duration(needed*float64(limit.Window)) - elapsed
+	} else {
+		result.RetryAfter = untilNextWindow
+	}
+	result.Remaining = max(limit.Limit-int(math.Ceil(estimate)), 0)
+	// The previous count slides out by the end of this window, the current one by the end of the next
+	result.Reset = untilNextWindow
+	if s.current > 0 {
+		result.Reset += limit.Window
+	}
+	return result
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
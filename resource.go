@@ -29,6 +29,11 @@ var stereotypes = []reflect.Type{
 	reflect.TypeOf((*Endpoint)(nil)).Elem(),
 	reflect.TypeOf((*EventHandler)(nil)).Elem(),
 	reflect.TypeOf((*MessageConsumer)(nil)).Elem(),
+	reflect.TypeOf((*MessagePublisher)(nil)).Elem(),
+	reflect.TypeOf((*EventBusMiddlewareProvider)(nil)).Elem(),
+	reflect.TypeOf((*HttpMiddlewareProvider)(nil)).Elem(),
+	reflect.TypeOf((*Authenticator)(nil)).Elem(),
+	reflect.TypeOf((*EventLog)(nil)).Elem(),
 }
 
 type resource struct {
@@ -36,6 +41,7 @@ type resource struct {
 	types        []reflect.Type
 	alias        string
 	scope        Scope
+	order        int
 	instance     atomic.Value
 	initOnce     sync.Once
 	instancePool sync.Map
@@ -0,0 +1,111 @@
+package ddd
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrorClassifier decides whether a handler error is worth retrying
+type ErrorClassifier func(err error) bool
+
+// RetryPolicy controls how a failing event handler is retried before its event is dead-lettered
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff exponentially between attempts
+	Multiplier float64
+	// Jitter randomizes each backoff by up to this fraction (0 to 1)
+	Jitter float64
+	// Retryable separates retryable errors from fatal ones
+	Retryable ErrorClassifier
+}
+
+// DefaultRetryPolicy returns the policy used by the event bus when a handler does not declare one
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Retryable:      IsRetryable,
+	}
+}
+
+// NoRetry returns a policy that gives up after the first failure
+func NoRetry() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1, Retryable: IsRetryable}
+}
+
+// Backoff returns the delay to wait after the given failed attempt (starting at 1)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if p.InitialBackoff <= 0 {
+		return 0
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		backoff = backoff * (1 - jitter + 2*jitter*rand.Float64())
+	}
+
+	return time.Duration(backoff)
+}
+
+// attempts returns the number of attempts allowed by the policy, at least one
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// retryable classifies an error using the policy classifier or the default one
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable == nil {
+		return IsRetryable(err)
+	}
+	return p.Retryable(err)
+}
+
+// fatalError marks an error that must not be retried
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fatalError) Unwrap() error {
+	return e.err
+}
+
+// Fatal wraps an error so that the event bus dead-letters the event without retrying
+func Fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &fatalError{err}
+}
+
+// IsRetryable is the default error classifier, every error is retryable unless marked as Fatal
+func IsRetryable(err error) bool {
+	var fatal *fatalError
+	return !errors.As(err, &fatal)
+}
@@ -2,6 +2,7 @@ package ddd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -18,6 +19,9 @@ type Server struct {
 	host       string
 	contexts   []*Context
 	router     *mux.Router
+	openApi    OpenApiConfig
+	schemes    map[string]SecurityScheme
+	middleware []HttpMiddleware
 	httpServer *http.Server
 	// Add context and cancel function for proper shutdown
 	ctx    context.Context
@@ -28,6 +32,7 @@ type ServerConfig struct {
 	// WorkerCount is the number of workers that process events
 	Host string `json:"serverHost"`
 	Port int    `json:"serverPort"`
+	OpenApiConfig
 }
 
 func NewServerConfig(configPath ...string) *ServerConfig {
@@ -57,6 +62,8 @@ func NewServer(serverConfig *ServerConfig) *Server {
 		host:     serverConfig.Host,
 		contexts: make([]*Context, 0),
 		router:   mux.NewRouter(),
+		openApi:  serverConfig.OpenApiConfig,
+		schemes:  make(map[string]SecurityScheme),
 		ctx:      ctx,
 		cancel:   cancel,
 	}
@@ -71,11 +78,38 @@ func (s *Server) WithContexts(contextFacories ...ContextFactory) *Server {
 	return s
 }
 
+// WithMiddleware wraps every request to the server with middleware, including requests no route matches.
+// The first middleware is the outermost, the middleware of contexts and endpoints runs inside it.
+func (s *Server) WithMiddleware(middleware ...HttpMiddleware) *Server {
+	s.middleware = append(s.middleware, middleware...)
+	return s
+}
+
+// WithSecurityScheme declares a security scheme in the OpenAPI document, requests satisfy any of the declared schemes
+func (s *Server) WithSecurityScheme(name string, scheme SecurityScheme) *Server {
+	s.schemes[name] = scheme
+	return s
+}
+
+// OpenApi returns the OpenAPI 3.1 document of the endpoints of all contexts
+func (s *Server) OpenApi() ([]byte, error) {
+	document, err := generateOpenApi(s.openApi, s.schemes, s.contexts)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
+
 // Router returns the server's router
 func (s *Server) Router() *mux.Router {
 	return s.router
 }
 
+// Handler returns the router wrapped with the middleware of the server
+func (s *Server) Handler() http.Handler {
+	return chainMiddleware(s.middleware, s.router)
+}
+
 // Start initializes and starts the server
 func (s *Server) Start() error {
 	// Register health check endpoint
@@ -83,18 +117,30 @@ func (s *Server) Start() error {
 
 	// Start all contexts
 	for _, ctx := range s.contexts {
-		ctx.Start()
+		if err := ctx.Start(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.registerOpenApi(); err != nil {
+		return err
 	}
 
 	// Create HTTP server
 	addr := fmt.Sprintf("%s:%d", s.host, s.port)
 	s.httpServer = &http.Server{
 		Addr:         addr,
-		Handler:      s.router,
+		Handler:      s.Handler(),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	// Long-lived requests, such as event streams, would hold up the shutdown of the server
+	s.httpServer.RegisterOnShutdown(func() {
+		for _, ctx := range s.contexts {
+			ctx.shutdown()
+		}
+	})
 
 	// Start server in a goroutine
 	serverErrors := make(chan error, 1)
@@ -161,3 +207,30 @@ func (s *Server) registerHealthCheck() {
 
 	s.logger.Info("registered health check endpoint at GET /")
 }
+
+// registerOpenApi serves the OpenAPI document and its documentation page at the configured paths
+func (s *Server) registerOpenApi() error {
+	if s.openApi.Path == "" {
+		return nil
+	}
+
+	// Routes are all registered once contexts started, the document does not change afterwards
+	document, err := s.OpenApi()
+	if err != nil {
+		return fmt.Errorf("failed to generate OpenAPI document: %w", err)
+	}
+	s.router.HandleFunc(s.openApi.Path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(document)
+	}).Methods("GET")
+	s.logger.Info("registered OpenAPI document at GET %s", s.openApi.Path)
+
+	if s.openApi.DocsPath != "" {
+		s.router.HandleFunc(s.openApi.DocsPath, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			docsPage.Execute(w, s.openApi.Path)
+		}).Methods("GET")
+		s.logger.Info("registered API documentation at GET %s", s.openApi.DocsPath)
+	}
+	return nil
+}
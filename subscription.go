@@ -0,0 +1,132 @@
+package ddd
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AllEvents subscribes a handler function to every event
+const AllEvents = "*"
+
+const aggregatePrefix = "aggregate:"
+
+// AggregateEvents subscribes a handler function to all events of an aggregate type
+func AggregateEvents(aggregateType string) string {
+	return aggregatePrefix + aggregateType
+}
+
+// EventsIn subscribes a handler function to all events declared in a package.
+// A package path ending with "/..." also matches the events of all its sub packages.
+func EventsIn(pkgPath string) string {
+	if strings.HasSuffix(pkgPath, "/...") {
+		return pkgPath
+	}
+	return pkgPath + ".*"
+}
+
+// subscription binds a handler function to an event type together with its retry policy and dispatch mode
+type subscription struct {
+	seq       int
+	handler   string
+	eventType string
+	handle    HandleEvent
+	retry     RetryPolicy
+	mode      DispatchMode
+	when      EventPredicate
+	breaker   *circuitBreaker
+}
+
+// subscriptionIndex finds the subscriptions matching an event without scanning every subscription.
+// Exact, aggregate, package and wildcard matches only depend on the event and aggregate types,
+// so they are resolved once per type pair and cached; predicates are evaluated on each event.
+type subscriptionIndex struct {
+	seq        int
+	exact      map[string][]*subscription
+	aggregates map[string][]*subscription
+	prefixes   map[string][]*subscription
+	all        []*subscription
+	predicates []*subscription
+	cache      sync.Map
+}
+
+func newSubscriptionIndex() *subscriptionIndex {
+	return &subscriptionIndex{
+		exact:      make(map[string][]*subscription),
+		aggregates: make(map[string][]*subscription),
+		prefixes:   make(map[string][]*subscription),
+	}
+}
+
+// add indexes a subscription by the pattern of its event type, or by its predicate
+func (i *subscriptionIndex) add(sub *subscription) {
+	i.seq++
+	sub.seq = i.seq
+
+	pattern := sub.eventType
+	switch {
+	case sub.when != nil:
+		i.predicates = append(i.predicates, sub)
+	case pattern == AllEvents:
+		i.all = append(i.all, sub)
+	case strings.HasPrefix(pattern, aggregatePrefix):
+		aggregateType := strings.TrimPrefix(pattern, aggregatePrefix)
+		i.aggregates[aggregateType] = append(i.aggregates[aggregateType], sub)
+	case strings.HasSuffix(pattern, "/..."):
+		root := strings.TrimSuffix(pattern, "/...")
+		i.prefixes[root+"/"] = append(i.prefixes[root+"/"], sub)
+		i.prefixes[root+"."] = append(i.prefixes[root+"."], sub)
+	case strings.HasSuffix(pattern, ".*"):
+		prefix := strings.TrimSuffix(pattern, "*")
+		i.prefixes[prefix] = append(i.prefixes[prefix], sub)
+	default:
+		i.exact[pattern] = append(i.exact[pattern], sub)
+	}
+
+	i.cache.Clear()
+}
+
+// match returns the subscriptions matching an event in subscription order
+func (i *subscriptionIndex) match(event Event) []*subscription {
+	static := i.matchTypes(event.Type(), event.AggregateType())
+	if len(i.predicates) == 0 {
+		return static
+	}
+
+	matches := append([]*subscription{}, static...)
+	for _, sub := range i.predicates {
+		if sub.when(event) {
+			matches = append(matches, sub)
+		}
+	}
+	sortSubscriptions(matches)
+	return matches
+}
+
+// matchTypes returns the cached subscriptions matching an event type and aggregate type
+func (i *subscriptionIndex) matchTypes(eventType string, aggregateType string) []*subscription {
+	key := eventType + "|" + aggregateType
+	if cached, ok := i.cache.Load(key); ok {
+		return cached.([]*subscription)
+	}
+
+	matches := append([]*subscription{}, i.exact[eventType]...)
+	matches = append(matches, i.aggregates[aggregateType]...)
+	for prefix, subs := range i.prefixes {
+		if strings.HasPrefix(eventType, prefix) {
+			matches = append(matches, subs...)
+		}
+	}
+	matches = append(matches, i.all...)
+	sortSubscriptions(matches)
+
+	i.cache.Store(key, matches)
+	return matches
+}
+
+// sortSubscriptions orders subscriptions the way they were subscribed
+func sortSubscriptions(subs []*subscription) {
+	sort.Slice(subs, func(a, b int) bool {
+		return subs[a].seq < subs[b].seq
+	})
+}
@@ -0,0 +1,313 @@
+package ddd_tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+	dddamqp "github.com/paulvitic/ddd-go/amqp"
+	"github.com/paulvitic/ddd-go/tests/test_server/test_context/domain/model"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeBroker stands in for a RabbitMQ broker, each dial opens a new connection with a single channel
+type fakeBroker struct {
+	channels   []*fakeChannel
+	declared   []string
+	published  []amqp.Publishing
+	nack       bool
+	unroutable bool
+	settled    map[uint64]string
+	mu         sync.Mutex
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{settled: make(map[uint64]string)}
+}
+
+func (b *fakeBroker) dial(url string) (dddamqp.Connection, error) {
+	return &fakeConnection{broker: b}, nil
+}
+
+// channel returns the channel opened last
+func (b *fakeBroker) channel() *fakeChannel {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.channels) == 0 {
+		return nil
+	}
+	return b.channels[len(b.channels)-1]
+}
+
+func (b *fakeBroker) settlement(tag uint64) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.settled[tag]
+}
+
+func (b *fakeBroker) Ack(tag uint64, multiple bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.settled[tag] = "ack"
+	return nil
+}
+
+func (b *fakeBroker) Nack(tag uint64, multiple bool, requeue bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if requeue {
+		b.settled[tag] = "requeue"
+	} else {
+		b.settled[tag] = "reject"
+	}
+	return nil
+}
+
+func (b *fakeBroker) Reject(tag uint64, requeue bool) error {
+	return b.Nack(tag, false, requeue)
+}
+
+type fakeConnection struct {
+	broker *fakeBroker
+	closed bool
+}
+
+func (c *fakeConnection) Channel() (dddamqp.Channel, error) {
+	ch := &fakeChannel{broker: c.broker, deliveries: make(chan amqp.Delivery, 10)}
+	c.broker.mu.Lock()
+	c.broker.channels = append(c.broker.channels, ch)
+	c.broker.mu.Unlock()
+	return ch, nil
+}
+
+func (c *fakeConnection) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error { return receiver }
+func (c *fakeConnection) IsClosed() bool                                         { return c.closed }
+func (c *fakeConnection) Close() error                                           { c.closed = true; return nil }
+
+type fakeChannel struct {
+	broker     *fakeBroker
+	deliveries chan amqp.Delivery
+	closers    []chan *amqp.Error
+	confirms   chan amqp.Confirmation
+	returns    chan amqp.Return
+	tag        uint64
+	closed     bool
+	mu         sync.Mutex
+}
+
+func (c *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error { return nil }
+
+func (c *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.broker.declared = append(c.broker.declared, "exchange:"+name)
+	return nil
+}
+
+func (c *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.broker.declared = append(c.broker.declared, "queue:"+name)
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (c *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return c.deliveries, nil
+}
+
+func (c *fakeChannel) Cancel(consumer string, noWait bool) error { return c.Close() }
+func (c *fakeChannel) Confirm(noWait bool) error                 { return nil }
+
+func (c *fakeChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	c.confirms = confirm
+	return confirm
+}
+
+func (c *fakeChannel) NotifyReturn(returns chan amqp.Return) chan amqp.Return {
+	c.returns = returns
+	return returns
+}
+
+func (c *fakeChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	c.broker.mu.Lock()
+	c.broker.published = append(c.broker.published, msg)
+	ack := !c.broker.nack
+	unroutable := c.broker.unroutable
+	c.broker.mu.Unlock()
+
+	if mandatory && unroutable {
+		c.returns <- amqp.Return{ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE", Exchange: exchange, RoutingKey: key}
+	}
+
+	c.tag++
+	c.confirms <- amqp.Confirmation{DeliveryTag: c.tag, Ack: ack}
+	return nil
+}
+
+func (c *fakeChannel) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closers = append(c.closers, receiver)
+	return receiver
+}
+
+func (c *fakeChannel) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.deliveries)
+		for _, closer := range c.closers {
+			close(closer)
+		}
+	}
+	return nil
+}
+
+func (c *fakeChannel) deliver(tag uint64, body string, redelivered bool) {
+	c.deliveries <- amqp.Delivery{Acknowledger: c.broker, DeliveryTag: tag, Body: []byte(body), Redelivered: redelivered}
+}
+
+func translateUserEvent(msg []byte) (ddd.Event, error) {
+	switch string(msg) {
+	case "invalid":
+		return nil, errors.New("invalid message")
+	case "unsupported":
+		return nil, ddd.Fatal(errors.New("unsupported message"))
+	}
+	user := model.LoadUser(ddd.NewID(string(msg)))
+	user.Register()
+	return user.GetFirstEvent(), nil
+}
+
+func startAmqpConsumer(t *testing.T, broker *fakeBroker) {
+	t.Helper()
+	config := &dddamqp.Config{
+		Queue:    "users",
+		Topology: dddamqp.Topology{Queues: []dddamqp.Queue{{Name: "users", Durable: true}}},
+	}
+	consumer := dddamqp.NewConsumer(config, translateUserEvent).WithDialer(broker.dial)
+
+	ctx := ddd.NewContext(context.Background(), mux.NewRouter(), "amqp").
+		WithResources(ddd.Resource(func() ddd.MessageConsumer { return consumer }, "usersConsumer"))
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	t.Cleanup(func() { ctx.Destroy() })
+
+	waitFor(t, time.Second, func() bool { return broker.channel() != nil })
+}
+
+func TestAmqpConsumerSettlesMessages(t *testing.T) {
+	broker := newFakeBroker()
+	startAmqpConsumer(t, broker)
+
+	ch := broker.channel()
+	ch.deliver(1, "1", false)
+	ch.deliver(2, "invalid", false)
+	ch.deliver(3, "invalid", true)
+	ch.deliver(4, "unsupported", false)
+
+	// Invalid messages are never requeued
+	expected := map[uint64]string{1: "ack", 2: "reject", 3: "reject", 4: "reject"}
+	for tag, settlement := range expected {
+		waitFor(t, time.Second, func() bool { return broker.settlement(tag) != "" })
+		if got := broker.settlement(tag); got != settlement {
+			t.Errorf("Expected message %d to be settled with %s, got %s", tag, settlement, got)
+		}
+	}
+}
+
+func TestAmqpConsumerRecoversLostChannel(t *testing.T) {
+	broker := newFakeBroker()
+	startAmqpConsumer(t, broker)
+
+	lost := broker.channel()
+	lost.Close()
+
+	waitFor(t, 2*time.Second, func() bool { return broker.channel() != lost })
+	broker.channel().deliver(1, "1", false)
+	waitFor(t, time.Second, func() bool { return broker.settlement(1) == "ack" })
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if len(broker.declared) != 2 {
+		t.Errorf("Expected the topology to be declared again on reconnection, got %v", broker.declared)
+	}
+}
+
+func TestAmqpConsumerCancelsMessagesOnShutdown(t *testing.T) {
+	broker := newFakeBroker()
+	handler := &blockingHandler{release: make(chan struct{})}
+	defer close(handler.release)
+
+	consumer := dddamqp.NewConsumer(&dddamqp.Config{Queue: "users", ShutdownTimeoutMs: 50}, translateUserEvent).
+		WithDialer(broker.dial)
+	ctx := ddd.NewContext(context.Background(), mux.NewRouter(), "amqp").
+		WithResources(
+			ddd.Resource(func() ddd.EventHandler { return handler }, "handler"),
+			ddd.Resource(func() ddd.MessageConsumer { return consumer }, "usersConsumer"),
+		)
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	t.Cleanup(func() { ctx.Destroy() })
+	waitFor(t, time.Second, func() bool { return broker.channel() != nil })
+
+	broker.channel().deliver(1, "1", false)
+	time.Sleep(20 * time.Millisecond)
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- consumer.OnDestroy() }()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the message being processed to be cancelled after the shutdown timeout")
+	}
+	if got := broker.settlement(1); got != "requeue" {
+		t.Errorf("Expected the cancelled message to be requeued, got %q", got)
+	}
+}
+
+func TestAmqpPublisherWaitsForConfirms(t *testing.T) {
+	broker := newFakeBroker()
+	publisher := dddamqp.NewPublisher(&dddamqp.Config{Exchange: "users"}, nil).WithDialer(broker.dial)
+	if err := publisher.OnStart(); err != nil {
+		t.Fatalf("Failed to start publisher: %v", err)
+	}
+	defer publisher.OnDestroy()
+
+	user := model.LoadUser(ddd.NewID("1"))
+	user.Register()
+	event := user.GetFirstEvent()
+
+	if err := publisher.Publish(event); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if broker.published[0].Type != event.Type() || broker.published[0].DeliveryMode != amqp.Persistent {
+		t.Errorf("Unexpected publishing %+v", broker.published[0])
+	}
+
+	broker.mu.Lock()
+	broker.nack = true
+	broker.mu.Unlock()
+	if err := publisher.Publish(event); !errors.Is(err, dddamqp.ErrNotConfirmed) {
+		t.Errorf("Expected a nacked message not to be confirmed, got %v", err)
+	}
+
+	// A message no queue receives is returned before it is confirmed
+	broker.mu.Lock()
+	broker.nack, broker.unroutable = false, true
+	broker.mu.Unlock()
+	if err := publisher.Publish(event); !errors.Is(err, dddamqp.ErrUnroutable) {
+		t.Errorf("Expected an unroutable message to fail, got %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package ddd_tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+)
+
+const jwtSecret = "test-jwt-secret"
+
+type securedEndpoint struct {
+	ddd.Endpoint
+	_ ddd.Route `route:"GET /status" handler:"Status"`
+	_ ddd.Route `route:"GET /reports" handler:"Reports" authenticated:"true"`
+	_ ddd.Route `route:"DELETE /reports/{id}" handler:"Remove" roles:"admin,owner" permissions:"reports:delete"`
+}
+
+func newSecuredEndpoint(logger *ddd.Logger, router *mux.Router) *securedEndpoint {
+	return &securedEndpoint{
+		Endpoint: ddd.NewEndpoint(&securedEndpoint{}, nil, logger, router),
+	}
+}
+
+func (e *securedEndpoint) Status(r *http.Request) (string, error) {
+	return "up", nil
+}
+
+func (e *securedEndpoint) Reports(ctx context.Context, request struct{}) (*ddd.Principal, error) {
+	return ddd.PrincipalOf(ctx), nil
+}
+
+func (e *securedEndpoint) Remove(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func startSecuredEndpoint(t *testing.T) *mux.Router {
+	t.Helper()
+	router := mux.NewRouter()
+	ctx := ddd.NewContext(context.Background(), router, "secured").
+		WithResources(
+			ddd.Resource(func() (*ddd.JwtAuthenticator, error) {
+				return ddd.NewJwtAuthenticator(&ddd.JwtConfig{Secret: jwtSecret, Issuer: "tests"})
+			}, "jwt"),
+			ddd.Resource(func() *ddd.ApiKeyAuthenticator {
+				return ddd.NewApiKeyAuthenticator("", map[string]*ddd.Principal{
+					"key-1": {ID: "reporting-job", Roles: []string{"owner"}, Permissions: []string{"reports:delete"}},
+				})
+			}, "apiKey"),
+			ddd.Resource(func() *ddd.BasicAuthenticator {
+				return ddd.NewBasicAuthenticator("reports", func(username, password string) (*ddd.Principal, error) {
+					if username == "ann" && password == "secret" {
+						return &ddd.Principal{ID: "ann"}, nil
+					}
+					return nil, nil
+				})
+			}, "basic"),
+			ddd.Resource(newSecuredEndpoint),
+		)
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	t.Cleanup(func() { ctx.Destroy() })
+	return router
+}
+
+func signedToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return token
+}
+
+func TestEndpointAuthentication(t *testing.T) {
+	router := startSecuredEndpoint(t)
+	valid := signedToken(t, jwt.MapClaims{"sub": "bob", "iss": "tests", "exp": time.Now().Add(time.Minute).Unix(), "roles": []string{"admin"}})
+	expired := signedToken(t, jwt.MapClaims{"sub": "bob", "iss": "tests", "exp": time.Now().Add(-time.Minute).Unix()})
+	foreign := signedToken(t, jwt.MapClaims{"sub": "bob", "iss": "elsewhere"})
+
+	tests := []struct {
+		name, target string
+		headers      map[string]string
+		status       int
+		principal    string
+	}{
+		{"public route", "/secured/status", nil, http.StatusOK, ""},
+		{"anonymous", "/secured/reports", nil, http.StatusUnauthorized, ""},
+		{"bearer token", "/secured/reports", map[string]string{"Authorization": "Bearer " + valid}, http.StatusOK, "bob"},
+		{"expired token", "/secured/reports", map[string]string{"Authorization": "Bearer " + expired}, http.StatusUnauthorized, ""},
+		{"other issuer", "/secured/reports", map[string]string{"Authorization": "Bearer " + foreign}, http.StatusUnauthorized, ""},
+		{"api key", "/secured/reports", map[string]string{"X-Api-Key": "key-1"}, http.StatusOK, "reporting-job"},
+		{"invalid api key", "/secured/status", map[string]string{"X-Api-Key": "key-2"}, http.StatusUnauthorized, ""},
+		{"basic credentials", "/secured/reports", map[string]string{"Authorization": "Basic YW5uOnNlY3JldA=="}, http.StatusOK, "ann"},
+		{"invalid password", "/secured/reports", map[string]string{"Authorization": "Basic YW5uOndyb25n"}, http.StatusUnauthorized, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", test.target, nil)
+			for name, value := range test.headers {
+				request.Header.Set(name, value)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Fatalf("Expected status %d, got %d (%s)", test.status, recorder.Code, recorder.Body.String())
+			}
+			if test.status == http.StatusUnauthorized {
+				challenges := strings.Join(recorder.Header().Values("WWW-Authenticate"), ", ")
+				if !strings.Contains(challenges, "Bearer") || !strings.Contains(challenges, `Basic realm="reports"`) {
+					t.Errorf("Expected the authentication challenges, got %q", challenges)
+				}
+			}
+			if test.principal != "" {
+				var principal ddd.Principal
+				json.Unmarshal(recorder.Body.Bytes(), &principal)
+				if principal.ID != test.principal {
+					t.Errorf("Expected principal %s, got %+v", test.principal, principal)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointAuthorization(t *testing.T) {
+	router := startSecuredEndpoint(t)
+	token := func(roles []string, permissions string) string {
+		return "Bearer " + signedToken(t, jwt.MapClaims{"sub": "bob", "iss": "tests", "roles": roles, "scope": permissions})
+	}
+
+	tests := []struct {
+		name, authorization string
+		status              int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"missing role", token([]string{"viewer"}, "reports:delete"), http.StatusForbidden},
+		{"missing permission", token([]string{"admin"}, "reports:read"), http.StatusForbidden},
+		{"authorized", token([]string{"admin"}, "reports:read reports:delete"), http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("DELETE", "/secured/reports/1", nil)
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != test.status {
+				t.Errorf("Expected status %d, got %d (%s)", test.status, recorder.Code, recorder.Body.String())
+			}
+			if test.status >= http.StatusBadRequest && recorder.Header().Get("Content-Type") != ddd.ProblemContentType {
+				t.Errorf("Expected a problem, got %s", recorder.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+// writeJwks writes the public keys of a JWKS file
+func writeJwks(t *testing.T, path string, keys map[string]any) {
+	t.Helper()
+	encode := func(value *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(value.Bytes())
+	}
+	jwks := make([]map[string]string, 0, len(keys))
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, map[string]string{"kty": "RSA", "kid": kid, "n": encode(key.N), "e": encode(big.NewInt(int64(key.E)))})
+		case *ecdsa.PublicKey:
+			jwks = append(jwks, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": encode(key.X), "y": encode(key.Y)})
+		}
+	}
+	data, _ := json.Marshal(map[string]any{"keys": jwks})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write jwks: %v", err)
+	}
+}
+
+func TestJwtAuthenticatorVerifiesJwksKeys(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rotatedKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJwks(t, path, map[string]any{"rsa-1": &rsaKey.PublicKey, "ec-1": &ecKey.PublicKey})
+	authenticator, err := ddd.NewJwtAuthenticator(&ddd.JwtConfig{JwksFile: path, RolesClaim: "groups"})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "carol", "groups": "admin auditor"})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return signed
+	}
+	authenticate := func(token string) (*ddd.Principal, error) {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		return authenticator.Authenticate(request)
+	}
+
+	principal, err := authenticate(sign(jwt.SigningMethodRS256, "rsa-1", rsaKey))
+	if err != nil || principal.ID != "carol" || !principal.HasRole("auditor") || principal.Method != "jwt" {
+		t.Errorf("Expected an RSA signed token to authenticate carol, got %+v (%v)", principal, err)
+	}
+	if _, err := authenticate(sign(jwt.SigningMethodES256, "ec-1", ecKey)); err != nil {
+		t.Errorf("Expected an ECDSA signed token to authenticate, got %v", err)
+	}
+	if _, err := authenticate(sign(jwt.SigningMethodRS256, "ec-1", rsaKey)); err == nil {
+		t.Error("Expected a token signed with another key to be rejected")
+	}
+	if _, err := authenticate(sign(jwt.SigningMethodHS256, "rsa-1", []byte("guessed"))); err == nil {
+		t.Error("Expected an HMAC token to be rejected by RSA keys")
+	}
+
+	// Keys rotated into the file are picked up
+	time.Sleep(10 * time.Millisecond)
+	writeJwks(t, path, map[string]any{"rsa-2": &rotatedKey.PublicKey})
+	if _, err := authenticate(sign(jwt.SigningMethodRS256, "rsa-2", rotatedKey)); err != nil {
+		t.Errorf("Expected a rotated key to be loaded, got %v", err)
+	}
+}
+
+type auditedAccount struct {
+	ddd.Aggregate
+}
+
+type accountOpened struct {
+	Owner string `json:"owner"`
+}
+
+func TestEventsCarryActingPrincipal(t *testing.T) {
+	ctx := ddd.WithPrincipal(context.Background(), &ddd.Principal{
+		ID: "dave", Roles: []string{"clerk"}, Claims: map[string]any{"email": "dave@example.com"}, Method: "jwt",
+	})
+	account := &auditedAccount{ddd.NewAggregate(ddd.GenerateUUID(), auditedAccount{})}
+
+	acting := ddd.ActingFor(ctx)
+	acting.Act(account)
+	account.RaiseEvent(accountOpened{Owner: "dave"})
+	event := account.GetFirstEvent()
+
+	if principal := ddd.EventPrincipal(event); principal == nil || principal.ID != "dave" {
+		t.Fatalf("Expected the event to carry the acting principal, got %+v", principal)
+	}
+
+	jsonString, err := event.ToJsonString()
+	if err != nil {
+		t.Fatalf("Failed to serialize event: %v", err)
+	}
+	restored, err := ddd.EventFromJsonString(jsonString)
+	if err != nil {
+		t.Fatalf("Failed to deserialize event: %v", err)
+	}
+	principal := ddd.EventPrincipal(restored)
+	if principal == nil || principal.ID != "dave" || principal.Method != "jwt" {
+		t.Errorf("Expected the audit identity to survive serialization, got %+v", principal)
+	}
+	if principal != nil && (principal.Roles != nil || principal.Claims != nil) {
+		t.Errorf("Expected roles and claims not to be serialized, got %+v", principal)
+	}
+}
@@ -0,0 +1,204 @@
+package ddd_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+)
+
+type orderRequest struct {
+	XMLName  xml.Name              `json:"-" xml:"order"`
+	Shop     string                `json:"shop" xml:"shop" path:"shop"`
+	Tags     []string              `json:"tags" xml:"tag" query:"tag"`
+	Limit    *int                  `json:"limit" xml:"limit" query:"limit"`
+	Since    time.Time             `json:"since" xml:"since" query:"since"`
+	Timeout  time.Duration         `json:"timeout" xml:"timeout" header:"X-Timeout"`
+	Item     string                `json:"item" xml:"item" form:"item"`
+	Quantity int                   `json:"quantity" xml:"quantity" form:"quantity"`
+	Receipt  *multipart.FileHeader `json:"-" xml:"-" form:"receipt"`
+	Filename string                `json:"filename,omitempty" xml:"filename,omitempty"`
+}
+
+type orderEndpoint struct {
+	ddd.Endpoint
+	_      ddd.Route `route:"POST /shops/{shop}/orders" handler:"Place"`
+	placed *atomic.Int32
+}
+
+func newOrderEndpoint(placed *atomic.Int32) func(*ddd.Logger, *mux.Router) *orderEndpoint {
+	return func(logger *ddd.Logger, router *mux.Router) *orderEndpoint {
+		endpoint := &orderEndpoint{placed: placed}
+		endpoint.Endpoint = ddd.NewEndpoint(endpoint, nil, logger, router)
+		return endpoint
+	}
+}
+
+func (e *orderEndpoint) Place(ctx context.Context, request orderRequest) (orderRequest, error) {
+	e.placed.Add(1)
+	if request.Receipt != nil {
+		request.Filename = request.Receipt.Filename
+	}
+	return request, nil
+}
+
+func startOrderEndpoint(t *testing.T, resources ...any) (*mux.Router, *atomic.Int32) {
+	t.Helper()
+	placed := &atomic.Int32{}
+	router := mux.NewRouter()
+	ctx := ddd.NewContext(context.Background(), router, "orders").
+		WithResources(ddd.Resource(newOrderEndpoint(placed)))
+	for _, factory := range resources {
+		ctx.WithResources(ddd.Resource(factory))
+	}
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	t.Cleanup(func() { ctx.Destroy() })
+	return router, placed
+}
+
+func placeOrder(router http.Handler, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("POST", target, strings.NewReader(body))
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRequestBinding(t *testing.T) {
+	router, _ := startOrderEndpoint(t)
+
+	recorder := placeOrder(router, "/orders/shops/north/orders?tag=gift&tag=fragile&limit=3&since=2024-05-01T10:00:00Z",
+		`{"item":"tea","quantity":2}`, map[string]string{"X-Timeout": "5s"})
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d (%s)", recorder.Code, recorder.Body.String())
+	}
+	var order orderRequest
+	json.Unmarshal(recorder.Body.Bytes(), &order)
+	if order.Shop != "north" || order.Item != "tea" || order.Quantity != 2 || order.Timeout != 5*time.Second {
+		t.Errorf("Expected the path, body and header to be bound, got %+v", order)
+	}
+	if strings.Join(order.Tags, ",") != "gift,fragile" || order.Limit == nil || *order.Limit != 3 ||
+		!order.Since.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the query to be bound, got %+v", order)
+	}
+
+	t.Run("Form", func(t *testing.T) {
+		recorder := placeOrder(router, "/orders/shops/north/orders", "item=tea&quantity=4",
+			map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+		var order orderRequest
+		json.Unmarshal(recorder.Body.Bytes(), &order)
+		if recorder.Code != http.StatusCreated || order.Item != "tea" || order.Quantity != 4 {
+			t.Errorf("Expected the form to be bound, got %d %+v", recorder.Code, order)
+		}
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("item", "coffee")
+		file, _ := form.CreateFormFile("receipt", "receipt.pdf")
+		io.WriteString(file, "%PDF")
+		form.Close()
+
+		recorder := placeOrder(router, "/orders/shops/north/orders", body.String(),
+			map[string]string{"Content-Type": form.FormDataContentType()})
+		var order orderRequest
+		json.Unmarshal(recorder.Body.Bytes(), &order)
+		if recorder.Code != http.StatusCreated || order.Item != "coffee" || order.Filename != "receipt.pdf" {
+			t.Errorf("Expected the multipart form and its file to be bound, got %d %+v", recorder.Code, order)
+		}
+	})
+
+	t.Run("Xml", func(t *testing.T) {
+		recorder := placeOrder(router, "/orders/shops/north/orders", `<order><item>tea</item><quantity>1</quantity></order>`,
+			map[string]string{"Content-Type": "application/xml", "Accept": "application/xml"})
+		if recorder.Code != http.StatusCreated || recorder.Header().Get("Content-Type") != "application/xml" {
+			t.Fatalf("Expected an xml response, got %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+		}
+		var order orderRequest
+		if err := xml.Unmarshal(recorder.Body.Bytes(), &order); err != nil || order.Item != "tea" || order.Shop != "north" {
+			t.Errorf("Expected the xml order, got %+v (%v)", order, err)
+		}
+	})
+
+	t.Run("StructuredSuffix", func(t *testing.T) {
+		recorder := placeOrder(router, "/orders/shops/north/orders", `{"item":"tea"}`,
+			map[string]string{"Content-Type": "application/merge-patch+json"})
+		if recorder.Code != http.StatusCreated || !strings.Contains(recorder.Body.String(), `"item":"tea"`) {
+			t.Errorf("Expected a +json body to be decoded as json, got %d %s", recorder.Code, recorder.Body.String())
+		}
+	})
+
+	t.Run("InvalidHeader", func(t *testing.T) {
+		recorder := placeOrder(router, "/orders/shops/north/orders", `{}`, map[string]string{"X-Timeout": "soon"})
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", recorder.Code)
+		}
+	})
+}
+
+func TestContentNegotiation(t *testing.T) {
+	router, placed := startOrderEndpoint(t)
+
+	tests := []struct {
+		name, contentType, accept string
+		status                    int
+		responseType              string
+	}{
+		{"no accept header", "", "", http.StatusCreated, "application/json"},
+		{"any media type", "", "*/*", http.StatusCreated, "application/json"},
+		{"preferred media type", "", "application/json;q=0.5, application/xml", http.StatusCreated, "application/xml"},
+		{"media type range", "", "text/*", http.StatusCreated, "text/xml"},
+		{"unsupported content type", "text/csv", "", http.StatusUnsupportedMediaType, ddd.ProblemContentType},
+		{"unacceptable media type", "", "text/csv", http.StatusNotAcceptable, ddd.ProblemContentType},
+		{"refused media type", "", "application/json;q=0, application/xml;q=0, text/xml;q=0", http.StatusNotAcceptable, ddd.ProblemContentType},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := placeOrder(router, "/orders/shops/north/orders", `{"item":"tea"}`,
+				map[string]string{"Content-Type": test.contentType, "Accept": test.accept})
+			if recorder.Code != test.status {
+				t.Errorf("Expected status %d, got %d (%s)", test.status, recorder.Code, recorder.Body.String())
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != test.responseType {
+				t.Errorf("Expected content type %s, got %s", test.responseType, contentType)
+			}
+		})
+	}
+
+	// Unacceptable requests are refused before they are handled
+	if count := placed.Load(); count != 4 {
+		t.Errorf("Expected 4 orders to be placed, got %d", count)
+	}
+}
+
+func TestCodecsResource(t *testing.T) {
+	router, _ := startOrderEndpoint(t, func() *ddd.Codecs {
+		return ddd.NewCodecs().WithEncoder("text/csv", func(w io.Writer, body any) error {
+			order := body.(orderRequest)
+			_, err := fmt.Fprintf(w, "%s,%s,%d\n", order.Shop, order.Item, order.Quantity)
+			return err
+		})
+	})
+
+	recorder := placeOrder(router, "/orders/shops/north/orders", `{"item":"tea","quantity":2}`, map[string]string{"Accept": "text/csv"})
+	if recorder.Code != http.StatusCreated || recorder.Body.String() != "north,tea,2\n" {
+		t.Errorf("Expected a csv response, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
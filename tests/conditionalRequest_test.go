@@ -0,0 +1,200 @@
+package ddd_tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+)
+
+type account struct {
+	ddd.Aggregate `json:"-"`
+	Balance       int `json:"balance"`
+}
+
+// accountRepository stores the balances of accounts with their versions
+type accountRepository struct {
+	balances map[string]int
+	versions map[string]int
+	mu       sync.Mutex
+}
+
+func (r *accountRepository) Load(id ddd.ID) (*account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	balance, ok := r.balances[id.String()]
+	if !ok {
+		return nil, ddd.NotFound("no account " + id.String())
+	}
+	loaded := &account{Aggregate: ddd.NewAggregate(id, account{}), Balance: balance}
+	loaded.SetVersion(r.versions[id.String()])
+	return loaded, nil
+}
+
+func (r *accountRepository) Update(updated *account) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := updated.ID().String()
+	if err := ddd.CheckVersion(updated, r.versions[id]); err != nil {
+		return err
+	}
+	r.balances[id] = updated.Balance
+	r.versions[id]++
+	updated.SetVersion(r.versions[id])
+	return nil
+}
+
+type depositRequest struct {
+	ID     string `json:"-" path:"id"`
+	Amount int    `json:"amount"`
+}
+
+type accountsEndpoint struct {
+	ddd.Endpoint
+	_          ddd.Route `route:"GET /accounts" handler:"List"`
+	_          ddd.Route `route:"GET /accounts/{id}" handler:"Get"`
+	_          ddd.Route `route:"PUT /accounts/{id}/deposits" handler:"Deposit"`
+	repository *accountRepository
+}
+
+func newAccountsEndpoint(repository *accountRepository) func(*ddd.Logger, *mux.Router) *accountsEndpoint {
+	return func(logger *ddd.Logger, router *mux.Router) *accountsEndpoint {
+		endpoint := &accountsEndpoint{repository: repository}
+		endpoint.Endpoint = ddd.NewEndpoint(endpoint, nil, logger, router)
+		return endpoint
+	}
+}
+
+type accountBalance struct {
+	ID      string `json:"id" xml:"id"`
+	Balance int    `json:"balance" xml:"balance"`
+}
+
+func (e *accountsEndpoint) List(r *http.Request) ([]accountBalance, error) {
+	e.repository.mu.Lock()
+	defer e.repository.mu.Unlock()
+	balances := make([]accountBalance, 0, len(e.repository.balances))
+	for id, balance := range e.repository.balances {
+		balances = append(balances, accountBalance{ID: id, Balance: balance})
+	}
+	return balances, nil
+}
+
+func (e *accountsEndpoint) Get(ctx context.Context, request depositRequest) (*account, error) {
+	return e.repository.Load(ddd.NewID(request.ID))
+}
+
+func (e *accountsEndpoint) Deposit(ctx context.Context, request depositRequest) (*account, error) {
+	deposited, err := e.repository.Load(ddd.NewID(request.ID))
+	if err != nil {
+		return nil, err
+	}
+	if err := ddd.ExpectVersion(ctx, deposited); err != nil {
+		return nil, err
+	}
+	deposited.Balance += request.Amount
+	return deposited, e.repository.Update(deposited)
+}
+
+func startAccountsEndpoint(t *testing.T) (*mux.Router, *accountRepository) {
+	t.Helper()
+	repository := &accountRepository{balances: map[string]int{"a": 10}, versions: map[string]int{"a": 1}}
+	router := mux.NewRouter()
+	ctx := ddd.NewContext(context.Background(), router, "bank").
+		WithResources(ddd.Resource(newAccountsEndpoint(repository)))
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	t.Cleanup(func() { ctx.Destroy() })
+	return router, repository
+}
+
+func conditional(router http.Handler, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestConditionalGet(t *testing.T) {
+	router, _ := startAccountsEndpoint(t)
+
+	recorder := conditional(router, "GET", "/bank/accounts/a", "", nil)
+	if etag := recorder.Header().Get("ETag"); recorder.Code != http.StatusOK || etag != `W/"1"` {
+		t.Fatalf("Expected the version of the account as its ETag, got %d %q", recorder.Code, etag)
+	}
+
+	recorder = conditional(router, "GET", "/bank/accounts/a", "", map[string]string{"If-None-Match": `"0", W/"1"`})
+	if recorder.Code != http.StatusNotModified || recorder.Body.Len() != 0 || recorder.Header().Get("ETag") != `W/"1"` {
+		t.Errorf("Expected 304 for the current version, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	// Responses without a version are tagged by a hash of their body
+	list := conditional(router, "GET", "/bank/accounts", "", nil)
+	etag := list.Header().Get("ETag")
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("Expected a strong ETag, got %q", etag)
+	}
+	if recorder := conditional(router, "GET", "/bank/accounts", "", map[string]string{"If-None-Match": etag}); recorder.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged body, got %d", recorder.Code)
+	}
+	if recorder := conditional(router, "GET", "/bank/accounts", "", map[string]string{"If-None-Match": etag, "Accept": "application/xml"}); recorder.Code != http.StatusOK {
+		t.Errorf("Expected another representation not to match the ETag, got %d", recorder.Code)
+	}
+
+	conditional(router, "PUT", "/bank/accounts/a/deposits", `{"amount":5}`, nil)
+	if recorder := conditional(router, "GET", "/bank/accounts", "", map[string]string{"If-None-Match": etag}); recorder.Code != http.StatusOK {
+		t.Errorf("Expected the changed body, got %d", recorder.Code)
+	}
+}
+
+func TestConditionalUpdate(t *testing.T) {
+	router, repository := startAccountsEndpoint(t)
+
+	tests := []struct {
+		name, ifMatch string
+		status        int
+		etag          string
+	}{
+		{"current version", `W/"1"`, http.StatusOK, `W/"2"`},
+		{"stale version", `W/"1"`, http.StatusPreconditionFailed, ""},
+		{"strong version tag", `"2"`, http.StatusOK, `W/"3"`},
+		{"any version", "*", http.StatusOK, `W/"4"`},
+		{"one of several versions", `W/"1", W/"4"`, http.StatusOK, `W/"5"`},
+		{"no version", `"abc"`, http.StatusPreconditionFailed, ""},
+		{"no precondition", "", http.StatusOK, `W/"6"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := conditional(router, "PUT", "/bank/accounts/a/deposits", `{"amount":1}`, map[string]string{"If-Match": test.ifMatch})
+			if recorder.Code != test.status {
+				t.Fatalf("Expected status %d, got %d (%s)", test.status, recorder.Code, recorder.Body.String())
+			}
+			if etag := recorder.Header().Get("ETag"); etag != test.etag {
+				t.Errorf("Expected ETag %q, got %q", test.etag, etag)
+			}
+		})
+	}
+	if balance := repository.balances["a"]; balance != 15 {
+		t.Errorf("Expected the refused deposits not to be stored, got balance %d", balance)
+	}
+
+	// Changes made since an aggregate was loaded fail the optimistic concurrency check
+	first, _ := repository.Load(ddd.NewID("a"))
+	second, _ := repository.Load(ddd.NewID("a"))
+	if err := repository.Update(first); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if err := repository.Update(second); !errors.Is(err, ddd.ErrVersionConflict) {
+		t.Errorf("Expected a version conflict, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package ddd_tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paulvitic/ddd-go"
+)
+
+func translateUserRecord(msg []byte) (ddd.Event, error) {
+	var record struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(msg, &record); err != nil {
+		return nil, err
+	}
+	return translateUserEvent([]byte(record.ID))
+}
+
+func startDirectoryConsumer(t *testing.T, config ddd.DirectoryConsumerConfig, handler ddd.EventHandler) {
+	t.Helper()
+	startDirectoryConsumerOn(t, config, startEventBus(t, handler))
+}
+
+func startDirectoryConsumerOn(t *testing.T, config ddd.DirectoryConsumerConfig, eventBus *ddd.EventBus) {
+	t.Helper()
+	config.SettleMs = -1
+	consumer := ddd.NewDirectoryConsumer(config, translateUserRecord)
+	consumer.SetEventBus(eventBus)
+	if err := consumer.OnStart(); err != nil {
+		t.Fatalf("Failed to start consumer: %v", err)
+	}
+	t.Cleanup(func() { consumer.OnDestroy() })
+}
+
+func writeDropFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestDirectoryConsumerArchivesConsumedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeDropFile(t, filepath.Join(dir, "users.csv"), "id,name\n1,Ann\n2,Bob\n")
+
+	handler := &failingHandler{}
+	startDirectoryConsumer(t, ddd.DirectoryConsumerConfig{Dir: dir, Pattern: "*.csv", Format: ddd.CSV}, handler)
+
+	waitFor(t, 2*time.Second, func() bool { return exists(filepath.Join(dir, "archive", "users.csv")) })
+	if handler.calls.Load() != 2 {
+		t.Errorf("Expected 2 records to be handled, got %d", handler.calls.Load())
+	}
+	if exists(filepath.Join(dir, ".progress", "users.csv.progress")) {
+		t.Error("Expected the progress of an archived file to be removed")
+	}
+}
+
+func TestDirectoryConsumerResumesInterruptedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeDropFile(t, filepath.Join(dir, "users.ndjson"), "{\"id\":\"1\"}\n\n{\"id\":\"2\"}\n{\"id\":\"3\"}\n")
+	os.MkdirAll(filepath.Join(dir, ".progress"), 0755)
+	writeDropFile(t, filepath.Join(dir, ".progress", "users.ndjson.progress"), "2")
+
+	handler := &failingHandler{}
+	startDirectoryConsumer(t, ddd.DirectoryConsumerConfig{Dir: dir}, handler)
+
+	waitFor(t, 2*time.Second, func() bool { return exists(filepath.Join(dir, "archive", "users.ndjson")) })
+	if handler.calls.Load() != 1 {
+		t.Errorf("Expected only the last record to be handled, got %d", handler.calls.Load())
+	}
+}
+
+func TestDirectoryConsumerMovesInvalidFilesToErrorDir(t *testing.T) {
+	dir := t.TempDir()
+	writeDropFile(t, filepath.Join(dir, "users.ndjson"), "{\"id\":\"1\"}\n{\"id\":\"invalid\"}\n{\"id\":\"3\"}\n")
+
+	handler := &failingHandler{}
+	startDirectoryConsumer(t, ddd.DirectoryConsumerConfig{Dir: dir}, handler)
+
+	report := filepath.Join(dir, "error", "users.ndjson.error")
+	waitFor(t, 2*time.Second, func() bool { return exists(report) })
+	if !exists(filepath.Join(dir, "error", "users.ndjson")) {
+		t.Error("Expected the file to be moved to the error directory")
+	}
+	if handler.calls.Load() != 1 {
+		t.Errorf("Expected processing to stop at the invalid record, got %d calls", handler.calls.Load())
+	}
+	if content, _ := os.ReadFile(report); !strings.Contains(string(content), "record: 2\n") {
+		t.Errorf("Expected the report to name the failing record, got %q", content)
+	}
+}
+
+func TestDirectoryConsumerAcknowledgesSpilledRecords(t *testing.T) {
+	handler := &blockingHandler{release: make(chan struct{})}
+	eventBus := startConfiguredEventBus(t, &ddd.EventBusConfig{
+		WorkerCount:     1,
+		QueueSize:       1,
+		OverflowPolicy:  ddd.OverflowSpill,
+		SpillDir:        t.TempDir(),
+		ScaleIntervalMs: 5,
+	}, handler)
+
+	// The first event is taken by the worker, the second fills the queue, the records are spilled
+	dispatchUserRegistered(eventBus, "1")
+	time.Sleep(20 * time.Millisecond)
+	dispatchUserRegistered(eventBus, "2")
+
+	dir := t.TempDir()
+	writeDropFile(t, filepath.Join(dir, "users.ndjson"), "{\"id\":\"3\"}\n{\"id\":\"4\"}\n")
+	startDirectoryConsumerOn(t, ddd.DirectoryConsumerConfig{Dir: dir}, eventBus)
+
+	waitFor(t, 2*time.Second, func() bool { return exists(filepath.Join(dir, "archive", "users.ndjson")) })
+	if exists(filepath.Join(dir, "error", "users.ndjson")) {
+		t.Error("Expected spilled records not to move the file to the error directory")
+	}
+
+	close(handler.release)
+	waitFor(t, 2*time.Second, func() bool { return handler.handled.Load() == 4 })
+}
@@ -0,0 +1,206 @@
+package ddd_tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+)
+
+type greeting struct {
+	Name  string `json:"name" path:"name"`
+	Times int    `json:"times" query:"times"`
+	Note  string `json:"note"`
+}
+
+var errGreetingRefused = errors.New("greeting refused")
+
+type typedEndpoint struct {
+	ddd.Endpoint
+}
+
+func newTypedEndpoint(logger *ddd.Logger, router *mux.Router) *typedEndpoint {
+	return &typedEndpoint{
+		Endpoint: ddd.NewEndpoint(&typedEndpoint{}, []string{"/greetings/{name}"}, logger, router),
+	}
+}
+
+func (e *typedEndpoint) Get(r *http.Request) (*greeting, error) {
+	if mux.Vars(r)["name"] == "nobody" {
+		return nil, nil
+	}
+	return &greeting{Name: mux.Vars(r)["name"]}, nil
+}
+
+func (e *typedEndpoint) Post(ctx context.Context, request greeting) (greeting, error) {
+	if request.Name == "refused" {
+		return greeting{}, errGreetingRefused
+	}
+	return request, nil
+}
+
+func (e *typedEndpoint) Delete(ctx context.Context, request *greeting) (*ddd.Response, error) {
+	return ddd.NewResponse(http.StatusAccepted, map[string]string{"deleted": request.Name}), nil
+}
+
+func startTypedEndpoint(t *testing.T, resources ...any) *mux.Router {
+	t.Helper()
+	router := mux.NewRouter()
+	ctx := ddd.NewContext(context.Background(), router, "typed").
+		WithResources(ddd.Resource(newTypedEndpoint))
+	for _, factory := range resources {
+		ctx.WithResources(ddd.Resource(factory))
+	}
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	t.Cleanup(func() { ctx.Destroy() })
+	return router
+}
+
+func serve(router http.Handler, method string, target string, body string) *httptest.ResponseRecorder {
+	var request *http.Request
+	if body == "" {
+		request = httptest.NewRequest(method, target, nil)
+	} else {
+		request = httptest.NewRequest(method, target, strings.NewReader(body))
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestTypedEndpointHandlers(t *testing.T) {
+	router := startTypedEndpoint(t)
+
+	tests := []struct {
+		name, method, target, body string
+		status                     int
+		response                   string
+	}{
+		{"request handler", "GET", "/typed/greetings/ann", "", http.StatusOK, `{"name":"ann","times":0,"note":""}`},
+		{"nil result", "GET", "/typed/greetings/nobody", "", http.StatusNoContent, ""},
+		{"decoded request", "POST", "/typed/greetings/bob?times=2", `{"note":"hi"}`, http.StatusCreated, `{"name":"bob","times":2,"note":"hi"}`},
+		{"explicit response", "DELETE", "/typed/greetings/bob", "", http.StatusAccepted, `{"deleted":"bob"}`},
+		{"malformed body", "POST", "/typed/greetings/bob", `{`, http.StatusBadRequest, ""},
+		{"malformed parameter", "POST", "/typed/greetings/bob?times=two", "", http.StatusBadRequest, ""},
+		{"handler error", "POST", "/typed/greetings/refused", "", http.StatusInternalServerError, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := serve(router, test.method, test.target, test.body)
+			if recorder.Code != test.status {
+				t.Errorf("Expected status %d, got %d (%s)", test.status, recorder.Code, recorder.Body.String())
+			}
+			if test.response != "" && strings.TrimSpace(recorder.Body.String()) != test.response {
+				t.Errorf("Expected body %s, got %s", test.response, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestTypedEndpointUsesErrorMapperResource(t *testing.T) {
+	router := startTypedEndpoint(t, func() ddd.ErrorMapper {
+		return ddd.ErrorMapperFunc(func(err error) (int, any) {
+			if errors.Is(err, errGreetingRefused) {
+				return http.StatusConflict, map[string]string{"error": err.Error()}
+			}
+			return ddd.DefaultErrorMapper().MapError(err)
+		})
+	})
+
+	recorder := serve(router, "POST", "/typed/greetings/refused", "")
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("Expected the mapped status 409, got %d", recorder.Code)
+	}
+	if recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected a json error body, got %s", recorder.Header().Get("Content-Type"))
+	}
+}
+
+type routedEndpoint struct {
+	ddd.Endpoint
+	_ ddd.Route `route:"GET /books/{bookId}" handler:"Book" name:"book"`
+}
+
+func newRoutedEndpoint(logger *ddd.Logger, router *mux.Router) *routedEndpoint {
+	return &routedEndpoint{
+		Endpoint: ddd.NewEndpoint(&routedEndpoint{}, []string{"/books"}, logger, router),
+	}
+}
+
+func (e *routedEndpoint) Routes() []ddd.Route {
+	return []ddd.Route{{Method: ddd.GET, Path: "/books", Handler: "List"}}
+}
+
+func (e *routedEndpoint) List(r *http.Request) ([]string, error) {
+	return []string{"list"}, nil
+}
+
+func (e *routedEndpoint) Book(r *http.Request) (string, error) {
+	return mux.Vars(r)["bookId"], nil
+}
+
+func (e *routedEndpoint) Delete(r *http.Request) (any, error) {
+	return nil, nil
+}
+
+func TestEndpointDeclaredRoutes(t *testing.T) {
+	router := startTypedEndpoint(t, newRoutedEndpoint)
+
+	tests := []struct {
+		name, method, target string
+		status               int
+		response             string
+	}{
+		{"route table", "GET", "/typed/books", http.StatusOK, `["list"]`},
+		{"route tag", "GET", "/typed/books/42", http.StatusOK, `"42"`},
+		{"naming convention", "DELETE", "/typed/books", http.StatusNoContent, ""},
+		{"undeclared method", "DELETE", "/typed/books/42", http.StatusMethodNotAllowed, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := serve(router, test.method, test.target, "")
+			if recorder.Code != test.status {
+				t.Errorf("Expected status %d, got %d", test.status, recorder.Code)
+			}
+			if test.response != "" && strings.TrimSpace(recorder.Body.String()) != test.response {
+				t.Errorf("Expected body %s, got %s", test.response, recorder.Body.String())
+			}
+		})
+	}
+
+	if url, err := router.Get("book").URL("bookId", "7"); err != nil || url.Path != "/typed/books/7" {
+		t.Errorf("Expected the named route to build urls, got %v (%v)", url, err)
+	}
+}
+
+type conflictingEndpoint struct {
+	ddd.Endpoint
+	_ ddd.Route `route:"GET /books/{id}" handler:"Book"`
+}
+
+func (e *conflictingEndpoint) Book(r *http.Request) (string, error) {
+	return "conflict", nil
+}
+
+func TestEndpointRouteConflictsFailContextStart(t *testing.T) {
+	ctx := ddd.NewContext(context.Background(), mux.NewRouter(), "conflicts").
+		WithResources(
+			ddd.Resource(newRoutedEndpoint),
+			ddd.Resource(func(logger *ddd.Logger, router *mux.Router) *conflictingEndpoint {
+				return &conflictingEndpoint{
+					Endpoint: ddd.NewEndpoint(&conflictingEndpoint{}, nil, logger, router),
+				}
+			}),
+		)
+
+	if err := ctx.Start(); !errors.Is(err, ddd.ErrRouteConflict) {
+		t.Errorf("Expected a route conflict, got %v", err)
+	}
+}
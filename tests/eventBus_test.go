@@ -0,0 +1,534 @@
+package ddd_tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+	"github.com/paulvitic/ddd-go/tests/test_server/test_context/domain/model"
+)
+
+// failingHandler fails the first failures calls, then succeeds
+type failingHandler struct {
+	failures int32
+	err      error
+	calls    atomic.Int32
+}
+
+func (h *failingHandler) SubscribedTo() map[string]ddd.HandleEvent {
+	return map[string]ddd.HandleEvent{
+		ddd.EventType(model.UserRegistered{}): h.onUserRegistered,
+	}
+}
+
+func (h *failingHandler) RetryPolicy() ddd.RetryPolicy {
+	return ddd.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+}
+
+func (h *failingHandler) onUserRegistered(event ddd.Event) error {
+	if h.calls.Add(1) <= h.failures {
+		return h.err
+	}
+	return nil
+}
+
+// startEventBus creates a started context with the given event handler and returns its event bus
+func startEventBus(t *testing.T, handler ddd.EventHandler) *ddd.EventBus {
+	t.Helper()
+	ctx := ddd.NewContext(context.Background(), mux.NewRouter(), "events").
+		WithResources(ddd.Resource(func() ddd.EventHandler { return handler }, "handler"))
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+
+	eventBus, err := ddd.Resolve[*ddd.EventBus](ctx)
+	if err != nil {
+		t.Fatalf("Failed to resolve event bus: %v", err)
+	}
+	t.Cleanup(func() { eventBus.Stop() })
+	return eventBus
+}
+
+func registerUser(t *testing.T, eventBus *ddd.EventBus, id string) {
+	t.Helper()
+	user := model.LoadUser(ddd.NewID(id))
+	user.Register()
+	if err := eventBus.DispatchFrom(user); err != nil {
+		t.Fatalf("Failed to dispatch: %v", err)
+	}
+}
+
+// waitFor polls a condition until it holds or the timeout expires
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition not met before timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEventBusRetriesTransientErrors(t *testing.T) {
+	handler := &failingHandler{failures: 2, err: errors.New("transient")}
+	eventBus := startEventBus(t, handler)
+
+	registerUser(t, eventBus, "1")
+
+	waitFor(t, time.Second, func() bool { return handler.calls.Load() == 3 })
+
+	letters, _ := eventBus.DeadLetters()
+	if len(letters) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(letters))
+	}
+}
+
+func TestEventBusDeadLettersFatalErrors(t *testing.T) {
+	handler := &failingHandler{failures: 1, err: ddd.Fatal(errors.New("rejected"))}
+	eventBus := startEventBus(t, handler)
+
+	registerUser(t, eventBus, "1")
+
+	var letters []*ddd.DeadLetter
+	waitFor(t, time.Second, func() bool {
+		letters, _ = eventBus.DeadLetters()
+		return len(letters) == 1
+	})
+
+	if handler.calls.Load() != 1 {
+		t.Errorf("Expected fatal error not to be retried, got %d calls", handler.calls.Load())
+	}
+	if letters[0].Handler != "failingHandler" || letters[0].Attempts != 1 {
+		t.Errorf("Unexpected dead letter %+v", letters[0])
+	}
+
+	if err := eventBus.Replay(letters[0].ID); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if letters, _ = eventBus.DeadLetters(); len(letters) != 0 {
+		t.Errorf("Expected replayed dead letter to be removed, got %d", len(letters))
+	}
+}
+
+func TestEventBusReplaysConcurrently(t *testing.T) {
+	handler := &failingHandler{failures: 100, err: ddd.Fatal(errors.New("rejected"))}
+	eventBus := startEventBus(t, handler)
+	store := ddd.NewInMemoryDeadLetterStore()
+	eventBus.WithDeadLetterStore(store)
+
+	registerUser(t, eventBus, "1")
+	var letters []*ddd.DeadLetter
+	waitFor(t, time.Second, func() bool {
+		letters, _ = eventBus.DeadLetters()
+		return len(letters) == 1
+	})
+
+	// Replays of a letter race neither with each other nor with the store being set
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			eventBus.Replay(letters[0].ID)
+		}()
+		go func() {
+			defer wg.Done()
+			eventBus.WithDeadLetterStore(store)
+		}()
+	}
+	wg.Wait()
+
+	if letter, err := store.Get(letters[0].ID); err != nil || letter.Attempts < 2 {
+		t.Errorf("Expected the failed replays to be counted, got %+v (%v)", letter, err)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := ddd.RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, Multiplier: 2}
+
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	for i, want := range expected {
+		if got := policy.Backoff(i + 1); got != want {
+			t.Errorf("Expected backoff %v for attempt %d, got %v", want, i+1, got)
+		}
+	}
+}
+
+// blockingHandler holds every event until released
+type blockingHandler struct {
+	release chan struct{}
+	handled atomic.Int32
+}
+
+func (h *blockingHandler) SubscribedTo() map[string]ddd.HandleEvent {
+	return map[string]ddd.HandleEvent{
+		ddd.EventType(model.UserRegistered{}): func(event ddd.Event) error {
+			<-h.release
+			h.handled.Add(1)
+			return nil
+		},
+	}
+}
+
+// startConfiguredEventBus starts a standalone event bus with the given configuration and handler
+func startConfiguredEventBus(t *testing.T, config *ddd.EventBusConfig, handler ddd.EventHandler) *ddd.EventBus {
+	t.Helper()
+	ctx := ddd.NewContext(context.Background(), mux.NewRouter(), "events")
+	eventBus := ddd.NewEventBus(ctx, config)
+	eventBus.Subscribe([]ddd.EventHandler{handler})
+	if err := eventBus.Start(); err != nil {
+		t.Fatalf("Failed to start event bus: %v", err)
+	}
+	t.Cleanup(func() { eventBus.Stop() })
+	return eventBus
+}
+
+func dispatchUserRegistered(eventBus *ddd.EventBus, id string) error {
+	user := model.LoadUser(ddd.NewID(id))
+	user.Register()
+	return eventBus.DispatchFrom(user)
+}
+
+func TestEventBusDropNewestRejectsWhenQueueIsFull(t *testing.T) {
+	handler := &blockingHandler{release: make(chan struct{})}
+	eventBus := startConfiguredEventBus(t, &ddd.EventBusConfig{
+		QueueSize:      1,
+		OverflowPolicy: ddd.OverflowDropNewest,
+	}, handler)
+	defer close(handler.release)
+
+	// The first event is taken by the worker, the second fills the queue
+	dispatchUserRegistered(eventBus, "1")
+	time.Sleep(20 * time.Millisecond)
+	dispatchUserRegistered(eventBus, "2")
+
+	if err := dispatchUserRegistered(eventBus, "3"); !errors.Is(err, ddd.ErrEventQueueFull) {
+		t.Errorf("Expected ErrEventQueueFull, got %v", err)
+	}
+}
+
+func TestEventBusSpillsOverflowToDisk(t *testing.T) {
+	handler := &blockingHandler{release: make(chan struct{})}
+	eventBus := startConfiguredEventBus(t, &ddd.EventBusConfig{
+		QueueSize:       1,
+		OverflowPolicy:  ddd.OverflowSpill,
+		SpillDir:        t.TempDir(),
+		ScaleIntervalMs: 5,
+	}, handler)
+
+	for i := range 5 {
+		if err := dispatchUserRegistered(eventBus, fmt.Sprint(i)); err != nil {
+			t.Fatalf("Expected spilled dispatch to succeed, got %v", err)
+		}
+	}
+
+	close(handler.release)
+	waitFor(t, 2*time.Second, func() bool { return handler.handled.Load() == 5 })
+}
+
+func TestEventBusKeepsSpilledEventsUntilHandled(t *testing.T) {
+	handler := &blockingHandler{release: make(chan struct{})}
+	dir := t.TempDir()
+	eventBus := startConfiguredEventBus(t, &ddd.EventBusConfig{
+		QueueSize:       1,
+		OverflowPolicy:  ddd.OverflowSpill,
+		SpillDir:        dir,
+		ScaleIntervalMs: 5,
+	}, handler)
+
+	// The first event is taken by the worker, the second fills the queue, the others are spilled
+	dispatchUserRegistered(eventBus, "1")
+	time.Sleep(20 * time.Millisecond)
+	for i := 2; i <= 4; i++ {
+		dispatchUserRegistered(eventBus, fmt.Sprint(i))
+	}
+
+	spilled := func() int {
+		data, _ := os.ReadFile(filepath.Join(dir, "events.spill"))
+		return strings.Count(string(data), "\n")
+	}
+
+	// The third event is drained into the queue once the first is handled, but it is not handled yet
+	handler.release <- struct{}{}
+	time.Sleep(50 * time.Millisecond)
+	if count := spilled(); count != 2 {
+		t.Errorf("Expected drained events to stay spilled until handled, got %d", count)
+	}
+
+	close(handler.release)
+	waitFor(t, 2*time.Second, func() bool { return handler.handled.Load() == 4 && spilled() == 0 })
+}
+
+// orderHandler records the event types handled for each aggregate
+type orderHandler struct {
+	mu      sync.Mutex
+	handled map[string][]string
+}
+
+func (h *orderHandler) SubscribedTo() map[string]ddd.HandleEvent {
+	return map[string]ddd.HandleEvent{
+		ddd.EventType(model.UserRegistered{}): h.record("registered", 5*time.Millisecond),
+		ddd.EventType(model.UserApproved{}):   h.record("approved", 0),
+	}
+}
+
+func (h *orderHandler) record(name string, delay time.Duration) ddd.HandleEvent {
+	return func(event ddd.Event) error {
+		time.Sleep(delay)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		id := event.AggregateID().String()
+		h.handled[id] = append(h.handled[id], name)
+		return nil
+	}
+}
+
+func (h *orderHandler) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	total := 0
+	for _, names := range h.handled {
+		total += len(names)
+	}
+	return total
+}
+
+func TestEventBusKeepsAggregateOrderAcrossWorkers(t *testing.T) {
+	handler := &orderHandler{handled: make(map[string][]string)}
+	eventBus := startConfiguredEventBus(t, &ddd.EventBusConfig{
+		WorkerCount: 4,
+		Partitioned: true,
+	}, handler)
+
+	const users = 8
+	for i := range users {
+		user := model.LoadUser(ddd.NewID(fmt.Sprint(i)))
+		user.Register()
+		user.Approve()
+		if err := eventBus.DispatchFrom(user); err != nil {
+			t.Fatalf("Failed to dispatch: %v", err)
+		}
+	}
+
+	waitFor(t, 2*time.Second, func() bool { return handler.count() == 2*users })
+
+	for id, names := range handler.handled {
+		if names[0] != "registered" || names[1] != "approved" {
+			t.Errorf("Events of user %s handled out of order: %v", id, names)
+		}
+	}
+}
+
+// policyHandler rejects user registrations on the dispatching goroutine
+type policyHandler struct {
+	reject error
+}
+
+func (h *policyHandler) SubscribedTo() map[string]ddd.HandleEvent {
+	return map[string]ddd.HandleEvent{
+		ddd.EventType(model.UserRegistered{}): func(event ddd.Event) error { return h.reject },
+	}
+}
+
+func (h *policyHandler) DispatchMode() ddd.DispatchMode {
+	return ddd.Synchronous
+}
+
+func (h *policyHandler) RetryPolicy() ddd.RetryPolicy {
+	return ddd.NoRetry()
+}
+
+func TestEventBusSynchronousHandlerRejectsDispatch(t *testing.T) {
+	policy := &policyHandler{reject: errors.New("user already exists")}
+	async := &failingHandler{}
+	eventBus := startConfiguredEventBus(t, &ddd.EventBusConfig{}, policy)
+	eventBus.Subscribe([]ddd.EventHandler{async})
+
+	if err := dispatchUserRegistered(eventBus, "1"); !errors.Is(err, policy.reject) {
+		t.Fatalf("Expected dispatch to return the policy error, got %v", err)
+	}
+
+	policy.reject = nil
+	if err := dispatchUserRegistered(eventBus, "2"); err != nil {
+		t.Fatalf("Expected dispatch to succeed, got %v", err)
+	}
+
+	waitFor(t, time.Second, func() bool { return async.calls.Load() == 1 })
+}
+
+// auditHandler subscribes to events by pattern and by predicate
+type auditHandler struct {
+	all, aggregate, pkg, tree, approved atomic.Int32
+}
+
+func (h *auditHandler) SubscribedTo() map[string]ddd.HandleEvent {
+	count := func(counter *atomic.Int32) ddd.HandleEvent {
+		return func(event ddd.Event) error {
+			counter.Add(1)
+			return nil
+		}
+	}
+	return map[string]ddd.HandleEvent{
+		ddd.AllEvents: count(&h.all),
+		ddd.AggregateEvents(ddd.AggregateType(model.User{})):        count(&h.aggregate),
+		ddd.EventsIn(reflect.TypeOf(model.User{}).PkgPath()):        count(&h.pkg),
+		ddd.EventsIn("github.com/paulvitic/ddd-go/tests/..."):       count(&h.tree),
+		ddd.EventsIn("github.com/paulvitic/ddd-go/tests/unrelated"): count(&h.tree),
+	}
+}
+
+func (h *auditHandler) SubscribedWhen() []ddd.ConditionalSubscription {
+	return []ddd.ConditionalSubscription{{
+		When: func(event ddd.Event) bool { return event.Type() == ddd.EventType(model.UserApproved{}) },
+		Handle: func(event ddd.Event) error {
+			h.approved.Add(1)
+			return nil
+		},
+	}}
+}
+
+func TestEventBusMatchesSubscriptionPatterns(t *testing.T) {
+	handler := &auditHandler{}
+	eventBus := startConfiguredEventBus(t, &ddd.EventBusConfig{}, handler)
+
+	for i := range 2 {
+		user := model.LoadUser(ddd.NewID(fmt.Sprint(i)))
+		user.Register()
+		user.Approve()
+		if err := eventBus.DispatchFrom(user); err != nil {
+			t.Fatalf("Failed to dispatch: %v", err)
+		}
+	}
+
+	waitFor(t, time.Second, func() bool { return handler.approved.Load() == 2 })
+
+	for name, counter := range map[string]*atomic.Int32{
+		"all": &handler.all, "aggregate": &handler.aggregate, "package": &handler.pkg, "tree": &handler.tree,
+	} {
+		if counter.Load() != 4 {
+			t.Errorf("Expected %s subscription to handle 4 events, got %d", name, counter.Load())
+		}
+	}
+}
+
+func TestEventBusAppliesContextMiddlewareInDeclaredOrder(t *testing.T) {
+	var mu sync.Mutex
+	calls := make([]string, 0)
+	recording := func(name string) func() ddd.EventBusMiddleware {
+		return func() ddd.EventBusMiddleware {
+			return func(next ddd.HandleEvent) ddd.HandleEvent {
+				return func(event ddd.Event) error {
+					mu.Lock()
+					calls = append(calls, name)
+					mu.Unlock()
+					return next(event)
+				}
+			}
+		}
+	}
+
+	eventLog := ddd.NewInMemoryEventLog(nil)
+	// Resources declared over several calls initialize the event bus each time
+	ctx := ddd.NewContext(context.Background(), mux.NewRouter(), "middleware").
+		WithResources(
+			ddd.Resource(recording("first"), "first"),
+			ddd.Resource(func() ddd.EventLog { return eventLog }, "eventLog"),
+		).
+		WithResources(
+			ddd.Resource(recording("second"), "second"),
+			ddd.Resource(recording("third"), "third"),
+		)
+	ctx.Start()
+	eventBus, _ := ddd.Resolve[*ddd.EventBus](ctx)
+	defer eventBus.Stop()
+
+	registerUser(t, eventBus, "1")
+
+	if fmt.Sprint(calls) != "[first second third]" {
+		t.Errorf("Expected middleware in declared order, got %v", calls)
+	}
+	if events, _ := eventLog.EventsOfType(ddd.EventType(model.UserRegistered{})); len(events) != 1 {
+		t.Errorf("Expected the event log to record the event, got %d events", len(events))
+	}
+}
+
+// panickingHandler panics on every event
+type panickingHandler struct {
+	calls atomic.Int32
+}
+
+func (h *panickingHandler) SubscribedTo() map[string]ddd.HandleEvent {
+	return map[string]ddd.HandleEvent{
+		ddd.EventType(model.UserRegistered{}): func(event ddd.Event) error {
+			h.calls.Add(1)
+			panic("handler bug")
+		},
+	}
+}
+
+func (h *panickingHandler) RetryPolicy() ddd.RetryPolicy {
+	return ddd.NoRetry()
+}
+
+func TestEventBusIsolatesPanicsAndTripsCircuitBreaker(t *testing.T) {
+	handler := &panickingHandler{}
+	eventBus := startConfiguredEventBus(t, &ddd.EventBusConfig{CircuitBreakerThreshold: 2}, handler)
+
+	for i := range 3 {
+		registerUser(t, eventBus, fmt.Sprint(i))
+	}
+
+	var letters []*ddd.DeadLetter
+	waitFor(t, time.Second, func() bool {
+		letters, _ = eventBus.DeadLetters()
+		return len(letters) == 3
+	})
+
+	if handler.calls.Load() != 2 {
+		t.Errorf("Expected the breaker to stop calls after 2 panics, got %d calls", handler.calls.Load())
+	}
+	if !strings.Contains(letters[0].Error, "panic: handler bug") {
+		t.Errorf("Expected the panic to be dead-lettered, got %q", letters[0].Error)
+	}
+	if !strings.Contains(letters[2].Error, ddd.ErrCircuitOpen.Error()) {
+		t.Errorf("Expected the last event to be rejected by the open breaker, got %q", letters[2].Error)
+	}
+}
+
+func TestEventBusDeliveryCompletesWhenHandlersAreDone(t *testing.T) {
+	handler := &failingHandler{failures: 1, err: ddd.Fatal(errors.New("rejected"))}
+	eventBus := startEventBus(t, handler)
+
+	user := model.LoadUser(ddd.NewID("1"))
+	user.Register()
+	event := user.GetFirstEvent()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := eventBus.DispatchWithResult(event).Wait(ctx)
+	if err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Fatalf("Expected the handler failure, got %v", err)
+	}
+	if ddd.IsRetryable(err) {
+		t.Errorf("Expected a fatal handler failure to stay fatal")
+	}
+
+	if err := eventBus.DispatchWithResult(event).Wait(ctx); err != nil {
+		t.Errorf("Expected a successful delivery, got %v", err)
+	}
+	if handler.calls.Load() != 2 {
+		t.Errorf("Expected the handler to be done when the delivery completes, got %d calls", handler.calls.Load())
+	}
+}
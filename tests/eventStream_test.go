@@ -0,0 +1,322 @@
+package ddd_tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+	"github.com/paulvitic/ddd-go/tests/test_server/test_context/domain/model"
+)
+
+// startEventStream serves a context streaming the events of users to administrators, and to each user those
+// of their own
+func startEventStream(t *testing.T) (*httptest.Server, *ddd.EventBus) {
+	t.Helper()
+	router := mux.NewRouter()
+	ctx := ddd.NewContext(context.Background(), router, "live").
+		WithResources(
+			ddd.Resource(func() ddd.EventLog { return ddd.NewInMemoryEventLog(nil) }, "eventLog"),
+			ddd.Resource(func() *ddd.ApiKeyAuthenticator {
+				return ddd.NewApiKeyAuthenticator("", map[string]*ddd.Principal{
+					"ops-key":  {ID: "ops", Roles: []string{"admin"}},
+					"user-key": {ID: "1"},
+				})
+			}, "apiKey"),
+			ddd.Resource(func(logger *ddd.Logger, router *mux.Router) *ddd.EventStream {
+				return ddd.NewEventStream(logger, router).
+					WithRoute(ddd.Route{Authenticated: true}).
+					WithHeartbeat(20 * time.Millisecond).
+					WithAuthorizer(func(principal *ddd.Principal, event ddd.Event) bool {
+						return principal.HasRole("admin") || event.AggregateID().String() == principal.ID
+					})
+			}),
+		)
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	server := httptest.NewServer(router)
+	t.Cleanup(func() {
+		ctx.Destroy()
+		server.Close()
+	})
+
+	eventBus, err := ddd.Resolve[*ddd.EventBus](ctx)
+	if err != nil {
+		t.Fatalf("Failed to resolve event bus: %v", err)
+	}
+	return server, eventBus
+}
+
+type serverSentEvent struct {
+	id, name, data string
+}
+
+// subscribe opens an event stream with an api key and the given query and headers
+func subscribe(t *testing.T, server *httptest.Server, key, query string, headers map[string]string) *bufio.Reader {
+	t.Helper()
+	request, _ := http.NewRequest("GET", server.URL+"/live/events"+query, nil)
+	request.Header.Set("X-Api-Key", key)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response, err := (&http.Client{Timeout: 5 * time.Second}).Do(request)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(response.Body)
+}
+
+// nextEvent reads the next event of a stream, skipping heartbeats
+func nextEvent(t *testing.T, stream *bufio.Reader) serverSentEvent {
+	t.Helper()
+	var event serverSentEvent
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		field, value, _ := strings.Cut(line, ": ")
+		switch {
+		case line == "" && event.id != "":
+			return event
+		case field == "id":
+			event.id = value
+		case field == "event":
+			event.name = value
+		case field == "data":
+			event.data = value
+		}
+	}
+}
+
+func dispatchUser(t *testing.T, eventBus *ddd.EventBus, id string, act func(user *model.User)) {
+	t.Helper()
+	user := model.LoadUser(ddd.NewID(id))
+	act(user)
+	if err := eventBus.DispatchFrom(user); err != nil {
+		t.Fatalf("Failed to dispatch: %v", err)
+	}
+}
+
+func TestEventStreamServerSentEvents(t *testing.T) {
+	server, eventBus := startEventStream(t)
+
+	response, err := http.Get(server.URL + "/live/events")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected anonymous clients to be refused, got %d", response.StatusCode)
+	}
+
+	approvals := subscribe(t, server, "ops-key", "?type=UserApproved", nil)
+	own := subscribe(t, server, "user-key", "", nil)
+
+	dispatchUser(t, eventBus, "2", (*model.User).Register)
+	dispatchUser(t, eventBus, "1", func(user *model.User) {
+		user.ActAs(&ddd.Principal{ID: "ops", Roles: []string{"admin"}})
+		user.Approve()
+	})
+
+	event := nextEvent(t, approvals)
+	if event.name != "UserApproved" || !strings.Contains(event.data, `"aggregate_id":"1"`) {
+		t.Errorf("Expected the approval of user 1, got %+v", event)
+	}
+	if strings.Contains(event.data, "principal") {
+		t.Errorf("Expected the event to be streamed without its principal, got %s", event.data)
+	}
+	if !strings.Contains(event.id, "/1/") {
+		t.Errorf("Expected the event id to name its aggregate, got %s", event.id)
+	}
+
+	// The registration of user 2 is not for user 1
+	if event := nextEvent(t, own); event.name != "UserApproved" {
+		t.Errorf("Expected user 1 to receive their own event alone, got %+v", event)
+	}
+}
+
+func TestEventStreamResumesFromEventLog(t *testing.T) {
+	server, eventBus := startEventStream(t)
+
+	first := subscribe(t, server, "ops-key", "?aggregateId=1", nil)
+	dispatchUser(t, eventBus, "1", (*model.User).Register)
+	received := nextEvent(t, first)
+
+	// Events raised while the client is away
+	dispatchUser(t, eventBus, "2", (*model.User).Register)
+	dispatchUser(t, eventBus, "1", (*model.User).Approve)
+	dispatchUser(t, eventBus, "1", (*model.User).Reject)
+	nextEvent(t, first)
+	nextEvent(t, first)
+
+	resumed := subscribe(t, server, "ops-key", "?aggregateId=1", map[string]string{"Last-Event-ID": received.id})
+	for _, name := range []string{"UserApproved", "UserRejected"} {
+		if event := nextEvent(t, resumed); event.name != name {
+			t.Errorf("Expected missed event %s, got %+v", name, event)
+		}
+	}
+
+	dispatchUser(t, eventBus, "1", (*model.User).Approve)
+	if event := nextEvent(t, resumed); event.name != "UserApproved" {
+		t.Errorf("Expected new events after the missed ones, got %+v", event)
+	}
+}
+
+func TestEventStreamOverWebSocket(t *testing.T) {
+	server, eventBus := startEventStream(t)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	io.WriteString(conn, "GET /live/events?type=UserRegistered HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\n"+
+		"Connection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"+
+		"X-Api-Key: ops-key\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake: %v", err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols ||
+		response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Expected the handshake to complete, got %d %v", response.StatusCode, response.Header)
+	}
+
+	dispatchUser(t, eventBus, "3", (*model.User).Register)
+
+	var message struct {
+		ID    string          `json:"id"`
+		Type  string          `json:"type"`
+		Event json.RawMessage `json:"event"`
+	}
+	for {
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(reader, head); err != nil {
+			t.Fatalf("Failed to read frame: %v", err)
+		}
+		length := int(head[1] & 0x7F)
+		if length == 126 {
+			extended := make([]byte, 2)
+			io.ReadFull(reader, extended)
+			length = int(binary.BigEndian.Uint16(extended))
+		}
+		payload := make([]byte, length)
+		io.ReadFull(reader, payload)
+		if head[0]&0x0F == 0x9 {
+			// Heartbeat ping
+			continue
+		}
+		if err := json.Unmarshal(payload, &message); err != nil {
+			t.Fatalf("Expected a json message, got %q", payload)
+		}
+		break
+	}
+	if message.Type != "UserRegistered" || message.ID == "" || !strings.Contains(string(message.Event), `"aggregate_id":"3"`) {
+		t.Errorf("Expected the registration of user 3, got %+v", message)
+	}
+
+	// A masked close frame
+	conn.Write([]byte{0x88, 0x82, 0, 0, 0, 0, 0x03, 0xE8})
+}
+
+func TestEventStreamRefusesClientsWithoutAuthorization(t *testing.T) {
+	router := mux.NewRouter()
+	ctx := ddd.NewContext(context.Background(), router, "open").
+		WithResources(ddd.Resource(ddd.NewEventStream, "eventStream"))
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	defer ctx.Destroy()
+
+	if recorder := serve(router, "GET", "/open/events", ""); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected a stream without authorizer to refuse its clients, got %d", recorder.Code)
+	}
+}
+
+// openWebSocket completes the opening handshake of the event stream with the given origin
+func openWebSocket(t *testing.T, server *httptest.Server, origin string) (net.Conn, *bufio.Reader, int) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	io.WriteString(conn, "GET /live/events HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\nX-Api-Key: ops-key\r\n"+
+		"Origin: "+origin+"\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake: %v", err)
+	}
+	return conn, reader, response.StatusCode
+}
+
+func TestEventStreamChecksWebSocketOrigin(t *testing.T) {
+	server, _ := startEventStream(t)
+
+	if _, _, status := openWebSocket(t, server, "https://evil.example"); status != http.StatusForbidden {
+		t.Errorf("Expected a foreign origin to be refused, got %d", status)
+	}
+	if _, _, status := openWebSocket(t, server, "http://test"); status != http.StatusSwitchingProtocols {
+		t.Errorf("Expected the origin of the stream to be accepted, got %d", status)
+	}
+}
+
+func TestEventStreamClosesWebSocketOnProtocolError(t *testing.T) {
+	server, _ := startEventStream(t)
+
+	frames := map[string][]byte{
+		"reserved bits":            {0xC1, 0x80, 0, 0, 0, 0},
+		"reserved opcode":          {0x83, 0x80, 0, 0, 0, 0},
+		"fragmented control frame": {0x09, 0x80, 0, 0, 0, 0},
+		"continuation of nothing":  {0x80, 0x80, 0, 0, 0, 0},
+		"unmasked frame":           {0x81, 0x00},
+	}
+	for name, frame := range frames {
+		t.Run(name, func(t *testing.T) {
+			conn, reader, status := openWebSocket(t, server, "")
+			if status != http.StatusSwitchingProtocols {
+				t.Fatalf("Expected the handshake to complete, got %d", status)
+			}
+			conn.Write(frame)
+
+			for {
+				head := make([]byte, 2)
+				if _, err := io.ReadFull(reader, head); err != nil {
+					t.Fatalf("Expected a close frame, got %v", err)
+				}
+				payload := make([]byte, int(head[1]&0x7F))
+				io.ReadFull(reader, payload)
+				if head[0]&0x0F != 0x8 {
+					continue
+				}
+				if len(payload) != 2 || binary.BigEndian.Uint16(payload) != 1002 {
+					t.Errorf("Expected a protocol error close code, got %v", payload)
+				}
+				return
+			}
+		})
+	}
+}
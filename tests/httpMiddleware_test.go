@@ -0,0 +1,244 @@
+package ddd_tests
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+)
+
+// recording returns a middleware appending its name to the X-Chain response header
+func chainRecording(name string) ddd.HttpMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Chain", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type middlewareEndpoint struct {
+	ddd.Endpoint
+	_ ddd.Route `route:"GET /panic" handler:"Panic"`
+	_ ddd.Route `route:"GET /slow" handler:"Slow"`
+}
+
+func newMiddlewareEndpoint(logger *ddd.Logger, router *mux.Router) *middlewareEndpoint {
+	return &middlewareEndpoint{
+		Endpoint: ddd.NewEndpoint(&middlewareEndpoint{}, []string{"/items"}, logger, router),
+	}
+}
+
+func (e *middlewareEndpoint) Middleware() []ddd.HttpMiddleware {
+	return []ddd.HttpMiddleware{chainRecording("endpoint")}
+}
+
+func (e *middlewareEndpoint) Get(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(strings.Repeat("item ", 100) + ddd.RequestID(r.Context())))
+}
+
+func (e *middlewareEndpoint) Post(ctx context.Context, request map[string]string) (map[string]string, error) {
+	return request, nil
+}
+
+func (e *middlewareEndpoint) Panic(w http.ResponseWriter, r *http.Request) {
+	panic("handler failed")
+}
+
+func (e *middlewareEndpoint) Slow(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(time.Second):
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// middlewareServer creates a server with the endpoint in a context configured by the test
+func middlewareServer(configure func(ctx *ddd.Context)) http.Handler {
+	server := ddd.NewServer(&ddd.ServerConfig{}).
+		WithMiddleware(chainRecording("server")).
+		WithContexts(func(ctx context.Context, router *mux.Router) *ddd.Context {
+			appCtx := ddd.NewContext(ctx, router, "shop")
+			configure(appCtx)
+			return appCtx.WithResources(ddd.Resource(newMiddlewareEndpoint))
+		})
+	return server.Handler()
+}
+
+func TestHttpMiddlewareOrder(t *testing.T) {
+	handler := middlewareServer(func(ctx *ddd.Context) {
+		ctx.WithResources(
+			ddd.Resource(func() ddd.HttpMiddleware { return chainRecording("first") }, "first"),
+			ddd.Resource(func() ddd.HttpMiddleware { return chainRecording("second") }, "second"),
+			ddd.Resource(func() ddd.OrderedHttpMiddleware {
+				return ddd.OrderedMiddleware(-1, chainRecording("ordered"))
+			}, "ordered"),
+		)
+	})
+
+	recorder := serve(handler, "GET", "/shop/items", "")
+	chain := strings.Join(recorder.Header().Values("X-Chain"), ",")
+	if chain != "server,ordered,first,second,endpoint" {
+		t.Errorf("Expected server, context then endpoint middleware, got %s", chain)
+	}
+
+	recorder = serve(handler, "PUT", "/shop/items", "")
+	chain = strings.Join(recorder.Header().Values("X-Chain"), ",")
+	if recorder.Code != http.StatusMethodNotAllowed || chain != "server,ordered,first,second" {
+		t.Errorf("Expected unmatched requests to go through the context middleware, got %d %s", recorder.Code, chain)
+	}
+}
+
+func TestHttpMiddlewareIsChainedOncePerRoute(t *testing.T) {
+	var built atomic.Int32
+	handler := middlewareServer(func(ctx *ddd.Context) {
+		ctx.WithResources(ddd.Resource(func() ddd.HttpMiddleware {
+			return func(next http.Handler) http.Handler {
+				built.Add(1)
+				return next
+			}
+		}, "counting"))
+	})
+
+	for range 3 {
+		serve(handler, "GET", "/shop/items", "")
+	}
+	serve(handler, "POST", "/shop/items", "{}")
+	if built.Load() != 2 {
+		t.Errorf("Expected the middleware to be chained once per route, got %d chains", built.Load())
+	}
+}
+
+func TestBuiltInHttpMiddleware(t *testing.T) {
+	handler := middlewareServer(func(ctx *ddd.Context) {
+		ctx.WithResources(
+			ddd.Resource(ddd.HttpRecoveryMiddleware, "recovery"),
+			ddd.Resource(ddd.RequestIDMiddleware, "requestId"),
+			ddd.Resource(ddd.AccessLogMiddleware, "accessLog"),
+			ddd.Resource(func() *ddd.CorsConfig {
+				return &ddd.CorsConfig{AllowedOrigins: []string{"https://shop.example"}, MaxAgeSeconds: 600}
+			}),
+			ddd.Resource(ddd.CorsMiddleware, "cors"),
+			ddd.Resource(ddd.GzipMiddleware, "gzip"),
+			ddd.Resource(func() ddd.HttpMiddleware { return ddd.BodyLimitMiddleware(32) }, "bodyLimit"),
+			ddd.Resource(func(logger *ddd.Logger) ddd.HttpMiddleware {
+				return ddd.TimeoutMiddleware(logger, 50*time.Millisecond)
+			}, "timeout"),
+		)
+	})
+
+	t.Run("RequestID", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/shop/items", nil)
+		request.Header.Set(ddd.RequestIDHeader, "req-1")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Header().Get(ddd.RequestIDHeader) != "req-1" || !strings.HasSuffix(recorder.Body.String(), "req-1") {
+			t.Errorf("Expected the request id to be kept, got %q", recorder.Header().Get(ddd.RequestIDHeader))
+		}
+		if generated := serve(handler, "GET", "/shop/items", "").Header().Get(ddd.RequestIDHeader); generated == "" {
+			t.Error("Expected a request id to be generated")
+		}
+	})
+
+	t.Run("Gzip", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/shop/items", nil)
+		request.Header.Set("Accept-Encoding", "gzip")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("Expected a gzip encoded response, got headers %v", recorder.Header())
+		}
+		reader, err := gzip.NewReader(recorder.Body)
+		if err != nil {
+			t.Fatalf("Failed to read compressed body: %v", err)
+		}
+		body, _ := io.ReadAll(reader)
+		if !strings.HasPrefix(string(body), "item item") {
+			t.Errorf("Expected the decompressed body, got %q", body)
+		}
+	})
+
+	t.Run("Cors", func(t *testing.T) {
+		request := httptest.NewRequest("OPTIONS", "/shop/items", nil)
+		request.Header.Set("Origin", "https://shop.example")
+		request.Header.Set("Access-Control-Request-Method", "POST")
+		request.Header.Set("Access-Control-Request-Headers", "Content-Type")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusNoContent || recorder.Header().Get("Access-Control-Allow-Origin") != "https://shop.example" ||
+			recorder.Header().Get("Access-Control-Allow-Headers") != "Content-Type" || recorder.Header().Get("Access-Control-Max-Age") != "600" {
+			t.Errorf("Expected the preflight to be answered, got %d %v", recorder.Code, recorder.Header())
+		}
+
+		request = httptest.NewRequest("GET", "/shop/items", nil)
+		request.Header.Set("Origin", "https://other.example")
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK || recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("Expected no CORS headers for another origin, got %v", recorder.Header())
+		}
+	})
+
+	t.Run("CorsCredentials", func(t *testing.T) {
+		cors := ddd.CorsMiddleware(&ddd.CorsConfig{AllowedOrigins: []string{"https://shop.example", "*"}, AllowCredentials: true})
+		credentials := func(origin string) string {
+			request := httptest.NewRequest("GET", "/shop/items", nil)
+			request.Header.Set("Origin", origin)
+			recorder := httptest.NewRecorder()
+			cors(handler).ServeHTTP(recorder, request)
+			return recorder.Header().Get("Access-Control-Allow-Credentials")
+		}
+		if credentials("https://shop.example") != "true" {
+			t.Error("Expected credentials to be allowed for a listed origin")
+		}
+		if credentials("https://other.example") != "" {
+			t.Error("Expected no credentials for an origin matched by the wildcard")
+		}
+	})
+
+	t.Run("BodyLimit", func(t *testing.T) {
+		if recorder := serve(handler, "POST", "/shop/items", `{"name":"a"}`); recorder.Code != http.StatusCreated {
+			t.Errorf("Expected a small body to be accepted, got %d", recorder.Code)
+		}
+
+		recorder := serve(handler, "POST", "/shop/items", `{"name":"`+strings.Repeat("a", 64)+`"}`)
+		if recorder.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected a large body to be rejected, got %d", recorder.Code)
+		}
+
+		// Bodies of unknown length are cut at the limit
+		request := httptest.NewRequest("POST", "/shop/items", io.NopCloser(strings.NewReader(`{"name":"`+strings.Repeat("a", 64)+`"}`)))
+		request.ContentLength = -1
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusRequestEntityTooLarge || recorder.Header().Get("Content-Type") != ddd.ProblemContentType {
+			t.Errorf("Expected a large body of unknown length to be rejected, got %d", recorder.Code)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		recorder := serve(handler, "GET", "/shop/slow", "")
+		var problem ddd.Problem
+		json.Unmarshal(recorder.Body.Bytes(), &problem)
+		if recorder.Code != http.StatusServiceUnavailable || problem.Status != http.StatusServiceUnavailable {
+			t.Errorf("Expected a timeout problem, got %d %s", recorder.Code, recorder.Body.String())
+		}
+	})
+
+	t.Run("Recovery", func(t *testing.T) {
+		recorder := serve(handler, "GET", "/shop/panic", "")
+		if recorder.Code != http.StatusInternalServerError || recorder.Header().Get("Content-Type") != ddd.ProblemContentType {
+			t.Errorf("Expected a panic to become an internal server error problem, got %d", recorder.Code)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package ddd_tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+)
+
+func TestInMemoryMessageConsumerRedeliversFailedMessages(t *testing.T) {
+	// The event bus gives up after 3 attempts, the redelivery succeeds
+	handler := &failingHandler{failures: 3, err: errors.New("transient")}
+	channel := make(chan string, 1)
+	consumer := ddd.NewInMemoryMessageConsumer("users", translateUserEvent, channel).(*ddd.InMemoryMessageConsumer).
+		WithRedelivery(ddd.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+
+	ctx := ddd.NewContext(context.Background(), mux.NewRouter(), "consumer").
+		WithResources(
+			ddd.Resource(func() ddd.EventHandler { return handler }, "handler"),
+			ddd.Resource(func() ddd.MessageConsumer { return consumer }, "usersConsumer"),
+		)
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	defer ctx.Destroy()
+
+	channel <- "1"
+
+	waitFor(t, 2*time.Second, func() bool { return handler.calls.Load() == 4 })
+	time.Sleep(20 * time.Millisecond)
+	if handler.calls.Load() != 4 {
+		t.Errorf("Expected no redelivery after success, got %d calls", handler.calls.Load())
+	}
+}
+
+func TestMessageConsumerWaitsForHandlers(t *testing.T) {
+	handler := &failingHandler{failures: 1, err: ddd.Fatal(errors.New("rejected"))}
+	eventBus := startEventBus(t, handler)
+
+	consumer := ddd.NewBaseMessageConsumer("users", translateUserEvent)
+	consumer.SetEventBus(eventBus)
+	consumer.OnStart()
+
+	if err := consumer.ProcessMessage(context.Background(), []byte("1")); err == nil {
+		t.Error("Expected the handler failure to be reported")
+	}
+	if err := consumer.ProcessMessage(context.Background(), []byte("2")); err != nil {
+		t.Errorf("Expected the message to be processed, got %v", err)
+	}
+	if handler.calls.Load() != 2 {
+		t.Errorf("Expected handlers to be done, got %d calls", handler.calls.Load())
+	}
+}
+
+func TestTranslatorRegistryRoutesMessages(t *testing.T) {
+	registered := func(msg []byte) (ddd.Event, error) { return translateUserEvent([]byte("1")) }
+	fallback := func(msg []byte) (ddd.Event, error) { return translateUserEvent([]byte("fallback")) }
+
+	byField := ddd.NewTranslatorRegistry(ddd.JsonFieldDiscriminator("meta.kind")).
+		Register("registered", registered)
+	event, err := byField.Translate(context.Background(), []byte(`{"meta":{"kind":"registered"}}`))
+	if err != nil || event.AggregateID().String() != "1" {
+		t.Errorf("Expected the registered translator to be used, got %v (%v)", event, err)
+	}
+
+	byHeader := ddd.NewTranslatorRegistry(ddd.HeaderDiscriminator("x-kind")).
+		Register("registered", registered).
+		WithFallback(fallback)
+	ctx := ddd.WithMessageHeaders(context.Background(), map[string]string{"x-kind": "other"})
+	event, err = byHeader.Translate(ctx, []byte(`{}`))
+	if err != nil || event.AggregateID().String() != "fallback" {
+		t.Errorf("Expected the fallback translator to be used, got %v (%v)", event, err)
+	}
+
+	unrouted := ddd.NewTranslatorRegistry(ddd.TypeAttributeDiscriminator()).WithParkingLot(nil)
+	if _, err := unrouted.Translate(context.Background(), []byte(`{}`)); !errors.Is(err, ddd.ErrUnroutableMessage) || ddd.IsRetryable(err) {
+		t.Errorf("Expected a fatal unroutable error without parking lot, got %v", err)
+	}
+}
+
+func TestMessageConsumerParksUnroutableMessages(t *testing.T) {
+	handler := &failingHandler{}
+	eventBus := startEventBus(t, handler)
+
+	registry := ddd.NewTranslatorRegistry(ddd.JsonFieldDiscriminator("kind")).
+		Register("registered", func(msg []byte) (ddd.Event, error) { return translateUserEvent([]byte("1")) })
+	consumer := ddd.NewBaseMessageConsumer("users", nil).WithTranslatorRegistry(registry)
+	consumer.SetEventBus(eventBus)
+	consumer.OnStart()
+
+	if err := consumer.ProcessMessage(context.Background(), []byte(`{"kind":"registered"}`)); err != nil {
+		t.Fatalf("Expected the message to be processed, got %v", err)
+	}
+	if err := consumer.ProcessMessage(context.Background(), []byte(`{"kind":"deleted"}`)); err != nil {
+		t.Fatalf("Expected the unroutable message to be parked and acknowledged, got %v", err)
+	}
+
+	parked, _ := registry.ParkingLot().List()
+	if len(parked) != 1 || parked[0].Target != "users" || string(parked[0].Body) != `{"kind":"deleted"}` {
+		t.Fatalf("Expected the unroutable message to be parked, got %+v", parked)
+	}
+	if handler.calls.Load() != 1 {
+		t.Errorf("Expected only the routed message to be handled, got %d calls", handler.calls.Load())
+	}
+}
+
+func TestMessageConsumerSkipsDuplicatesWithInbox(t *testing.T) {
+	handler := &failingHandler{failures: 1, err: ddd.Fatal(errors.New("rejected"))}
+	consumer := ddd.NewBaseMessageConsumer("users", translateUserEvent).
+		WithInbox(ddd.NewInMemoryInbox(time.Hour), ddd.HeaderMessageID("id"))
+	consumer.SetEventBus(startEventBus(t, handler))
+	consumer.OnStart()
+
+	ctx := ddd.WithMessageHeaders(context.Background(), map[string]string{"id": "message-1"})
+	if err := consumer.ProcessMessage(ctx, []byte("1")); err == nil {
+		t.Fatal("Expected the handler failure to be reported")
+	}
+	// A failed message is not recorded, its redelivery is processed
+	if err := consumer.ProcessMessage(ctx, []byte("1")); err != nil {
+		t.Fatalf("Expected the redelivery to be processed, got %v", err)
+	}
+	if err := consumer.ProcessMessage(ctx, []byte("1")); err != nil {
+		t.Errorf("Expected the duplicate to be acknowledged, got %v", err)
+	}
+	if handler.calls.Load() != 2 {
+		t.Errorf("Expected the duplicate to be skipped, got %d calls", handler.calls.Load())
+	}
+
+	if err := consumer.ProcessMessage(context.Background(), []byte("2")); !errors.Is(err, ddd.ErrInvalidMessage) || ddd.IsRetryable(err) {
+		t.Errorf("Expected a message without id to be invalid and fatal, got %v", err)
+	}
+}
+
+func TestFileInboxRemembersMessagesAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	inbox, err := ddd.NewFileInbox(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to open inbox: %v", err)
+	}
+	if err := inbox.MarkProcessed("message-1"); err != nil {
+		t.Fatalf("Failed to mark message: %v", err)
+	}
+	// A record cut short by a crash is skipped
+	journal, err := os.OpenFile(filepath.Join(dir, "inbox.journal"), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Expected the message to be journaled: %v", err)
+	}
+	journal.WriteString(`{"id":"message-2","at`)
+	journal.Close()
+
+	reopened, err := ddd.NewFileInbox(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to reopen inbox: %v", err)
+	}
+	if processed, _ := reopened.Processed("message-1"); !processed {
+		t.Error("Expected the message to be remembered after reopening")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "inbox.journal")); !os.IsNotExist(err) {
+		t.Errorf("Expected the journal to be compacted on reopening, got %v", err)
+	}
+
+	expired, _ := ddd.NewFileInbox(dir, time.Nanosecond)
+	if processed, _ := expired.Processed("message-1"); processed {
+		t.Error("Expected the message to be forgotten after the retention window")
+	}
+}
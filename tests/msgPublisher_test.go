@@ -0,0 +1,92 @@
+package ddd_tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+	"github.com/paulvitic/ddd-go/tests/test_server/test_context/domain/model"
+)
+
+func TestEventBusBridgeForwardsSelectedEvents(t *testing.T) {
+	channel := make(chan string, 10)
+	publisher := ddd.NewInMemoryMessagePublisher("users", nil, channel)
+
+	ctx := ddd.NewContext(context.Background(), mux.NewRouter(), "publishing").
+		WithResources(
+			ddd.Resource(func() ddd.MessagePublisher { return publisher }, "usersPublisher"),
+			ddd.Resource(func() ddd.EventHandler {
+				return ddd.PublishEvents(publisher, ddd.EventType(model.UserApproved{}))
+			}, "usersBridge"),
+		)
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	defer ctx.Destroy()
+
+	eventBus, _ := ddd.Resolve[*ddd.EventBus](ctx)
+	user := model.LoadUser(ddd.NewID("1"))
+	user.Register()
+	user.Approve()
+	if err := eventBus.DispatchFrom(user); err != nil {
+		t.Fatalf("Failed to dispatch: %v", err)
+	}
+
+	select {
+	case msg := <-channel:
+		event, err := ddd.EventFromJsonString(msg)
+		if err != nil {
+			t.Fatalf("Failed to decode message: %v", err)
+		}
+		if event.Type() != ddd.EventType(model.UserApproved{}) {
+			t.Errorf("Expected only approvals to be published, got %s", event.Type())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a published message")
+	}
+
+	select {
+	case msg := <-channel:
+		t.Errorf("Unexpected message %s", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFileSpoolMessagePublisher(t *testing.T) {
+	publisher := ddd.NewFileSpoolMessagePublisher("users", nil, t.TempDir())
+
+	user := model.LoadUser(ddd.NewID("1"))
+	user.Register()
+	event := user.GetFirstEvent()
+
+	if err := publisher.Publish(event); !errors.Is(err, ddd.ErrMessagePublisherNotRunning) {
+		t.Fatalf("Expected publisher not running error, got %v", err)
+	}
+
+	if err := publisher.OnStart(); err != nil {
+		t.Fatalf("Failed to start publisher: %v", err)
+	}
+	for range 2 {
+		if err := publisher.Publish(event); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+	publisher.OnDestroy()
+
+	data, err := os.ReadFile(publisher.(*ddd.FileSpoolMessagePublisher).SpoolPath())
+	if err != nil {
+		t.Fatalf("Failed to read spool: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 spooled messages, got %d", len(lines))
+	}
+	if spooled, err := ddd.EventFromJsonString(lines[0]); err != nil || spooled.Type() != event.Type() {
+		t.Errorf("Unexpected spooled message %s (%v)", lines[0], err)
+	}
+}
@@ -0,0 +1,139 @@
+package ddd_tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+)
+
+func typedContext(ctx context.Context, router *mux.Router) *ddd.Context {
+	return ddd.NewContext(ctx, router, "typed").
+		WithResources(ddd.Resource(newTypedEndpoint), ddd.Resource(newRoutedEndpoint), ddd.Resource(newSecuredEndpoint))
+}
+
+func openApiDocument(t *testing.T) map[string]any {
+	t.Helper()
+	server := ddd.NewServer(&ddd.ServerConfig{OpenApiConfig: ddd.OpenApiConfig{ApiTitle: "Typed"}}).
+		WithContexts(typedContext).
+		WithSecurityScheme("bearer", ddd.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"})
+
+	data, err := server.OpenApi()
+	if err != nil {
+		t.Fatalf("Failed to generate document: %v", err)
+	}
+	var document map[string]any
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+	return document
+}
+
+// lookup follows a path of keys through nested json objects
+func lookup(value any, keys ...string) any {
+	for _, key := range keys {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func TestOpenApiDescribesEndpoints(t *testing.T) {
+	document := openApiDocument(t)
+
+	if document["openapi"] != "3.1.0" || lookup(document, "info", "title") != "Typed" {
+		t.Errorf("Expected an OpenAPI 3.1 document titled Typed, got %v %v", document["openapi"], document["info"])
+	}
+
+	post := lookup(document, "paths", "/typed/greetings/{name}", "post")
+	if post == nil {
+		t.Fatalf("Expected the typed POST operation under the context prefix, got paths %v", lookup(document, "paths"))
+	}
+
+	parameters, _ := lookup(post, "parameters").([]any)
+	if len(parameters) != 2 || lookup(parameters[0], "in") != "path" || lookup(parameters[1], "name") != "times" ||
+		lookup(parameters[1], "schema", "type") != "integer" {
+		t.Errorf("Expected the name path and times query parameters, got %v", parameters)
+	}
+
+	body := lookup(post, "requestBody", "content", "application/json", "schema", "properties")
+	if lookup(body, "note") == nil || lookup(body, "name") != nil {
+		t.Errorf("Expected the body without its parameter fields, got %v", body)
+	}
+
+	if lookup(post, "responses", "201", "content", "application/json", "schema", "$ref") != "#/components/schemas/greeting" {
+		t.Errorf("Expected the response schema as a component, got %v", lookup(post, "responses", "201"))
+	}
+	if lookup(post, "responses", "400", "content", ddd.ProblemContentType) == nil ||
+		lookup(post, "responses", "default", "content", ddd.ProblemContentType, "schema", "$ref") != "#/components/schemas/Problem" {
+		t.Errorf("Expected problem error responses, got %v", lookup(post, "responses"))
+	}
+
+	book := lookup(document, "paths", "/typed/books/{bookId}", "get")
+	if lookup(book, "operationId") != "book" || lookup(book, "tags") == nil {
+		t.Errorf("Expected the declared route to be named and tagged, got %v", book)
+	}
+
+	if lookup(document, "components", "securitySchemes", "bearer", "scheme") != "bearer" {
+		t.Errorf("Expected the security scheme to be declared, got %v", lookup(document, "components"))
+	}
+
+	remove := lookup(document, "paths", "/typed/reports/{id}", "delete")
+	if lookup(remove, "security") == nil || lookup(remove, "responses", "401") == nil || lookup(remove, "responses", "403") == nil {
+		t.Errorf("Expected the secured route to require the security scheme, got %v", remove)
+	}
+	if roles, _ := lookup(remove, "x-required-roles").([]any); len(roles) != 2 {
+		t.Errorf("Expected the required roles to be described, got %v", lookup(remove, "x-required-roles"))
+	}
+	if status := lookup(document, "paths", "/typed/status", "get"); lookup(status, "security") != nil {
+		t.Errorf("Expected the public route to require no security, got %v", status)
+	}
+}
+
+// Problem is named like the problem details of ddd
+type Problem struct {
+	Reason string `json:"reason"`
+}
+
+type problemsEndpoint struct {
+	ddd.Endpoint
+}
+
+func (e *problemsEndpoint) Get(r *http.Request) (*Problem, error) {
+	return &Problem{}, nil
+}
+
+func TestOpenApiQualifiesCollidingComponents(t *testing.T) {
+	server := ddd.NewServer(&ddd.ServerConfig{}).
+		WithContexts(func(ctx context.Context, router *mux.Router) *ddd.Context {
+			return ddd.NewContext(ctx, router, "problems").
+				WithResources(ddd.Resource(func(logger *ddd.Logger, router *mux.Router) *problemsEndpoint {
+					endpoint := &problemsEndpoint{}
+					endpoint.Endpoint = ddd.NewEndpoint(endpoint, []string{"/problems"}, logger, router)
+					return endpoint
+				}))
+		})
+
+	data, err := server.OpenApi()
+	if err != nil {
+		t.Fatalf("Failed to generate document: %v", err)
+	}
+	var document map[string]any
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+
+	get := lookup(document, "paths", "/problems/problems", "get", "responses", "200", "content", "application/json", "schema", "$ref")
+	if get != "#/components/schemas/tests_Problem" {
+		t.Errorf("Expected the colliding struct to be qualified with its package, got %v", get)
+	}
+	if lookup(document, "components", "schemas", "Problem", "properties", "reason") != nil {
+		t.Error("Expected the problem details component to be kept")
+	}
+}
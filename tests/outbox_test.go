@@ -0,0 +1,210 @@
+package ddd_tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+	"github.com/paulvitic/ddd-go/tests/test_server/test_context/domain/model"
+)
+
+// recordingPublisher records published event types and fails while failing is set
+type recordingPublisher struct {
+	failing bool
+	events  []string
+	mu      sync.Mutex
+}
+
+func (p *recordingPublisher) Publish(event ddd.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failing {
+		return errors.New("broker unavailable")
+	}
+	p.events = append(p.events, event.Type())
+	return nil
+}
+
+func (p *recordingPublisher) setFailing(failing bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failing = failing
+}
+
+func (p *recordingPublisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.events...)
+}
+
+func userEvents(id string) []ddd.Event {
+	user := model.LoadUser(ddd.NewID(id))
+	user.Register()
+	user.Approve()
+	return user.GetAllEvents()
+}
+
+// startOutboxRelay creates a started context relaying the outbox to its event bus and the publisher
+func startOutboxRelay(t *testing.T, outbox ddd.Outbox, publisher ddd.EventPublisher) *ddd.OutboxRelay {
+	t.Helper()
+	ctx := ddd.NewContext(context.Background(), mux.NewRouter(), "outbox")
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	t.Cleanup(func() { ctx.Destroy() })
+
+	return ddd.NewOutboxRelay(ctx).WithOutboxes(outbox).WithPublishers(publisher)
+}
+
+func TestFileOutboxCommitsStateAndEvents(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := ddd.NewFileOutbox(filepath.Join(dir, "outbox"))
+	if err != nil {
+		t.Fatalf("Failed to open outbox: %v", err)
+	}
+
+	statePath := filepath.Join(dir, "users.json")
+	if err := outbox.Commit(statePath, []byte(`{"1":{}}`), userEvents("1")...); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if state, err := os.ReadFile(statePath); err != nil || string(state) != `{"1":{}}` {
+		t.Errorf("Expected state to be written, got %q (%v)", state, err)
+	}
+
+	// Entries survive reopening the outbox
+	reopened, err := ddd.NewFileOutbox(filepath.Join(dir, "outbox"))
+	if err != nil {
+		t.Fatalf("Failed to reopen outbox: %v", err)
+	}
+	pending, err := reopened.Pending(10)
+	if err != nil {
+		t.Fatalf("Pending failed: %v", err)
+	}
+	if len(pending) != 2 || pending[0].Event.Type() != ddd.EventType(model.UserRegistered{}) {
+		t.Fatalf("Expected the two events in order, got %d", len(pending))
+	}
+	if pending[0].Event.AggregateID().String() != "1" {
+		t.Errorf("Expected aggregate id 1, got %s", pending[0].Event.AggregateID())
+	}
+}
+
+func TestOutboxRelayPublishesAtLeastOnceInOrder(t *testing.T) {
+	outbox := ddd.NewInMemoryOutbox()
+	publisher := &recordingPublisher{failing: true}
+	relay := startOutboxRelay(t, outbox, publisher)
+
+	outbox.Record(userEvents("1")...)
+
+	if delivered, _ := relay.Relay(); delivered != 0 {
+		t.Fatalf("Expected nothing delivered while the publisher fails, got %d", delivered)
+	}
+	pending, _ := outbox.Pending(10)
+	if len(pending) != 2 || pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Fatalf("Expected the failure to be recorded on the first entry only, got %+v", pending[0])
+	}
+	if pending[1].Attempts != 0 {
+		t.Errorf("Expected later entries not to be attempted before earlier ones")
+	}
+
+	publisher.setFailing(false)
+	if delivered, err := relay.Relay(); delivered != 2 || err != nil {
+		t.Fatalf("Expected 2 deliveries, got %d (%v)", delivered, err)
+	}
+
+	published := publisher.published()
+	if len(published) != 2 || published[0] != ddd.EventType(model.UserRegistered{}) {
+		t.Errorf("Expected events in recording order, got %v", published)
+	}
+	if pending, _ := outbox.Pending(10); len(pending) != 0 {
+		t.Errorf("Expected no pending entries, got %d", len(pending))
+	}
+}
+
+func TestOutboxCleanupRemovesDeliveredEntries(t *testing.T) {
+	outbox := ddd.NewInMemoryOutbox()
+	outbox.Record(userEvents("1")...)
+
+	pending, _ := outbox.Pending(1)
+	if len(pending) != 1 {
+		t.Fatalf("Expected the batch to be limited, got %d", len(pending))
+	}
+	outbox.MarkDelivered(pending[0].ID)
+
+	removed, err := outbox.Cleanup(time.Now().Add(time.Second))
+	if err != nil || removed != 1 {
+		t.Fatalf("Expected 1 removed entry, got %d (%v)", removed, err)
+	}
+	if pending, _ := outbox.Pending(10); len(pending) != 1 {
+		t.Errorf("Expected the undelivered entry to remain, got %d", len(pending))
+	}
+}
+
+// poisonPublisher fails to publish the events of one type
+type poisonPublisher struct {
+	recordingPublisher
+	poison string
+}
+
+func (p *poisonPublisher) Publish(event ddd.Event) error {
+	if event.Type() == p.poison {
+		return errors.New("malformed event")
+	}
+	return p.recordingPublisher.Publish(event)
+}
+
+func TestOutboxRelayParksPoisonEntries(t *testing.T) {
+	outbox := ddd.NewInMemoryOutbox()
+	publisher := &poisonPublisher{poison: ddd.EventType(model.UserRegistered{})}
+	relay := startOutboxRelay(t, outbox, publisher).WithConfig(&ddd.OutboxRelayConfig{MaxAttempts: 2})
+
+	outbox.Record(userEvents("1")...)
+
+	if delivered, _ := relay.Relay(); delivered != 0 {
+		t.Fatalf("Expected later entries to wait while the first may still be published, got %d", delivered)
+	}
+	if delivered, _ := relay.Relay(); delivered != 1 {
+		t.Fatalf("Expected the entry after the parked one to be delivered, got %d", delivered)
+	}
+
+	parked, _ := outbox.Parked()
+	if len(parked) != 1 || parked[0].Event.Type() != publisher.poison || parked[0].Attempts != 2 {
+		t.Fatalf("Expected the poison entry to be parked, got %+v", parked)
+	}
+	if pending, _ := outbox.Pending(10); len(pending) != 0 {
+		t.Errorf("Expected parked entries not to be pending, got %d", len(pending))
+	}
+
+	outbox.Unpark(parked[0].ID)
+	if pending, _ := outbox.Pending(10); len(pending) != 1 || pending[0].Attempts != 0 {
+		t.Errorf("Expected the unparked entry to be pending again, got %+v", pending)
+	}
+}
+
+func TestOutboxRelayDrainsBeforeEventBusStops(t *testing.T) {
+	outbox := ddd.NewInMemoryOutbox()
+	publisher := &recordingPublisher{}
+	ctx := ddd.NewContext(context.Background(), mux.NewRouter(), "outbox")
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	relay := ddd.NewOutboxRelay(ctx).WithOutboxes(outbox).WithPublishers(publisher).
+		WithConfig(&ddd.OutboxRelayConfig{IntervalMs: int(time.Hour / time.Millisecond)})
+	relay.OnStart()
+
+	outbox.Record(userEvents("1")...)
+	ctx.Destroy()
+
+	if published := publisher.published(); len(published) != 2 {
+		t.Errorf("Expected the committed events to be relayed on shutdown, got %v", published)
+	}
+	if pending, _ := outbox.Pending(10); len(pending) != 0 {
+		t.Errorf("Expected no pending entries, got %d", len(pending))
+	}
+}
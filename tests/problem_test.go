@@ -0,0 +1,70 @@
+package ddd_tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/paulvitic/ddd-go"
+)
+
+var errAccountLocked = errors.New("account locked")
+
+func TestProblemRegistryMapsErrors(t *testing.T) {
+	registry := ddd.NewProblemRegistry().
+		Register(errUserMissing, ddd.ErrNotFound).
+		RegisterProblem(errAccountLocked, http.StatusLocked, "https://example.com/problems/locked", "Account Locked")
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		title  string
+		detail string
+	}{
+		{"standard kind", ddd.Conflict("already registered"), http.StatusConflict, "Conflict", "already registered"},
+		{"context error onto a kind", fmt.Errorf("%w: 42", errUserMissing), http.StatusNotFound, "Not Found", "user missing: 42"},
+		{"context problem", errAccountLocked, http.StatusLocked, "Account Locked", "account locked"},
+		{"undecodable request", fmt.Errorf("%w: unexpected EOF", ddd.ErrBadRequest), http.StatusBadRequest, "Bad Request", "bad request: unexpected EOF"},
+		{"unexpected error", errors.New("disk on fire"), http.StatusInternalServerError, "Internal Server Error", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, body := registry.MapError(test.err)
+			problem := body.(*ddd.Problem)
+			if status != test.status || problem.Status != test.status {
+				t.Errorf("Expected status %d, got %d", test.status, status)
+			}
+			if problem.Title != test.title || problem.Detail != test.detail {
+				t.Errorf("Expected %q / %q, got %q / %q", test.title, test.detail, problem.Title, problem.Detail)
+			}
+		})
+	}
+}
+
+var errUserMissing = errors.New("user missing")
+
+func TestProblemSerializesExtensionsAsMembers(t *testing.T) {
+	err := ddd.Validation("invalid user", map[string]string{"email": "is required"})
+	_, body := ddd.NewProblemRegistry().MapError(err)
+
+	data, _ := json.Marshal(body)
+	var members map[string]any
+	json.Unmarshal(data, &members)
+	if members["status"] != float64(http.StatusUnprocessableEntity) || members["detail"] != "invalid user" {
+		t.Errorf("Expected the standard members, got %s", data)
+	}
+	if fields, _ := members["errors"].(map[string]any); fields["email"] != "is required" {
+		t.Errorf("Expected the field errors as a member, got %s", data)
+	}
+
+	var decoded ddd.Problem
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	if decoded.Title != "Validation Failed" || decoded.Extensions["errors"] == nil {
+		t.Errorf("Expected the problem to decode with its extensions, got %+v", decoded)
+	}
+}
@@ -0,0 +1,140 @@
+package ddd_tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+)
+
+func TestTokenBucketRateLimit(t *testing.T) {
+	store := ddd.NewInMemoryRateLimitStore()
+	limit := ddd.RateLimit{Algorithm: ddd.TokenBucket, Limit: 2, Window: time.Second, Burst: 3}
+	now := time.Now()
+
+	for i := range 3 {
+		if result, _ := store.Take("client", limit, now); !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("Expected request %d of the burst to be allowed, got %+v", i, result)
+		}
+	}
+	result, _ := store.Take("client", limit, now)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Expected the empty bucket to refuse for half a second, got %+v", result)
+	}
+	if result, _ := store.Take("other", limit, now); !result.Allowed {
+		t.Error("Expected another client to have its own bucket")
+	}
+	if result, _ := store.Take("client", limit, now.Add(500*time.Millisecond)); !result.Allowed {
+		t.Error("Expected a token to be refilled")
+	}
+}
+
+func TestSlidingWindowRateLimit(t *testing.T) {
+	store := ddd.NewInMemoryRateLimitStore()
+	limit, err := ddd.ParseRateLimit("2/1m slidingWindow")
+	if err != nil {
+		t.Fatalf("Failed to parse rate limit: %v", err)
+	}
+	start := time.Now()
+
+	store.Take("client", limit, start)
+	store.Take("client", limit, start.Add(10*time.Second))
+	if result, _ := store.Take("client", limit, start.Add(20*time.Second)); result.Allowed || result.RetryAfter != 40*time.Second {
+		t.Errorf("Expected the window to be full until it ends, got %+v", result)
+	}
+
+	// Half of the previous window still counts, one of its two requests
+	halfway := start.Add(90 * time.Second)
+	if result, _ := store.Take("client", limit, halfway); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected one request to be allowed halfway, got %+v", result)
+	}
+	if result, _ := store.Take("client", limit, halfway); result.Allowed {
+		t.Errorf("Expected the weighted window to be full, got %+v", result)
+	}
+}
+
+type limitedEndpoint struct {
+	ddd.Endpoint
+	_ ddd.Route `route:"GET /quotes" handler:"Quotes" rateLimit:"2/1m" rateLimitKey:"apiKey"`
+	_ ddd.Route `route:"POST /exports" handler:"Export" maxInFlight:"1"`
+}
+
+var exportStarted, exportRelease = make(chan struct{}), make(chan struct{})
+
+func (e *limitedEndpoint) Quotes(r *http.Request) ([]string, error) {
+	return []string{"quote"}, nil
+}
+
+func (e *limitedEndpoint) Export(w http.ResponseWriter, r *http.Request) {
+	exportStarted <- struct{}{}
+	<-exportRelease
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func startLimitedEndpoint(t *testing.T) *mux.Router {
+	t.Helper()
+	router := mux.NewRouter()
+	ctx := ddd.NewContext(context.Background(), router, "limited").
+		WithResources(ddd.Resource(func(logger *ddd.Logger, router *mux.Router) *limitedEndpoint {
+			return &limitedEndpoint{Endpoint: ddd.NewEndpoint(&limitedEndpoint{}, nil, logger, router)}
+		}))
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	t.Cleanup(func() { ctx.Destroy() })
+	return router
+}
+
+func TestEndpointRateLimit(t *testing.T) {
+	router := startLimitedEndpoint(t)
+	quotes := func(apiKey string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/limited/quotes", nil)
+		request.Header.Set("X-Api-Key", apiKey)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if recorder := quotes("key-1"); recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Limit") != "2" ||
+		recorder.Header().Get("RateLimit-Remaining") != "1" || recorder.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Errorf("Expected the rate limit headers, got %d %v", recorder.Code, recorder.Header())
+	}
+	quotes("key-1")
+
+	recorder := quotes("key-1")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "30" ||
+		recorder.Header().Get("Content-Type") != ddd.ProblemContentType {
+		t.Errorf("Expected the third request to be refused, got %d %v", recorder.Code, recorder.Header())
+	}
+	if recorder := quotes("key-2"); recorder.Code != http.StatusOK {
+		t.Errorf("Expected another api key to be limited apart, got %d", recorder.Code)
+	}
+}
+
+func TestEndpointConcurrencyLimit(t *testing.T) {
+	router := startLimitedEndpoint(t)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serve(router, "POST", "/limited/exports", "")
+	}()
+	<-exportStarted
+
+	if recorder := serve(router, "POST", "/limited/exports", ""); recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a second export in progress to be refused, got %d", recorder.Code)
+	}
+	close(exportRelease)
+	wg.Wait()
+
+	go func() { <-exportStarted }()
+	if recorder := serve(router, "POST", "/limited/exports", ""); recorder.Code != http.StatusAccepted {
+		t.Errorf("Expected an export once the first one finished, got %d", recorder.Code)
+	}
+}
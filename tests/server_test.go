@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,6 +18,8 @@ import (
 
 // TestServer tests the complete server lifecycle and endpoint functionality
 func TestServer(t *testing.T) {
+	// The tests change the users, they are stored in a copy of the data directory
+	useDataDirCopy(t)
 
 	// Create server with the context
 	server := ddd.NewServer(ddd.NewServerConfig()).
@@ -54,6 +59,18 @@ func TestServer(t *testing.T) {
 		testPostEndpoint(t)
 	})
 
+	t.Run("GET_Collection", func(t *testing.T) {
+		testGetCollection(t)
+	})
+
+	t.Run("NotFoundProblem", func(t *testing.T) {
+		testNotFoundProblem(t)
+	})
+
+	t.Run("ConditionalUpdate", func(t *testing.T) {
+		testConditionalUpdate(t)
+	})
+
 	// t.Run("PUT_Endpoint", func(t *testing.T) {
 	// 	testPutEndpoint(t)
 	// })
@@ -66,6 +83,10 @@ func TestServer(t *testing.T) {
 		testUnsupportedMethod(t)
 	})
 
+	t.Run("OpenApi", func(t *testing.T) {
+		testOpenApi(t)
+	})
+
 	// t.Run("RequestScoping", func(t *testing.T) {
 	// 	testRequestScoping(t)
 	// })
@@ -163,6 +184,115 @@ func testPostEndpoint(t *testing.T) {
 	t.Log("POST endpoint working correctly")
 }
 
+// testGetCollection tests that the collection and its items have their own handlers
+func testGetCollection(t *testing.T) {
+	resp, err := http.Get("http://localhost:8081/test/users")
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	var users []map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		t.Fatalf("Failed to decode JSON response: %v", err)
+	}
+	if len(users) == 0 || users[0]["ID"] != "1" {
+		t.Errorf("Expected the users to be listed, got %v", users)
+	}
+}
+
+// testNotFoundProblem tests that an unknown user is answered with a problem
+func testNotFoundProblem(t *testing.T) {
+	resp, err := http.Get("http://localhost:8081/test/users/unknown")
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Content-Type") != ddd.ProblemContentType {
+		t.Errorf("Expected Content-Type %s, got %s", ddd.ProblemContentType, resp.Header.Get("Content-Type"))
+	}
+
+	var problem ddd.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	if problem.Instance != "/test/users/unknown" || problem.Detail != "user not found with id: unknown" {
+		t.Errorf("Expected the problem to describe the request, got %+v", problem)
+	}
+}
+
+// testConditionalUpdate tests that users are changed at the version named by the If-Match header
+func testConditionalUpdate(t *testing.T) {
+	send := func(method, userId, body, ifMatch string) *http.Response {
+		req, _ := http.NewRequest(method, "http://localhost:8081/test/users/"+userId, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make %s request: %v", method, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	changed := send("PUT", "1", `{"email":"user1@example.com","name":"User One","role":"user"}`, "")
+	etag := changed.Header.Get("ETag")
+	if changed.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("Expected the user to be changed with its version as ETag, got %d %q", changed.StatusCode, etag)
+	}
+
+	if resp := send("PATCH", "1", `{"approved":true}`, etag); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the current version to be reviewed, got %d", resp.StatusCode)
+	}
+	if resp := send("PATCH", "1", `{"approved":false}`, etag); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected a stale version to be refused, got %d", resp.StatusCode)
+	}
+	if resp := send("PUT", "1", `{"name":"Someone"}`, etag); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected a stale version to be refused, got %d", resp.StatusCode)
+	}
+	if resp := send("PUT", "missing", `{"name":"Someone"}`, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a missing user to be not found, got %d", resp.StatusCode)
+	}
+}
+
+// testOpenApi tests that the OpenAPI document and its documentation page are served
+func testOpenApi(t *testing.T) {
+	resp, err := http.Get("http://localhost:8081/openapi.json")
+	if err != nil {
+		t.Fatalf("Failed to get OpenAPI document: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var document struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		t.Fatalf("Failed to decode OpenAPI document: %v", err)
+	}
+	if document.Paths["/test/users/{userId}"]["get"] == nil || document.Paths["/test/users"]["post"] == nil {
+		t.Errorf("Expected the users endpoint to be described, got %v", document.Paths)
+	}
+
+	docs, err := http.Get("http://localhost:8081/docs")
+	if err != nil {
+		t.Fatalf("Failed to get documentation page: %v", err)
+	}
+	docs.Body.Close()
+	if docs.StatusCode != http.StatusOK || docs.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("Expected the documentation page, got %d %s", docs.StatusCode, docs.Header.Get("Content-Type"))
+	}
+}
+
 // testPutEndpoint tests the PUT endpoint
 func testPutEndpoint(t *testing.T) {
 	requestBody := map[string]interface{}{
@@ -264,3 +394,17 @@ func BenchmarkGetEndpoint(b *testing.B) {
 		}
 	})
 }
+
+// useDataDirCopy points the file persistence of the test context at a copy of the users fixture
+func useDataDirCopy(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	users, err := os.ReadFile("data/users.json")
+	if err != nil {
+		t.Fatalf("Failed to read users: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "users.json"), users, 0644); err != nil {
+		t.Fatalf("Failed to copy users: %v", err)
+	}
+	t.Setenv("DDD_FILE_PERSISTENCE_DIR", dir)
+}
@@ -0,0 +1,49 @@
+package command
+
+import (
+	"context"
+
+	"github.com/paulvitic/ddd-go"
+	"github.com/paulvitic/ddd-go/tests/test_server/test_context/domain/model"
+	"github.com/paulvitic/ddd-go/tests/test_server/test_context/domain/repository"
+)
+
+// ChangeUser changes a user at the version the request expects it, see ddd.ExpectVersion
+type ChangeUser struct {
+	ddd.Acting
+	ctx    context.Context
+	userId ddd.ID
+	change func(user *model.User)
+	repo   repository.UserRepository
+}
+
+func NewChangeUser(ctx context.Context, userId ddd.ID, change func(user *model.User)) (*ChangeUser, error) {
+	repo, err := ddd.Resolve[repository.UserRepository](ddd.ContextOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return &ChangeUser{
+		Acting: ddd.ActingFor(ctx),
+		ctx:    ctx,
+		userId: userId,
+		change: change,
+		repo:   repo,
+	}, nil
+}
+
+func (c *ChangeUser) Execute() (any, error) {
+	// A missing user is model.ErrUserNotFound, which the problem registry of the context answers with 404
+	user, err := c.repo.Load(c.userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := ddd.ExpectVersion(c.ctx, user); err != nil {
+		return nil, err
+	}
+	c.Act(user)
+	c.change(user)
+	if err := c.repo.Update(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -6,16 +6,18 @@ import (
 )
 
 type RegisterUser struct {
+	ddd.Acting
 	userId ddd.ID
 	repo   repository.UserRepository
 }
 
-func NewRegisterUser(userId ddd.ID, ctx *ddd.Context) *RegisterUser {
+func NewRegisterUser(userId ddd.ID, ctx *ddd.Context, acting ddd.Acting) *RegisterUser {
 	repo, err := ddd.Resolve[repository.UserRepository](ctx)
 	if err != nil {
 		panic("repo not found")
 	}
 	return &RegisterUser{
+		Acting: acting,
 		userId: userId,
 		repo:   repo,
 	}
@@ -26,7 +28,10 @@ func (c *RegisterUser) Execute() (any, error) {
 	if err != nil {
 		panic("can not find user")
 	}
+	c.Act(user)
 	user.Register()
-	c.repo.Update(user)
+	if err := c.repo.Update(user); err != nil {
+		return nil, err
+	}
 	return user, nil
 }
@@ -0,0 +1,20 @@
+package query
+
+import (
+	"github.com/paulvitic/ddd-go"
+	"github.com/paulvitic/ddd-go/tests/test_server/test_context/domain/model"
+)
+
+type AllUsers struct{}
+
+func (u *AllUsers) Filter(ctx *ddd.Context) (ddd.QueryResponse, error) {
+	users, err := ddd.Resolve[model.UsersView](ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := users.All()
+	if err != nil {
+		return nil, err
+	}
+	return ddd.NewQueryResponse(res), nil
+}
@@ -13,10 +13,20 @@ import (
 func TestContext(ctx context.Context, router *mux.Router) *ddd.Context {
 	return ddd.NewContext(ctx, router, "test").
 		WithResources(
+			ddd.Resource(ddd.RecoveryMiddleware, "recoveryMiddleware"),
+			ddd.Resource(ddd.HttpRecoveryMiddleware, "httpRecoveryMiddleware"),
+			ddd.Resource(ddd.RequestIDMiddleware, "requestIdMiddleware"),
+			ddd.Resource(ddd.NewInMemoryEventLogConfig),
+			ddd.Resource(ddd.NewInMemoryEventLog),
+			ddd.Resource(http.NewProblemRegistry),
 			ddd.Resource(http.NewUsersEndpoint),
+			ddd.Resource(http.NewUsersEventStream, "eventStream"),
+			ddd.Resource(http.NewIdProviderWebhook, "idProviderWebhook"),
 			ddd.Resource(file.NewFilePersitenceConfig),
 			ddd.Resource(file.NewUsersView),
+			ddd.Resource(file.NewUserOutbox),
 			ddd.Resource(file.NewUserRepository),
+			ddd.Resource(ddd.NewOutboxRelay),
 			ddd.Resource(process.UserProcessor, "userProcessor"),
 		)
 }
@@ -7,3 +7,9 @@ type UserRegistered struct {
 type UserApproved struct{}
 
 type UserRejected struct{}
+
+type UserDetailsChanged struct {
+	Email string
+	Name  string
+	Role  string
+}
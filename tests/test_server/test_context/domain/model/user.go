@@ -44,3 +44,8 @@ func (u *User) Approve() {
 func (u *User) Reject() {
 	u.RaiseEvent(UserRejected{})
 }
+
+func (u *User) ChangeDetails(email, name, role string) {
+	u.Email, u.Name, u.Role = email, name, role
+	u.RaiseEvent(UserDetailsChanged{Email: email, Name: name, Role: role})
+}
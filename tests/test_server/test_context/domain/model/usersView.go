@@ -1,6 +1,13 @@
 package model
 
-import "github.com/paulvitic/ddd-go"
+import (
+	"errors"
+
+	"github.com/paulvitic/ddd-go"
+)
+
+// ErrUserNotFound is returned when no user has the requested id
+var ErrUserNotFound = errors.New("user not found")
 
 // User represents a user in the system from the admin context perspective
 type UserProjection struct {
@@ -18,6 +25,8 @@ type usersView struct {
 type UsersView interface {
 	// ById retrieves a user by their ID
 	ById(id string) (*UserProjection, error)
+	// All retrieves every user ordered by ID
+	All() ([]*UserProjection, error)
 	// to update on external events
 	SubscribedTo() map[string]ddd.HandleEvent
 }
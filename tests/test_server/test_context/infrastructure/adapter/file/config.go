@@ -1,6 +1,10 @@
 package file
 
-import "github.com/paulvitic/ddd-go"
+import (
+	"os"
+
+	"github.com/paulvitic/ddd-go"
+)
 
 type FilePersistenceConfig struct {
 	DataDir string `json:"filePersitenceDir"`
@@ -15,5 +19,9 @@ func (c *FilePersistenceConfig) OnInit() {
 	if err != nil {
 		panic(err)
 	}
+	// The data directory can be moved, to keep test runs off the checked in data for instance
+	if dir := os.Getenv("DDD_FILE_PERSISTENCE_DIR"); dir != "" {
+		config.DataDir = dir
+	}
 	*c = *config
 }
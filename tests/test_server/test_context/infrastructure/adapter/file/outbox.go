@@ -0,0 +1,12 @@
+package file
+
+import (
+	"path/filepath"
+
+	"github.com/paulvitic/ddd-go"
+)
+
+// NewUserOutbox opens the outbox recording the events of the users saved in the data directory
+func NewUserOutbox(filePersistenceConfig *FilePersistenceConfig) (*ddd.FileOutbox, error) {
+	return ddd.NewFileOutbox(filepath.Join(filePersistenceConfig.DataDir, "outbox"))
+}
@@ -17,15 +17,25 @@ type userRepository struct {
 	logger   *ddd.Logger
 	dataDir  string
 	filePath string
-	eventBus *ddd.EventBus
+	outbox   *ddd.FileOutbox
 	mu       sync.RWMutex
 }
 
-func NewUserRepository(logger *ddd.Logger, eventBus *ddd.EventBus, filePersistenceConfig *FilePersistenceConfig) repository.UserRepository {
+// userRecord is a user as stored in the users file, with the version it was stored at
+type userRecord struct {
+	ID       string `json:"ID"`
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	IsActive bool   `json:"isActive"`
+	Version  int    `json:"version"`
+}
+
+func NewUserRepository(logger *ddd.Logger, outbox *ddd.FileOutbox, filePersistenceConfig *FilePersistenceConfig) repository.UserRepository {
 	return &userRepository{
-		logger:   logger,
-		dataDir:  filePersistenceConfig.DataDir,
-		eventBus: eventBus,
+		logger:  logger,
+		dataDir: filePersistenceConfig.DataDir,
+		outbox:  outbox,
 	}
 }
 
@@ -42,25 +52,53 @@ func (r *userRepository) Save(user *model.User) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// Read existing data
+	return r.store(user)
+}
+
+func (r *userRepository) Update(user *model.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.store(user)
+}
+
+// store writes a user at its next version along with its events, the lock is held
+func (r *userRepository) store(user *model.User) error {
 	users, err := r.loadAll()
 	if err != nil {
 		return err
 	}
 
-	// Add or update user
-	users[user.ID().String()] = user
+	id := user.ID().String()
+	stored := 0
+	if record, exists := users[id]; exists {
+		stored = record.Version
+	}
+	if err := ddd.CheckVersion(user, stored); err != nil {
+		return err
+	}
 
-	// Write back to file
-	if err := r.saveAll(users); err != nil {
+	users[id] = &userRecord{
+		ID:       id,
+		Email:    user.Email,
+		Name:     user.Name,
+		Role:     user.Role,
+		IsActive: user.IsActive,
+		Version:  stored + 1,
+	}
+	data, err := r.marshalAll(users)
+	if err != nil {
 		return err
-	} else {
-		return r.eventBus.DispatchFrom(user)
 	}
-}
 
-func (r *userRepository) Update(user *model.User) error {
-	return r.eventBus.DispatchFrom(user)
+	// The users file and the raised events are committed together, the outbox relay publishes the events.
+	// The events are cleared once committed, a failed commit leaves them on the user.
+	if err := r.outbox.Commit(r.filePath, data, user.Events()...); err != nil {
+		return err
+	}
+	user.ClearEvents()
+	user.SetVersion(stored + 1)
+	return nil
 }
 
 func (r *userRepository) Load(id ddd.ID) (*model.User, error) {
@@ -72,11 +110,14 @@ func (r *userRepository) Load(id ddd.ID) (*model.User, error) {
 		return nil, err
 	}
 
-	if _, exists := users[id.String()]; exists {
-		return model.LoadUser(id), nil
+	record, exists := users[id.String()]
+	if !exists {
+		return nil, fmt.Errorf("%w with id: %s", model.ErrUserNotFound, id)
 	}
-
-	return nil, fmt.Errorf("user not found with id: %s", id)
+	user := model.LoadUser(id)
+	user.Email, user.Name, user.Role, user.IsActive = record.Email, record.Name, record.Role, record.IsActive
+	user.SetVersion(record.Version)
+	return user, nil
 }
 
 func (r *userRepository) Delete(id ddd.ID) error {
@@ -92,17 +133,18 @@ func (r *userRepository) Delete(id ddd.ID) error {
 	return r.saveAll(users)
 }
 
-func (r *userRepository) loadAll() (map[string]*model.User, error) {
+// loadAll reads the users by id, there are none before the file is written
+func (r *userRepository) loadAll() (map[string]*userRecord, error) {
 	data, err := os.ReadFile(r.filePath)
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
+	users := make(map[string]*userRecord)
 	if len(data) == 0 {
-		return make(map[string]*model.User), nil
+		return users, nil
 	}
 
-	var users map[string]*model.User
 	if err := json.Unmarshal(data, &users); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal data: %w", err)
 	}
@@ -110,10 +152,10 @@ func (r *userRepository) loadAll() (map[string]*model.User, error) {
 	return users, nil
 }
 
-func (r *userRepository) saveAll(users map[string]*model.User) error {
-	data, err := json.MarshalIndent(users, "", "  ")
+func (r *userRepository) saveAll(users map[string]*userRecord) error {
+	data, err := r.marshalAll(users)
 	if err != nil {
-		return fmt.Errorf("failed to marshal data: %w", err)
+		return err
 	}
 
 	if err := os.WriteFile(r.filePath, data, 0644); err != nil {
@@ -122,3 +164,11 @@ func (r *userRepository) saveAll(users map[string]*model.User) error {
 
 	return nil
 }
+
+func (r *userRepository) marshalAll(users map[string]*userRecord) ([]byte, error) {
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %w", err)
+	}
+	return data, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 
 	"github.com/paulvitic/ddd-go"
@@ -30,36 +31,56 @@ func NewUsersView(filePersistenceConfig *FilePersistenceConfig) model.UsersView
 }
 
 func (u *usersView) ById(id string) (*model.UserProjection, error) {
+	users, err := u.read()
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the user
+	user, exists := users[id]
+	if !exists {
+		return nil, fmt.Errorf("%w with id: %s", model.ErrUserNotFound, id)
+	}
+
+	// Convert User to UserView
+	return user, nil
+}
+
+func (u *usersView) All() ([]*model.UserProjection, error) {
+	users, err := u.read()
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]*model.UserProjection, 0, len(users))
+	for _, user := range users {
+		all = append(all, user)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all, nil
+}
+
+// read returns the users of the file by id, there are none before the file is written
+func (u *usersView) read() (map[string]*model.UserProjection, error) {
 	u.mu.RLock()
 	defer u.mu.RUnlock()
 
 	// Read the JSON file
 	data, err := os.ReadFile(u.filePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("user not found with id: %s", id)
-		}
+	if err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
+	users := make(map[string]*model.UserProjection)
 	if len(data) == 0 {
-		return nil, fmt.Errorf("user not found with id: %s", id)
+		return users, nil
 	}
 
 	// Parse the JSON data
-	var users map[string]*model.UserProjection
 	if err := json.Unmarshal(data, &users); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal data: %w", err)
 	}
-
-	// Find the user
-	user, exists := users[id]
-	if !exists {
-		return nil, fmt.Errorf("user not found with id: %s", id)
-	}
-
-	// Convert User to UserView
-	return user, nil
+	return users, nil
 }
 
 func (u *usersView) SubscribedTo() map[string]ddd.HandleEvent {
@@ -1,50 +1,86 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
-	"net/http"
+	"errors"
 
-	"github.com/gorilla/mux"
 	"github.com/paulvitic/ddd-go"
 	"github.com/paulvitic/ddd-go/tests/test_server/test_context/application/command"
 	"github.com/paulvitic/ddd-go/tests/test_server/test_context/application/query"
+	"github.com/paulvitic/ddd-go/tests/test_server/test_context/domain/model"
 )
 
-func ToResigterUserCommand(r *http.Request) (*command.RegisterUser, error) {
-	type RequestData struct {
-		UserId string
-	}
-	var data RequestData
+// RegisterUserRequest is the body of a user registration request
+type RegisterUserRequest struct {
+	UserId string `json:"userId"`
+}
 
-	// Decode directly from request body
-	decoder := json.NewDecoder(r.Body)
-	// decoder.DisallowUnknownFields() // Optional: reject unknown fields
+func ToRegisterUserCommand(ctx context.Context, request RegisterUserRequest) *command.RegisterUser {
+	return command.NewRegisterUser(ddd.NewID(request.UserId), ddd.ContextOf(ctx), ddd.ActingFor(ctx))
+}
 
-	if err := decoder.Decode(&data); err != nil {
-		return nil, err
-	}
-	defer r.Body.Close()
+// UserByIdRequest names the user of a request by its path
+type UserByIdRequest struct {
+	UserId string `path:"userId"`
+}
+
+// ChangeUserRequest is the body of a request replacing the details of a user
+type ChangeUserRequest struct {
+	UserId string `json:"-" path:"userId"`
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+}
 
-	ctx := ddd.GetContext(r)
-	return command.NewRegisterUser(ddd.NewID(data.UserId), ctx), nil
+func ToChangeUserCommand(ctx context.Context, request ChangeUserRequest) (*command.ChangeUser, error) {
+	return command.NewChangeUser(ctx, ddd.NewID(request.UserId), func(user *model.User) {
+		user.ChangeDetails(request.Email, request.Name, request.Role)
+	})
 }
 
-func ToUserByIdQuery(r *http.Request) (ddd.Query, error) {
-	vars := mux.Vars(r)
-	userID := vars["userId"]
+// ReviewUserRequest is the body of a request approving or rejecting a user
+type ReviewUserRequest struct {
+	UserId   string `json:"-" path:"userId"`
+	Approved bool   `json:"approved"`
+}
 
+func ToReviewUserCommand(ctx context.Context, request ReviewUserRequest) (*command.ChangeUser, error) {
+	return command.NewChangeUser(ctx, ddd.NewID(request.UserId), func(user *model.User) {
+		if request.Approved {
+			user.Approve()
+		} else {
+			user.Reject()
+		}
+	})
+}
+
+func ToUserByIdQuery(request UserByIdRequest) ddd.Query {
 	query := &query.UserById{
-		UserId: userID,
+		UserId: request.UserId,
 	}
-	return ddd.NewQuery(query.Filter), nil
-
+	return ddd.NewQuery(query.Filter)
 }
 
-func ToIdentityIdProviderEvent(r *http.Request) ddd.Event {
+func ToAllUsersQuery() ddd.Query {
+	query := &query.AllUsers{}
+	return ddd.NewQuery(query.Filter)
+}
 
-	event, err := ddd.EventFromJsonString("")
-	if err != nil {
-		panic("can not create event from json string")
+// ToIdentityIdProviderEvent translates a user sign up notified by the identity provider
+func ToIdentityIdProviderEvent(msg []byte) (ddd.Event, error) {
+	type Callback struct {
+		UserId string `json:"userId"`
 	}
-	return event
+	var callback Callback
+	if err := json.Unmarshal(msg, &callback); err != nil {
+		return nil, err
+	}
+	if callback.UserId == "" {
+		return nil, errors.New("identity provider callback has no userId")
+	}
+
+	user := model.LoadUser(ddd.NewID(callback.UserId))
+	user.Register()
+	return user.GetFirstEvent(), nil
 }
@@ -0,0 +1,16 @@
+package http
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+)
+
+// NewIdProviderWebhook receives the signed callbacks of the identity provider
+func NewIdProviderWebhook(router *mux.Router) (ddd.MessageConsumer, error) {
+	config, err := ddd.Configuration[ddd.WebhookConfig]("configs/properties.json")
+	if err != nil {
+		return nil, err
+	}
+	config.Path = "/webhooks/idProvider"
+	return ddd.NewWebhookConsumer(*config, ToIdentityIdProviderEvent, router), nil
+}
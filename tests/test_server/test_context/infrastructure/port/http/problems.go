@@ -0,0 +1,12 @@
+package http
+
+import (
+	"github.com/paulvitic/ddd-go"
+	"github.com/paulvitic/ddd-go/tests/test_server/test_context/domain/model"
+)
+
+// NewProblemRegistry maps the errors of the context onto problem responses
+func NewProblemRegistry() ddd.ErrorMapper {
+	return ddd.NewProblemRegistry().
+		Register(model.ErrUserNotFound, ddd.ErrNotFound)
+}
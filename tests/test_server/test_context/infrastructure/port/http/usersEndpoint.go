@@ -1,7 +1,7 @@
 package http
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -12,61 +12,80 @@ import (
 // UsersEndpoint represents a test HTTP endpoint
 type UsersEndpoint struct {
 	ddd.Endpoint
+	_ ddd.Route `route:"GET /users" handler:"List" name:"users" summary:"List users"`
+	_ ddd.Route `route:"GET /users/{userId}" handler:"GetUser" name:"user" summary:"Get a user"`
+	_ ddd.Route `route:"PUT /users/{userId}" handler:"ChangeUser" name:"changeUser" summary:"Change a user"`
+	_ ddd.Route `route:"PATCH /users/{userId}" handler:"ReviewUser" name:"reviewUser" summary:"Approve or reject a user"`
+	_ ddd.Route `route:"DELETE /users/{userId}" handler:"Delete" name:"deleteUser" summary:"Delete a user"`
 	// You can inject other dependencies here if needed
 	//Logger *ddd.Logger `resource:""`
 }
 
 // NewTestEndpoint is the constructor function for TestEndpoint
 func NewUsersEndpoint(logger *ddd.Logger, router *mux.Router) *UsersEndpoint {
-	paths := []string{"/users/{userId}", "/users"}
-	return &UsersEndpoint{
-		Endpoint: ddd.NewEndpoint(&UsersEndpoint{}, paths, logger, router),
-	}
+	// Post is routed by the /users path convention, the other handlers declare their routes
+	paths := []string{"/users"}
+	endpoint := &UsersEndpoint{}
+	endpoint.Endpoint = ddd.NewEndpoint(endpoint, paths, logger, router)
+	return endpoint
 }
 
 // Post handles POST requests - discovered by method name convention
-func (t *UsersEndpoint) Post(w http.ResponseWriter, r *http.Request) {
-
-	command, err := ToResigterUserCommand(r)
-	w.Header().Set("Content-Type", "application/json")
+func (t *UsersEndpoint) Post(ctx context.Context, request RegisterUserRequest) (*ddd.Response, error) {
+	res, err := ToRegisterUserCommand(ctx, request).Execute()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(err)
+		return nil, err
 	}
 
-	res, err := command.Execute()
+	response := map[string]any{"message": res.(*model.User).ID().String()}
+	return ddd.NewResponse(http.StatusCreated, response), nil
+}
+
+// List handles GET /users
+func (t *UsersEndpoint) List(r *http.Request) (any, error) {
+	res, err := ToAllUsersQuery().Filter(ddd.GetContext(r))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(err)
+		return nil, err
 	}
-
-	response := make(map[string]any, 0)
-	response["message"] = res.(*model.User).ID().String()
-
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	return res.Items(), nil
 }
 
-// Post handles POST requests - discovered by method name convention
-func (t *UsersEndpoint) Get(w http.ResponseWriter, r *http.Request) {
-	ctx := ddd.GetContext(r)
+// GetUser handles GET /users/{userId}
+func (t *UsersEndpoint) GetUser(ctx context.Context, request UserByIdRequest) (any, error) {
+	appCtx := ddd.ContextOf(ctx)
 
-	ctx.Logger().Info("get method called")
-	query, err := ToUserByIdQuery(r)
+	appCtx.Logger().Info("get method called")
+	res, err := ToUserByIdQuery(request).Filter(appCtx)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(err)
+		return nil, err
 	}
+	return res.Items(), nil
+}
 
-	res, err := query.Filter(ctx)
+// ChangeUser handles PUT /users/{userId}, an If-Match header names the version the client changes
+func (t *UsersEndpoint) ChangeUser(ctx context.Context, request ChangeUserRequest) (*model.User, error) {
+	cmd, err := ToChangeUserCommand(ctx, request)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(err)
+		return nil, err
 	}
+	res, err := cmd.Execute()
+	if err != nil {
+		return nil, err
+	}
+	return res.(*model.User), nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(res.Items())
+// ReviewUser handles PATCH /users/{userId}, an If-Match header names the version the client reviews
+func (t *UsersEndpoint) ReviewUser(ctx context.Context, request ReviewUserRequest) (*model.User, error) {
+	cmd, err := ToReviewUserCommand(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	res, err := cmd.Execute()
+	if err != nil {
+		return nil, err
+	}
+	return res.(*model.User), nil
 }
 
 // Delete handles DELETE requests - discovered by method name convention
@@ -0,0 +1,16 @@
+package http
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+	"github.com/paulvitic/ddd-go/tests/test_server/test_context/domain/model"
+)
+
+// NewUsersEventStream streams the events of users, they are public in the test context
+func NewUsersEventStream(logger *ddd.Logger, router *mux.Router) *ddd.EventStream {
+	userType := ddd.AggregateType(model.User{})
+	return ddd.NewEventStream(logger, router).
+		WithAuthorizer(func(principal *ddd.Principal, event ddd.Event) bool {
+			return event.AggregateType() == userType
+		})
+}
@@ -0,0 +1,142 @@
+package ddd_tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/paulvitic/ddd-go"
+	testhttp "github.com/paulvitic/ddd-go/tests/test_server/test_context/infrastructure/port/http"
+)
+
+const webhookSecret = "secret"
+
+// startWebhook serves a webhook consumer dispatching to the given handler
+func startWebhook(t *testing.T, handler ddd.EventHandler) *httptest.Server {
+	t.Helper()
+	router := mux.NewRouter()
+	config := ddd.WebhookConfig{
+		Path:            "/idProvider",
+		Secret:          webhookSecret,
+		SignaturePrefix: "sha256=",
+		TimestampHeader: "X-Timestamp",
+		NonceHeader:     "X-Request-Id",
+	}
+	ctx := ddd.NewContext(context.Background(), router, "hooks").
+		WithResources(
+			ddd.Resource(func() ddd.EventHandler { return handler }, "handler"),
+			ddd.Resource(func(router *mux.Router) ddd.MessageConsumer {
+				return ddd.NewWebhookConsumer(config, testhttp.ToIdentityIdProviderEvent, router)
+			}, "webhook"),
+		)
+	if err := ctx.Start(); err != nil {
+		t.Fatalf("Failed to start context: %v", err)
+	}
+	t.Cleanup(func() { ctx.Destroy() })
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postWebhook(t *testing.T, server *httptest.Server, body string, signedAt time.Time, nonce string, secret string) int {
+	t.Helper()
+	return postSignedWebhook(t, server, body, signedAt, nonce, nonce, secret)
+}
+
+// postSignedWebhook posts a request signed with a nonce but sent with another, as a replay would
+func postSignedWebhook(t *testing.T, server *httptest.Server, body string, signedAt time.Time, signedNonce, sentNonce string, secret string) int {
+	t.Helper()
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + signedNonce + "." + body))
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/hooks/idProvider", bytes.NewBufferString(body))
+	req.Header.Set("X-Timestamp", timestamp)
+	req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	if sentNonce != "" {
+		req.Header.Set("X-Request-Id", sentNonce)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestWebhookConsumerVerifiesRequests(t *testing.T) {
+	handler := &failingHandler{}
+	server := startWebhook(t, handler)
+	now := time.Now()
+
+	cases := []struct {
+		name     string
+		body     string
+		signedAt time.Time
+		nonce    string
+		secret   string
+		status   int
+	}{
+		{"valid", `{"userId":"1"}`, now, "a", webhookSecret, http.StatusOK},
+		{"replayed nonce", `{"userId":"1"}`, now, "a", webhookSecret, http.StatusConflict},
+		{"bad signature", `{"userId":"2"}`, now, "b", "other", http.StatusUnauthorized},
+		{"stale timestamp", `{"userId":"3"}`, now.Add(-time.Hour), "c", webhookSecret, http.StatusUnauthorized},
+		{"untranslatable", `{}`, now, "d", webhookSecret, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if status := postWebhook(t, server, c.body, c.signedAt, c.nonce, c.secret); status != c.status {
+			t.Errorf("%s: expected status %d, got %d", c.name, c.status, status)
+		}
+	}
+	// A captured request replayed with a fresh or without a nonce
+	if status := postSignedWebhook(t, server, `{"userId":"1"}`, now, "a", "e", webhookSecret); status != http.StatusUnauthorized {
+		t.Errorf("Expected a request replayed with a fresh nonce to answer 401, got %d", status)
+	}
+	if status := postSignedWebhook(t, server, `{"userId":"1"}`, now, "", "", webhookSecret); status != http.StatusUnauthorized {
+		t.Errorf("Expected a request without nonce to answer 401, got %d", status)
+	}
+	if handler.calls.Load() != 1 {
+		t.Errorf("Expected only the valid request to be handled, got %d calls", handler.calls.Load())
+	}
+}
+
+func TestWebhookConsumerRequiresSecretAndTimestamp(t *testing.T) {
+	configs := map[string]ddd.WebhookConfig{
+		"no secret":    {Path: "/idProvider"},
+		"no timestamp": {Path: "/idProvider", Secret: webhookSecret, NonceHeader: "X-Request-Id"},
+	}
+	for name, config := range configs {
+		ctx := ddd.NewContext(context.Background(), mux.NewRouter(), "hooks").
+			WithResources(ddd.Resource(func(router *mux.Router) ddd.MessageConsumer {
+				return ddd.NewWebhookConsumer(config, testhttp.ToIdentityIdProviderEvent, router)
+			}, "webhook"))
+		if err := ctx.Start(); err == nil {
+			t.Errorf("%s: expected the webhook to be refused", name)
+			ctx.Destroy()
+		}
+	}
+}
+
+func TestWebhookConsumerReportsHandlerFailures(t *testing.T) {
+	handler := &failingHandler{failures: 1, err: ddd.Fatal(errors.New("rejected"))}
+	server := startWebhook(t, handler)
+
+	if status := postWebhook(t, server, `{"userId":"1"}`, time.Now(), "a", webhookSecret); status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected a rejected event to answer 422, got %d", status)
+	}
+	// The failed request was not processed, the sender may retry it with the same id
+	if status := postWebhook(t, server, `{"userId":"1"}`, time.Now(), "a", webhookSecret); status != http.StatusOK {
+		t.Errorf("Expected the retried request to succeed, got %d", status)
+	}
+}
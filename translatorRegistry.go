@@ -0,0 +1,170 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnroutableMessage is returned when no translator handles a message and there is no parking lot to keep it
+var ErrUnroutableMessage = errors.New("no translator for message")
+
+// Discriminator extracts the key a message is routed by
+type Discriminator func(ctx context.Context, msg []byte) (string, error)
+
+// JsonFieldDiscriminator routes json messages by a field, nested fields are separated with dots
+func JsonFieldDiscriminator(path string) Discriminator {
+	fields := strings.Split(path, ".")
+	return func(ctx context.Context, msg []byte) (string, error) {
+		var value any
+		if err := json.Unmarshal(msg, &value); err != nil {
+			return "", fmt.Errorf("message is not json: %w", err)
+		}
+		for _, field := range fields {
+			object, ok := value.(map[string]any)
+			if !ok {
+				return "", fmt.Errorf("message has no field %s", path)
+			}
+			if value, ok = object[field]; !ok {
+				return "", fmt.Errorf("message has no field %s", path)
+			}
+		}
+		switch value := value.(type) {
+		case string:
+			return value, nil
+		case float64, bool:
+			return fmt.Sprint(value), nil
+		default:
+			return "", fmt.Errorf("field %s is not a scalar", path)
+		}
+	}
+}
+
+// HeaderDiscriminator routes messages by a header set on the context with WithMessageHeaders
+func HeaderDiscriminator(name string) Discriminator {
+	return func(ctx context.Context, msg []byte) (string, error) {
+		if value, ok := GetMessageHeaders(ctx)[name]; ok {
+			return value, nil
+		}
+		return "", fmt.Errorf("message has no header %s", name)
+	}
+}
+
+// TypeAttributeDiscriminator routes messages by the type attribute set on the context with WithMessageType
+func TypeAttributeDiscriminator() Discriminator {
+	return func(ctx context.Context, msg []byte) (string, error) {
+		if messageType, ok := GetMessageType(ctx); ok {
+			return messageType, nil
+		}
+		return "", errors.New("message has no type attribute")
+	}
+}
+
+// TranslatorRegistry routes each message of a source carrying several kinds of messages to the
+// translator registered for its discriminator key. Messages without a translator go to the
+// fallback translator if any, otherwise they are parked and the consumer acknowledges them.
+type TranslatorRegistry struct {
+	target        string
+	discriminator Discriminator
+	translators   map[string]MessageTranslator
+	fallback      MessageTranslator
+	parkingLot    ParkingLot
+	logger        *Logger
+	mu            sync.RWMutex
+}
+
+// NewTranslatorRegistry creates a registry routing messages by the given discriminator,
+// unroutable messages are parked in memory unless another parking lot is set
+func NewTranslatorRegistry(discriminator Discriminator) *TranslatorRegistry {
+	return &TranslatorRegistry{
+		discriminator: discriminator,
+		translators:   make(map[string]MessageTranslator),
+		parkingLot:    NewInMemoryParkingLot(),
+		logger:        NewLogger(),
+	}
+}
+
+// Register routes the messages with the given discriminator key to a translator
+func (r *TranslatorRegistry) Register(key string, translator MessageTranslator) *TranslatorRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.translators[key] = translator
+	return r
+}
+
+// WithFallback sets the translator of messages with no registered translator
+func (r *TranslatorRegistry) WithFallback(translator MessageTranslator) *TranslatorRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fallback = translator
+	return r
+}
+
+// WithParkingLot sets where unroutable messages are parked, nil rejects them with ErrUnroutableMessage
+func (r *TranslatorRegistry) WithParkingLot(parkingLot ParkingLot) *TranslatorRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.parkingLot = parkingLot
+	return r
+}
+
+// ParkingLot returns where unroutable messages are parked
+func (r *TranslatorRegistry) ParkingLot() ParkingLot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.parkingLot
+}
+
+// Translate routes a message to its translator. It returns ErrMessageParked when the message was parked.
+func (r *TranslatorRegistry) Translate(ctx context.Context, msg []byte) (Event, error) {
+	key, err := r.discriminator(ctx, msg)
+
+	r.mu.RLock()
+	translator, ok := r.translators[key]
+	fallback := r.fallback
+	r.mu.RUnlock()
+
+	switch {
+	case err == nil && ok:
+		return translator(msg)
+	case fallback != nil:
+		return fallback(msg)
+	case err != nil:
+		return nil, r.park(ctx, msg, err.Error())
+	default:
+		return nil, r.park(ctx, msg, fmt.Sprintf("no translator registered for %q", key))
+	}
+}
+
+// park keeps an unroutable message in the parking lot
+func (r *TranslatorRegistry) park(ctx context.Context, msg []byte, reason string) error {
+	parkingLot := r.ParkingLot()
+	if parkingLot == nil {
+		return Fatal(fmt.Errorf("%w: %s", ErrUnroutableMessage, reason))
+	}
+
+	target, _ := GetMessageSource(ctx)
+	messageType, _ := GetMessageType(ctx)
+	parked := &ParkedMessage{
+		ID:       GenerateUUID().String(),
+		Target:   target,
+		Body:     append([]byte{}, msg...),
+		Headers:  GetMessageHeaders(ctx),
+		Type:     messageType,
+		Reason:   reason,
+		ParkedAt: time.Now(),
+	}
+	if err := parkingLot.Park(parked); err != nil {
+		return fmt.Errorf("failed to park message: %w", err)
+	}
+
+	r.logger.Warn("parked message %s: %s", parked.ID, reason)
+	return fmt.Errorf("%w: %s", ErrMessageParked, reason)
+}
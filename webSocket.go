@@ -0,0 +1,294 @@
+package ddd
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webSocketGUID is the key suffix of the opening handshake, see RFC 6455
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// closeProtocolError is the status code closing a WebSocket whose client broke the protocol
+const closeProtocolError = 1002
+
+// webSocketWriteTimeout bounds the time a frame takes to reach a client
+const webSocketWriteTimeout = 10 * time.Second
+
+// isWebSocketUpgrade tells whether a request opens a WebSocket
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// headerHasToken tells whether a comma separated header contains a token
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// webSocket is the server end of a WebSocket. It sends text messages, answers the pings and the closing
+// handshake of the client and discards the messages the client sends.
+type webSocket struct {
+	conn   net.Conn
+	rw     *bufio.ReadWriter
+	mu     sync.Mutex
+	closed chan struct{}
+	once   sync.Once
+	// fragmented tells whether the client is sending a message in several frames, it is used by read alone
+	fragmented bool
+}
+
+// upgradeWebSocket completes the opening handshake of a WebSocket request and takes over its connection.
+// Requests of browsers come from the host of the request or one of the allowed origins.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, allowedOrigins []string) (*webSocket, error) {
+	if r.Method != http.MethodGet {
+		return nil, fmt.Errorf("%w: websocket requests must use GET", ErrBadRequest)
+	}
+	if !allowedOrigin(r, allowedOrigins) {
+		return nil, Forbidden("websocket origin not allowed")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, fmt.Errorf("%w: unsupported websocket version", ErrBadRequest)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("%w: missing Sec-WebSocket-Key", ErrBadRequest)
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to take over the connection: %w", err)
+	}
+	// The deadlines of the server do not apply to the WebSocket
+	conn.SetDeadline(time.Time{})
+
+	digest := sha1.Sum([]byte(key + webSocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(digest[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ws := &webSocket{conn: conn, rw: rw, closed: make(chan struct{})}
+	go ws.read()
+	return ws, nil
+}
+
+// allowedOrigin tells whether the Origin header of a request is its host or one of the allowed origins.
+// Clients other than browsers send no origin.
+func allowedOrigin(r *http.Request, allowedOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(parsed.Host, r.Host)
+}
+
+// Done is closed once the WebSocket is closed
+func (ws *webSocket) Done() <-chan struct{} {
+	return ws.closed
+}
+
+// WriteText sends a text message
+func (ws *webSocket) WriteText(data []byte) error {
+	return ws.writeFrame(opText, data)
+}
+
+// Ping sends a ping, clients answer it with a pong
+func (ws *webSocket) Ping() error {
+	return ws.writeFrame(opPing, nil)
+}
+
+// Close sends a close frame with a status code and closes the connection
+func (ws *webSocket) Close(code uint16) {
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	ws.writeFrame(opClose, payload)
+	ws.close()
+}
+
+func (ws *webSocket) close() {
+	ws.once.Do(func() {
+		close(ws.closed)
+		ws.conn.Close()
+	})
+}
+
+// writeFrame writes an unmasked frame, servers do not mask their frames
+func (ws *webSocket) writeFrame(opcode byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	select {
+	case <-ws.closed:
+		return net.ErrClosed
+	default:
+	}
+
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length <= 125:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = binary.BigEndian.AppendUint16(append(header, 126), uint16(length))
+	default:
+		header = binary.BigEndian.AppendUint64(append(header, 127), uint64(length))
+	}
+
+	ws.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+	if _, err := ws.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := ws.rw.Write(payload); err != nil {
+		return err
+	}
+	return ws.rw.Flush()
+}
+
+// read answers the control frames of the client until it closes the WebSocket or the connection fails
+func (ws *webSocket) read() {
+	defer ws.close()
+	for {
+		opcode, payload, err := ws.readFrame()
+		if errors.Is(err, errWebSocketProtocol) {
+			ws.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, closeProtocolError))
+			return
+		}
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case opPing:
+			ws.writeFrame(opPong, payload)
+		case opClose:
+			// Echo the status code of the client to complete the closing handshake
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			ws.writeFrame(opClose, payload)
+			return
+		}
+	}
+}
+
+// maxControlPayload is the largest payload of a control frame
+const maxControlPayload = 125
+
+// errWebSocketProtocol is returned for frames breaking RFC 6455, the WebSocket closes with a protocol error
+var errWebSocketProtocol = errors.New("websocket protocol error")
+
+// readFrame reads a frame of the client, returning the payload of control frames alone
+func (ws *webSocket) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.rw, head[:]); err != nil {
+		return 0, nil, err
+	}
+	final, opcode := head[0]&0x80 != 0, head[0]&0x0F
+	if err := ws.checkFrame(final, head[0]&0x70, opcode); err != nil {
+		return 0, nil, err
+	}
+	if head[1]&0x80 == 0 {
+		return 0, nil, fmt.Errorf("%w: client frames must be masked", errWebSocketProtocol)
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(ws.rw, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(ws.rw, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+		if length > math.MaxInt64 {
+			return 0, nil, fmt.Errorf("%w: frame length %d", errWebSocketProtocol, length)
+		}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.rw, mask[:]); err != nil {
+		return 0, nil, err
+	}
+
+	if opcode < opClose {
+		// Data frames of the client are not used
+		_, err := io.CopyN(io.Discard, ws.rw, int64(length))
+		return opcode, nil, err
+	}
+	if length > maxControlPayload {
+		return 0, nil, fmt.Errorf("%w: control frame of %d bytes", errWebSocketProtocol, length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// checkFrame validates the header of a frame against the messages in progress: extensions are not
+// negotiated, control frames are not fragmented and continuations follow the first frame of a message
+func (ws *webSocket) checkFrame(final bool, reserved byte, opcode byte) error {
+	if reserved != 0 {
+		return fmt.Errorf("%w: reserved bits set", errWebSocketProtocol)
+	}
+	switch opcode {
+	case opClose, opPing, opPong:
+		if !final {
+			return fmt.Errorf("%w: fragmented control frame", errWebSocketProtocol)
+		}
+	case opText, opBinary:
+		if ws.fragmented {
+			return fmt.Errorf("%w: message started before the previous one ended", errWebSocketProtocol)
+		}
+		ws.fragmented = !final
+	case opContinuation:
+		if !ws.fragmented {
+			return fmt.Errorf("%w: continuation without a message", errWebSocketProtocol)
+		}
+		ws.fragmented = !final
+	default:
+		return fmt.Errorf("%w: reserved opcode %#x", errWebSocketProtocol, opcode)
+	}
+	return nil
+}
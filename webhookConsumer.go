@@ -0,0 +1,332 @@
+package ddd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	// ErrInvalidSignature is returned when a webhook request is not signed with the shared secret
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrReplayedRequest is returned when a webhook request is too old or was already received
+	ErrReplayedRequest = errors.New("replayed webhook request")
+)
+
+// WebhookConfig holds the settings of a webhook consumer. When a timestamp header is set, the
+// signature covers the timestamp, the nonce when a nonce header is set, and the body joined with
+// dots, otherwise the body alone.
+type WebhookConfig struct {
+	// Path is where the webhook is mounted on the context router
+	Path string `json:"webhookPath"`
+	// Secret is the key shared with the sender, it is required
+	Secret string `json:"webhookSecret"`
+	// SignatureHeader carries the signature, X-Signature by default
+	SignatureHeader string `json:"webhookSignatureHeader"`
+	// SignaturePrefix is stripped from the signature, such as "sha256="
+	SignaturePrefix string `json:"webhookSignaturePrefix"`
+	// Algorithm is the HMAC hash: sha1, sha256 (default) or sha512
+	Algorithm string `json:"webhookAlgorithm"`
+	// Encoding of the signature: hex (default) or base64
+	Encoding string `json:"webhookEncoding"`
+	// TimestampHeader carries the time the request was signed, in unix seconds or RFC 3339
+	TimestampHeader string `json:"webhookTimestampHeader"`
+	// ToleranceSec is how old a signed timestamp may be, 300 by default
+	ToleranceSec int `json:"webhookToleranceSec"`
+	// NonceHeader carries a unique request id, requests without one or with an id already received
+	// are rejected. It requires a timestamp header.
+	NonceHeader string `json:"webhookNonceHeader"`
+	// MaxBodyBytes limits the size of a request body, 1MB by default
+	MaxBodyBytes int64 `json:"webhookMaxBodyBytes"`
+	// ProcessingTimeoutMs limits how long the handlers of a request may take, 30000 by default
+	ProcessingTimeoutMs int `json:"webhookProcessingTimeoutMs"`
+}
+
+// withDefaults fills unset values with the webhook defaults
+func (c WebhookConfig) withDefaults() WebhookConfig {
+	if c.SignatureHeader == "" {
+		c.SignatureHeader = "X-Signature"
+	}
+	if c.Algorithm == "" {
+		c.Algorithm = "sha256"
+	}
+	if c.Encoding == "" {
+		c.Encoding = "hex"
+	}
+	if c.ToleranceSec <= 0 {
+		c.ToleranceSec = 300
+	}
+	if c.MaxBodyBytes <= 0 {
+		c.MaxBodyBytes = 1 << 20
+	}
+	if c.ProcessingTimeoutMs <= 0 {
+		c.ProcessingTimeoutMs = 30000
+	}
+	return c
+}
+
+// NonceStore remembers the request ids a webhook received
+type NonceStore interface {
+	// Claim records a nonce until it expires, it returns false if the nonce is already recorded
+	Claim(nonce string, expiresAt time.Time) (bool, error)
+	// Release forgets a nonce so that the request can be retried
+	Release(nonce string) error
+}
+
+// inMemoryNonceStore is a NonceStore keeping nonces in memory
+type inMemoryNonceStore struct {
+	nonces map[string]time.Time
+	mu     sync.Mutex
+}
+
+// NewInMemoryNonceStore creates a new in-memory nonce store
+func NewInMemoryNonceStore() NonceStore {
+	return &inMemoryNonceStore{
+		nonces: make(map[string]time.Time),
+	}
+}
+
+func (s *inMemoryNonceStore) Claim(nonce string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for stored, expiry := range s.nonces {
+		if now.After(expiry) {
+			delete(s.nonces, stored)
+		}
+	}
+
+	if _, seen := s.nonces[nonce]; seen {
+		return false, nil
+	}
+	s.nonces[nonce] = expiresAt
+	return true, nil
+}
+
+func (s *inMemoryNonceStore) Release(nonce string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.nonces, nonce)
+	return nil
+}
+
+//-------------------------------------------------------------
+// WebhookConsumer for HTTP callbacks
+//-------------------------------------------------------------
+
+// WebhookConsumer is a MessageConsumer receiving messages as signed HTTP POST requests on the
+// context router. The response tells the sender whether to retry: 200 once all handlers succeeded,
+// 400 for a body that cannot be translated, 401 for a bad signature or a stale timestamp, 409 for
+// a replayed nonce, 422 when a handler rejected the event for good, 503 when the event bus cannot
+// take the event and 500 when handlers failed.
+type WebhookConsumer struct {
+	*baseMessageConsumer
+	log    *Logger
+	config WebhookConfig
+	router *mux.Router
+	nonces NonceStore
+}
+
+// NewWebhookConsumer creates a webhook consumer translating request bodies with the given translator
+func NewWebhookConsumer(config WebhookConfig, translator MessageTranslator, router *mux.Router) *WebhookConsumer {
+	return &WebhookConsumer{
+		baseMessageConsumer: NewBaseMessageConsumer(config.Path, translator),
+		log:                 NewLogger(),
+		config:              config.withDefaults(),
+		router:              router,
+		nonces:              NewInMemoryNonceStore(),
+	}
+}
+
+// WithNonceStore replaces where received nonces are remembered
+func (c *WebhookConsumer) WithNonceStore(nonces NonceStore) *WebhookConsumer {
+	c.nonces = nonces
+	return c
+}
+
+// OnInit mounts the webhook on the router, requests are refused until the consumer starts
+func (c *WebhookConsumer) OnInit() error {
+	if _, err := newHmac(c.config.Algorithm, nil); err != nil {
+		return err
+	}
+	if c.config.Secret == "" {
+		return fmt.Errorf("webhook %s has no secret", c.config.Path)
+	}
+	if c.config.NonceHeader != "" && c.config.TimestampHeader == "" {
+		return fmt.Errorf("webhook %s checks nonces without a timestamp header", c.config.Path)
+	}
+	c.router.Handle(c.config.Path, c).Methods(string(POST))
+	c.log.Info("registered webhook at %s %s", string(POST), c.config.Path)
+	return nil
+}
+
+// ServeHTTP verifies, translates and dispatches a webhook request
+func (c *WebhookConsumer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !c.Running() {
+		http.Error(w, "webhook not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, c.config.MaxBodyBytes))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := c.verify(r, body); err != nil {
+		c.log.Warn("rejected webhook request to %s: %v", c.config.Path, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	nonce := r.Header.Get(c.config.NonceHeader)
+	if c.config.NonceHeader != "" {
+		expiresAt := time.Now().Add(2 * time.Duration(c.config.ToleranceSec) * time.Second)
+		claimed, err := c.nonces.Claim(nonce, expiresAt)
+		if err != nil {
+			http.Error(w, "failed to check request id", http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			c.log.Warn("rejected webhook request to %s: %v %s", c.config.Path, ErrReplayedRequest, nonce)
+			http.Error(w, ErrReplayedRequest.Error(), http.StatusConflict)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(c.config.ProcessingTimeoutMs)*time.Millisecond)
+	defer cancel()
+	ctx = context.WithValue(ctx, MessageSourceKey{}, c.Target())
+	ctx = WithMessageHeaders(ctx, requestHeaders(r))
+
+	err = c.ProcessMessage(ctx, body)
+	if err != nil && nonce != "" {
+		// Let the sender retry a request that was not processed
+		if releaseErr := c.nonces.Release(nonce); releaseErr != nil {
+			c.log.Error("failed to release webhook nonce %s: %v", nonce, releaseErr)
+		}
+	}
+
+	status := webhookStatus(err)
+	if err != nil {
+		c.log.Error("webhook request to %s failed with status %d: %v", c.config.Path, status, err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.WriteHeader(status)
+}
+
+// verify checks the signature and the freshness of a request
+func (c *WebhookConsumer) verify(r *http.Request, body []byte) error {
+	signed := body
+	if c.config.TimestampHeader != "" {
+		timestamp := r.Header.Get(c.config.TimestampHeader)
+		signedAt, err := parseWebhookTimestamp(timestamp)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrReplayedRequest, err)
+		}
+		tolerance := time.Duration(c.config.ToleranceSec) * time.Second
+		if age := time.Since(signedAt); age > tolerance || age < -tolerance {
+			return fmt.Errorf("%w: signed %v ago", ErrReplayedRequest, age.Round(time.Second))
+		}
+		if c.config.NonceHeader != "" {
+			nonce := r.Header.Get(c.config.NonceHeader)
+			if nonce == "" {
+				return fmt.Errorf("%w: missing %s header", ErrReplayedRequest, c.config.NonceHeader)
+			}
+			timestamp += "." + nonce
+		}
+		signed = append([]byte(timestamp+"."), body...)
+	}
+
+	signature := strings.TrimPrefix(r.Header.Get(c.config.SignatureHeader), c.config.SignaturePrefix)
+	if signature == "" {
+		return fmt.Errorf("%w: missing %s header", ErrInvalidSignature, c.config.SignatureHeader)
+	}
+
+	var provided []byte
+	var err error
+	if c.config.Encoding == "base64" {
+		provided, err = base64.StdEncoding.DecodeString(signature)
+	} else {
+		provided, err = hex.DecodeString(signature)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	mac, _ := newHmac(c.config.Algorithm, []byte(c.config.Secret))
+	mac.Write(signed)
+	if !hmac.Equal(provided, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// newHmac creates an HMAC with the hash of the given algorithm
+func newHmac(algorithm string, key []byte) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "sha1":
+		return hmac.New(sha1.New, key), nil
+	case "sha256":
+		return hmac.New(sha256.New, key), nil
+	case "sha512":
+		return hmac.New(sha512.New, key), nil
+	default:
+		return nil, fmt.Errorf("unsupported webhook signature algorithm %s", algorithm)
+	}
+}
+
+// parseWebhookTimestamp reads a timestamp in unix seconds or RFC 3339
+func parseWebhookTimestamp(timestamp string) (time.Time, error) {
+	if timestamp == "" {
+		return time.Time{}, errors.New("missing timestamp")
+	}
+	if seconds, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, timestamp)
+}
+
+// webhookStatus maps the outcome of processing a webhook request to a response status
+func webhookStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrInvalidMessage):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrEventBusNotRunning), errors.Is(err, ErrEventQueueFull),
+		errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	case !IsRetryable(err):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// requestHeaders flattens request headers to their first value
+func requestHeaders(r *http.Request) map[string]string {
+	headers := make(map[string]string, len(r.Header))
+	for name := range r.Header {
+		headers[name] = r.Header.Get(name)
+	}
+	return headers
+}